@@ -4,7 +4,10 @@ go 1.24.0
 
 toolchain go1.24.11
 
-require github.com/jackc/pgx/v5 v5.8.0
+require (
+	github.com/jackc/pgx/v5 v5.8.0
+	github.com/klauspost/compress v1.18.0
+)
 
 require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+// partitionPassTimeout bounds one pass. DETACH ... CONCURRENTLY waits for
+// every transaction that might still see the partition, so a long-running
+// query could otherwise hold up startup indefinitely; an interrupted detach
+// is finalized by the next pass.
+const partitionPassTimeout = 30 * time.Second
+
+// startPartitionManager runs PartitionRepo.Maintain before returning, so
+// today's and upcoming partitions exist before serving, and then every
+// interval.
+func startPartitionManager(r *repo.PartitionRepo, policy repo.PartitionPolicy, interval time.Duration, logger *jsonlog.Logger) *periodic {
+	p := newPeriodic("partition_manager", interval, partitionPassTimeout, logger, func(ctx context.Context) error {
+		rep, err := r.Maintain(ctx, policy, time.Now())
+		if err != nil {
+			return err
+		}
+		if len(rep.Created) > 0 || len(rep.Dropped) > 0 {
+			logger.PrintInfo("events partitions updated", map[string]string{
+				"created": strings.Join(rep.Created, ","),
+				"dropped": strings.Join(rep.Dropped, ","),
+			})
+		}
+		return nil
+	})
+	p.Start(true)
+	return p
+}
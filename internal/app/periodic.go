@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+// periodic runs a maintenance pass on start and then every interval, until
+// Stop. Each pass is bounded by timeout; a failed pass is logged under
+// component and retried on the next tick.
+type periodic struct {
+	component string
+	interval  time.Duration
+	timeout   time.Duration
+	logger    *jsonlog.Logger
+	pass      func(ctx context.Context) error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPeriodic(component string, interval, timeout time.Duration, logger *jsonlog.Logger, pass func(ctx context.Context) error) *periodic {
+	return &periodic{
+		component: component,
+		interval:  interval,
+		timeout:   timeout,
+		logger:    logger,
+		pass:      pass,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs the first pass, before returning when wait is set, and then
+// starts the loop.
+func (p *periodic) Start(wait bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	if wait {
+		p.run(ctx)
+	}
+	go func() {
+		defer close(p.done)
+		if !wait {
+			p.run(ctx)
+		}
+
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				p.run(ctx)
+			}
+		}
+	}()
+}
+
+func (p *periodic) run(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, p.timeout)
+	defer cancel()
+
+	if err := p.pass(ctx); err != nil && parent.Err() == nil {
+		p.logger.PrintError(err, map[string]string{"component": p.component})
+	}
+}
+
+// Stop cancels a running pass and waits for the loop to exit.
+func (p *periodic) Stop() {
+	p.cancel()
+	<-p.done
+}
@@ -0,0 +1,24 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+// rollupSettle is how old a minute must be before it is compacted; most of
+// its rows have been written by then.
+const rollupSettle = 2 * time.Minute
+
+// startRollupCompactor folds the rollup rows writers append into one row
+// per key (RollupRepo.Compact), every interval.
+func startRollupCompactor(r *repo.RollupRepo, interval time.Duration, logger *jsonlog.Logger) *periodic {
+	p := newPeriodic("rollup_compactor", interval, interval, logger, func(ctx context.Context) error {
+		_, err := r.Compact(ctx, time.Now().Add(-rollupSettle))
+		return err
+	})
+	p.Start(false)
+	return p
+}
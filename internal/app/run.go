@@ -11,6 +11,7 @@ import (
 	"github.com/cun0/insider-case/internal/ingest"
 	"github.com/cun0/insider-case/internal/jsonlog"
 	"github.com/cun0/insider-case/internal/repo"
+	"github.com/cun0/insider-case/internal/telemetry"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -29,34 +30,129 @@ func Run(version, buildTime string) error {
 
 	logger := jsonlog.New(os.Stdout, level)
 
+	tracer, err := newTracer(cfg.Trace, logger)
+	if err != nil {
+		return err
+	}
+
 	pool, err := openPool(cfg)
 	if err != nil {
+		_ = tracer.Shutdown(context.Background())
 		return err
 	}
 	// pool.Close() is called in onShutdown to keep the lifecycle in one place.
 
-	eventRepo := repo.NewEventRepo(pool)
+	eventRepo := repo.NewEventRepo(pool, repo.InsertMode(cfg.DB.InsertMode))
 	metricsRepo := repo.NewMetricsRepo(pool)
+	deadLetterRepo := repo.NewDeadLetterRepo(pool)
+	apiKeyRepo := repo.NewAPIKeyRepo(pool)
 
-	writer := ingest.NewSingleWriter(eventRepo, ingest.Config{
+	var partitions *periodic
+	if cfg.Partitions.Manager {
+		partitions = startPartitionManager(repo.NewPartitionRepo(pool), repo.PartitionPolicy{
+			Interval:  repo.PartitionInterval(cfg.Partitions.Interval),
+			Premake:   cfg.Partitions.Premake,
+			Retention: cfg.Partitions.Retention,
+			Lookback:  cfg.Partitions.MaxEventAge,
+		}, cfg.Partitions.CheckInterval, logger)
+	}
+	compactor := startRollupCompactor(repo.NewRollupRepo(pool), cfg.Rollups.CompactInterval, logger)
+
+	reg := telemetry.NewRegistry()
+	repo.RegisterPoolMetrics(reg, pool)
+	ingestMetrics := ingest.NewMetrics(reg)
+
+	writerCfg := ingest.Config{
 		BatchWindow: defaultDuration(cfg.Ingest.BatchWindow, 2*time.Millisecond),
 		MaxBatch:    defaultInt(cfg.Ingest.MaxBatch, 800),
 		QueueSize:   defaultInt(cfg.Ingest.QueueSize, 50_000),
-	}, logger)
-	_ = writer.Start()
+
+		Adaptive:       cfg.Ingest.Adaptive,
+		MinBatchWindow: cfg.Ingest.MinBatchWindow,
+		MinBatch:       cfg.Ingest.MinBatch,
+
+		Admission: ingest.AdmissionConfig{
+			Policy:  ingest.AdmissionPolicy(cfg.Ingest.AdmissionPolicy),
+			MaxWait: cfg.Ingest.AdmissionMaxWait,
+		},
+		Metrics: ingestMetrics,
+		Tracer:  tracer,
+	}
+
+	var writer ingest.Sink
+	switch {
+	case cfg.Ingest.Spool.Dir != "":
+		writer = ingest.NewSpool(eventRepo, deadLetterRepo, ingest.SpoolConfig{
+			Dir:           cfg.Ingest.Spool.Dir,
+			SegmentBytes:  cfg.Ingest.Spool.SegmentBytes,
+			MaxBytes:      cfg.Ingest.Spool.MaxBytes,
+			Fsync:         ingest.FsyncPolicy(cfg.Ingest.Spool.Fsync),
+			FsyncInterval: cfg.Ingest.Spool.FsyncInterval,
+			MaxBatch:      writerCfg.MaxBatch,
+			DrainInterval: cfg.Ingest.Spool.DrainInterval,
+			Metrics:       ingestMetrics,
+			Tracer:        tracer,
+		}, logger)
+	case cfg.Ingest.Shards > 1:
+		writer = ingest.NewShardedWriter(eventRepo, deadLetterRepo, writerCfg, cfg.Ingest.Shards, logger)
+	default:
+		writer = ingest.NewSingleWriter(eventRepo, deadLetterRepo, writerCfg, logger)
+	}
+	if err := writer.Start(); err != nil {
+		if partitions != nil {
+			partitions.Stop()
+		}
+		compactor.Stop()
+		pool.Close()
+		_ = tracer.Shutdown(context.Background())
+		return err
+	}
+	registerSinkMetrics(reg, writer)
+
+	health := httpserver.NewHealth(pool)
 
 	handler := httpserver.BuildHandler(httpserver.Config{
 		RequestTimeout: defaultDuration(cfg.HTTP.RequestTimeout, 3*time.Second),
-	}, logger, writer, eventRepo, metricsRepo)
+		Auth: httpserver.AuthConfig{
+			Enabled:      cfg.Auth.Enabled,
+			BootstrapKey: cfg.Auth.BootstrapKey,
+			CacheTTL:     cfg.Auth.CacheTTL,
+		},
+		RateLimit: httpserver.RateLimitConfig{
+			Ingest:  rateLimit(cfg.Rate.Ingest),
+			Metrics: rateLimit(cfg.Rate.Metrics),
+			Admin:   rateLimit(cfg.Rate.Admin),
+		},
+		Telemetry: reg,
+		Tracer:    tracer,
+		Health:    health,
+
+		MaxEventAge: cfg.Partitions.MaxEventAge,
+	}, logger, writer, eventRepo, metricsRepo, deadLetterRepo, apiKeyRepo)
+
+	switch {
+	case !cfg.Auth.Enabled:
+		logger.PrintInfo("auth disabled; every route is open (set AUTH_ENABLED=true to require API keys)", nil)
+	case cfg.Auth.BootstrapKey == "":
+		logger.PrintInfo("auth enabled without AUTH_BOOTSTRAP_KEY; only keys already in api_keys can authenticate", nil)
+	}
 
 	logger.PrintInfo("service started", map[string]string{
 		"version":    version,
 		"build_time": buildTime,
 	})
 
-	return httpserver.Serve(cfg.HTTP, logger, handler, func(ctx context.Context) error {
+	return httpserver.Serve(cfg.HTTP, logger, handler, health, func(ctx context.Context) error {
 		stopErr := writer.Stop(ctx)
+		if partitions != nil {
+			partitions.Stop()
+		}
+		compactor.Stop()
 		pool.Close()
+		// after the writer, so its last flush spans are exported
+		if err := tracer.Shutdown(ctx); err != nil {
+			logger.PrintError(err, map[string]string{"component": "tracer"})
+		}
 		if stopErr != nil && !errors.Is(stopErr, context.Canceled) && !errors.Is(stopErr, context.DeadlineExceeded) {
 			return stopErr
 		}
@@ -116,3 +212,61 @@ func defaultInt(v, def int) int {
 	}
 	return v
 }
+
+// newTracer returns nil (tracing off) for the "none" exporter.
+func newTracer(cfg config.TraceConfig, logger *jsonlog.Logger) (*telemetry.Tracer, error) {
+	var exp telemetry.Exporter
+	switch cfg.Exporter {
+	case "otlp":
+		exp = telemetry.NewOTLPExporter(cfg.OTLPEndpoint)
+	case "file":
+		f, err := telemetry.NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		exp = f
+	default:
+		return nil, nil
+	}
+	return telemetry.NewTracer(cfg.ServiceName, cfg.SampleRatio, exp, logger), nil
+}
+
+func rateLimit(rl config.RateLimit) httpserver.RateLimit {
+	return httpserver.RateLimit{Rate: float64(rl.Rate), Burst: rl.Burst}
+}
+
+// registerSinkMetrics exposes queue (writer) or backlog (spool) gauges.
+func registerSinkMetrics(reg *telemetry.Registry, sink ingest.Sink) {
+	if q, ok := sink.(interface{ QueueStats() (int, int) }); ok {
+		reg.NewGaugeFunc("ingest_queue_depth", "Requests waiting in the writer queue.", func() float64 {
+			d, _ := q.QueueStats()
+			return float64(d)
+		})
+		reg.NewGaugeFunc("ingest_queue_capacity", "Writer queue capacity.", func() float64 {
+			_, c := q.QueueStats()
+			return float64(c)
+		})
+	}
+	if b, ok := sink.(interface{ Batching() ingest.BatchingStats }); ok {
+		reg.NewGaugeFunc("ingest_batch_window_seconds", "Batch window in effect.", func() float64 {
+			return b.Batching().WindowMS / 1000
+		})
+		reg.NewGaugeFunc("ingest_max_batch", "Max batch size in effect.", func() float64 {
+			return float64(b.Batching().MaxBatch)
+		})
+		reg.NewGaugeFunc("ingest_arrival_rate", "Measured arrival rate (events/s).", func() float64 {
+			return b.Batching().ArrivalRate
+		})
+	}
+	if sp, ok := sink.(interface{ Depth() ingest.SpoolStats }); ok {
+		reg.NewGaugeFunc("ingest_spool_records", "Spooled records not yet committed.", func() float64 {
+			return float64(sp.Depth().Records)
+		})
+		reg.NewGaugeFunc("ingest_spool_bytes", "Spooled bytes not yet committed.", func() float64 {
+			return float64(sp.Depth().Bytes)
+		})
+		reg.NewGaugeFunc("ingest_spool_segments", "Spool segments on disk.", func() float64 {
+			return float64(sp.Depth().Segments)
+		})
+	}
+}
@@ -14,11 +14,20 @@ type Config struct {
 	HTTP   HTTPConfig
 	DB     DBConfig
 	Ingest IngestConfig
+	Auth   AuthConfig
+	Rate   RateLimitConfig
+	Trace  TraceConfig
+
+	Partitions PartitionConfig
+	Rollups    RollupConfig
 }
 
 type HTTPConfig struct {
 	Port           int
 	RequestTimeout time.Duration
+	// ShutdownDrainDelay is how long /readyz reports not ready before the
+	// writer is stopped, so load balancers drain this instance first.
+	ShutdownDrainDelay time.Duration
 }
 
 type DBConfig struct {
@@ -31,6 +40,63 @@ type DBConfig struct {
 	HealthCheckPeriod time.Duration
 
 	ConnectTimeout time.Duration
+
+	// InsertMode is "values" (multi-row INSERT) or "copy" (COPY into a staging table).
+	InsertMode string
+}
+
+type AuthConfig struct {
+	// Enabled is opt-in so an upgrade does not lock out clients that have
+	// no keys yet.
+	Enabled bool
+	// BootstrapKey is accepted with every scope (to create the first keys).
+	BootstrapKey string
+	CacheTTL     time.Duration
+}
+
+// RateLimitConfig holds per-route token buckets (tokens per second and burst),
+// keyed by API key or client IP. A rate of 0 disables that limit.
+type RateLimitConfig struct {
+	Ingest  RateLimit
+	Metrics RateLimit
+	Admin   RateLimit
+}
+
+type RateLimit struct {
+	Rate  int
+	Burst int
+}
+
+// TraceConfig selects where spans go: "none", "otlp" (OTLP/HTTP JSON to
+// OTLPEndpoint) or "file" (one JSON document per export appended to File).
+type TraceConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	File         string
+	SampleRatio  float64
+	ServiceName  string
+}
+
+// PartitionConfig drives the events partition manager. Several instances
+// may run it; passes are serialised in the database.
+type PartitionConfig struct {
+	Manager bool
+	// Interval is "day" or "month".
+	Interval string
+	// Premake is how many periods ahead partitions are created.
+	Premake int
+	// Retention drops partitions older than this; 0 keeps them forever.
+	Retention     time.Duration
+	CheckInterval time.Duration
+	// MaxEventAge is the oldest timestamp ingestion accepts; the manager
+	// keeps partitions back to it. 0 accepts any past timestamp, storing
+	// what no partition covers in the default partition.
+	MaxEventAge time.Duration
+}
+
+// RollupConfig drives the background compaction of event_rollup_minute.
+type RollupConfig struct {
+	CompactInterval time.Duration
 }
 
 type IngestConfig struct {
@@ -39,6 +105,36 @@ type IngestConfig struct {
 	MaxBatch int
 
 	QueueSize int
+
+	// Adaptive tunes the window and batch size at runtime within
+	// [MinBatchWindow, BatchWindow] and [MinBatch, MaxBatch].
+	Adaptive       bool
+	MinBatchWindow time.Duration
+	MinBatch       int
+
+	// Shards > 1 runs that many writers in parallel, keyed by dedup_key hash.
+	Shards int
+
+	Spool SpoolConfig
+
+	// AdmissionPolicy is "deadline" (reject when the estimated commit time
+	// exceeds the request's remaining deadline) or "off".
+	AdmissionPolicy  string
+	AdmissionMaxWait time.Duration
+}
+
+// SpoolConfig enables the local write-ahead spool when Dir is set.
+type SpoolConfig struct {
+	Dir string
+
+	SegmentBytes int64
+	MaxBytes     int64
+
+	// Fsync is one of "always", "interval", "never".
+	Fsync         string
+	FsyncInterval time.Duration
+
+	DrainInterval time.Duration
 }
 
 func Load() (Config, error) {
@@ -47,6 +143,7 @@ func Load() (Config, error) {
 	// HTTP
 	cfg.HTTP.Port = envInt("PORT", 8080)
 	cfg.HTTP.RequestTimeout = envDuration("REQUEST_TIMEOUT", 200*time.Millisecond)
+	cfg.HTTP.ShutdownDrainDelay = envDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second)
 
 	// DB
 	cfg.DB.DatabaseURL = os.Getenv("DATABASE_URL")
@@ -60,10 +157,53 @@ func Load() (Config, error) {
 	cfg.DB.MaxConnLifetime = envDuration("DB_MAX_CONN_LIFETIME", 30*time.Minute)
 	cfg.DB.HealthCheckPeriod = envDuration("DB_HEALTHCHECK_PERIOD", 30*time.Second)
 	cfg.DB.ConnectTimeout = envDuration("DB_CONNECT_TIMEOUT", 3*time.Second)
+	cfg.DB.InsertMode = envString("DB_INSERT_MODE", "values")
 
 	cfg.Ingest.BatchWindow = envDuration("WRITER_BATCH_WINDOW", 500*time.Millisecond)
 	cfg.Ingest.MaxBatch = envInt("WRITER_MAX_BATCH", 800)
 	cfg.Ingest.QueueSize = envInt("WRITER_QUEUE_SIZE", 50000)
+	cfg.Ingest.Shards = envInt("WRITER_SHARDS", 1)
+	cfg.Ingest.Adaptive = envBool("WRITER_ADAPTIVE", false)
+	cfg.Ingest.MinBatchWindow = envDuration("WRITER_MIN_BATCH_WINDOW", 0)
+	cfg.Ingest.MinBatch = envInt("WRITER_MIN_BATCH", 1)
+	cfg.Ingest.AdmissionPolicy = envString("ADMISSION_POLICY", "deadline")
+	cfg.Ingest.AdmissionMaxWait = envDuration("ADMISSION_MAX_WAIT", 0)
+
+	cfg.Ingest.Spool.Dir = os.Getenv("SPOOL_DIR")
+	cfg.Ingest.Spool.SegmentBytes = int64(envInt("SPOOL_SEGMENT_BYTES", 64<<20))
+	cfg.Ingest.Spool.MaxBytes = int64(envInt("SPOOL_MAX_BYTES", 1<<30))
+	cfg.Ingest.Spool.Fsync = envString("SPOOL_FSYNC", "always")
+	cfg.Ingest.Spool.FsyncInterval = envDuration("SPOOL_FSYNC_INTERVAL", 100*time.Millisecond)
+	cfg.Ingest.Spool.DrainInterval = envDuration("SPOOL_DRAIN_INTERVAL", 200*time.Millisecond)
+
+	// Auth
+	cfg.Auth.Enabled = envBool("AUTH_ENABLED", false)
+	cfg.Auth.BootstrapKey = os.Getenv("AUTH_BOOTSTRAP_KEY")
+	cfg.Auth.CacheTTL = envDuration("AUTH_CACHE_TTL", 30*time.Second)
+
+	// Rate limits (ingest counts events, not requests)
+	cfg.Rate.Ingest = RateLimit{Rate: envInt("RATE_LIMIT_INGEST_RATE", 2000), Burst: envInt("RATE_LIMIT_INGEST_BURST", 10000)}
+	cfg.Rate.Metrics = RateLimit{Rate: envInt("RATE_LIMIT_METRICS_RATE", 20), Burst: envInt("RATE_LIMIT_METRICS_BURST", 40)}
+	cfg.Rate.Admin = RateLimit{Rate: envInt("RATE_LIMIT_ADMIN_RATE", 10), Burst: envInt("RATE_LIMIT_ADMIN_BURST", 20)}
+
+	// Tracing
+	cfg.Trace.Exporter = envString("TRACE_EXPORTER", "none")
+	cfg.Trace.OTLPEndpoint = envString("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	cfg.Trace.File = envString("TRACE_FILE", "traces.jsonl")
+	cfg.Trace.SampleRatio = envFloat("TRACE_SAMPLE_RATIO", 1)
+	cfg.Trace.ServiceName = envString("OTEL_SERVICE_NAME", "event-ingest")
+
+	// Partitions
+	cfg.Partitions.Manager = envBool("EVENTS_PARTITION_MANAGER", true)
+	cfg.Partitions.Interval = envString("EVENTS_PARTITION_INTERVAL", "day")
+	cfg.Partitions.Premake = envInt("EVENTS_PARTITION_PREMAKE", 7)
+	cfg.Partitions.Retention = envDuration("EVENTS_RETENTION", 0)
+	cfg.Partitions.CheckInterval = envDuration("EVENTS_PARTITION_CHECK_INTERVAL", time.Hour)
+	// No age limit unless retention would delete the events anyway.
+	cfg.Partitions.MaxEventAge = envDuration("EVENTS_MAX_AGE", cfg.Partitions.Retention)
+
+	// Rollups
+	cfg.Rollups.CompactInterval = envDuration("ROLLUP_COMPACT_INTERVAL", time.Minute)
 
 	if err := validate(cfg); err != nil {
 		return Config{}, err
@@ -81,6 +221,10 @@ func validate(cfg Config) error {
 		return fmt.Errorf("REQUEST_TIMEOUT must be > 0 (got %s)", cfg.HTTP.RequestTimeout)
 	}
 
+	if cfg.HTTP.ShutdownDrainDelay < 0 {
+		return fmt.Errorf("SHUTDOWN_DRAIN_DELAY must be >= 0 (got %s)", cfg.HTTP.ShutdownDrainDelay)
+	}
+
 	// DB
 	if cfg.DB.MaxConns <= 0 {
 		return fmt.Errorf("DB_MAX_CONNS must be > 0 (got %d)", cfg.DB.MaxConns)
@@ -103,6 +247,11 @@ func validate(cfg Config) error {
 	if cfg.DB.ConnectTimeout <= 0 {
 		return fmt.Errorf("DB_CONNECT_TIMEOUT must be > 0 (got %s)", cfg.DB.ConnectTimeout)
 	}
+	switch cfg.DB.InsertMode {
+	case "values", "copy":
+	default:
+		return fmt.Errorf("DB_INSERT_MODE must be one of values, copy (got %q)", cfg.DB.InsertMode)
+	}
 
 	// Ingest
 	if cfg.Ingest.BatchWindow <= 0 {
@@ -114,9 +263,146 @@ func validate(cfg Config) error {
 	if cfg.Ingest.QueueSize <= 0 {
 		return fmt.Errorf("WRITER_QUEUE_SIZE must be > 0 (got %d)", cfg.Ingest.QueueSize)
 	}
+	if cfg.Ingest.Shards <= 0 {
+		return fmt.Errorf("WRITER_SHARDS must be > 0 (got %d)", cfg.Ingest.Shards)
+	}
+	if cfg.Ingest.Shards > cfg.Ingest.QueueSize {
+		return fmt.Errorf("WRITER_SHARDS must be <= WRITER_QUEUE_SIZE (shards=%d queue=%d)", cfg.Ingest.Shards, cfg.Ingest.QueueSize)
+	}
+
+	if cfg.Ingest.Adaptive {
+		if cfg.Ingest.MinBatchWindow < 0 || cfg.Ingest.MinBatchWindow > cfg.Ingest.BatchWindow {
+			return fmt.Errorf("WRITER_MIN_BATCH_WINDOW must be between 0 and WRITER_BATCH_WINDOW (got %s)", cfg.Ingest.MinBatchWindow)
+		}
+		if cfg.Ingest.MinBatch <= 0 || cfg.Ingest.MinBatch > cfg.Ingest.MaxBatch {
+			return fmt.Errorf("WRITER_MIN_BATCH must be between 1 and WRITER_MAX_BATCH (got %d)", cfg.Ingest.MinBatch)
+		}
+	}
+	switch cfg.Ingest.AdmissionPolicy {
+	case "deadline", "off":
+	default:
+		return fmt.Errorf("ADMISSION_POLICY must be one of deadline, off (got %q)", cfg.Ingest.AdmissionPolicy)
+	}
+	if cfg.Ingest.AdmissionMaxWait < 0 {
+		return fmt.Errorf("ADMISSION_MAX_WAIT must be >= 0 (got %s)", cfg.Ingest.AdmissionMaxWait)
+	}
+
+	// Auth
+	if cfg.Auth.Enabled && cfg.Auth.CacheTTL <= 0 {
+		return fmt.Errorf("AUTH_CACHE_TTL must be > 0 (got %s)", cfg.Auth.CacheTTL)
+	}
+	if cfg.Auth.BootstrapKey != "" && len(cfg.Auth.BootstrapKey) < 16 {
+		return errors.New("AUTH_BOOTSTRAP_KEY must be at least 16 characters")
+	}
+
+	// Rate limits
+	for _, rl := range []struct {
+		name string
+		RateLimit
+	}{
+		{"INGEST", cfg.Rate.Ingest},
+		{"METRICS", cfg.Rate.Metrics},
+		{"ADMIN", cfg.Rate.Admin},
+	} {
+		if rl.Rate < 0 {
+			return fmt.Errorf("RATE_LIMIT_%s_RATE must be >= 0 (got %d)", rl.name, rl.Rate)
+		}
+		if rl.Rate > 0 && rl.Burst <= 0 {
+			return fmt.Errorf("RATE_LIMIT_%s_BURST must be > 0 (got %d)", rl.name, rl.Burst)
+		}
+	}
+
+	// Tracing
+	switch cfg.Trace.Exporter {
+	case "none", "otlp", "file":
+	default:
+		return fmt.Errorf("TRACE_EXPORTER must be one of none, otlp, file (got %q)", cfg.Trace.Exporter)
+	}
+	if cfg.Trace.SampleRatio < 0 || cfg.Trace.SampleRatio > 1 {
+		return fmt.Errorf("TRACE_SAMPLE_RATIO must be between 0 and 1 (got %g)", cfg.Trace.SampleRatio)
+	}
+
+	// Partitions (only validated when the manager runs)
+	if cfg.Partitions.MaxEventAge < 0 {
+		return fmt.Errorf("EVENTS_MAX_AGE must be >= 0 (got %s)", cfg.Partitions.MaxEventAge)
+	}
+	if cfg.Partitions.Manager {
+		pc := cfg.Partitions
+		switch pc.Interval {
+		case "day", "month":
+		default:
+			return fmt.Errorf("EVENTS_PARTITION_INTERVAL must be one of day, month (got %q)", pc.Interval)
+		}
+		if pc.Premake < 1 {
+			return fmt.Errorf("EVENTS_PARTITION_PREMAKE must be >= 1 (got %d)", pc.Premake)
+		}
+		if pc.Retention < 0 {
+			return fmt.Errorf("EVENTS_RETENTION must be >= 0 (got %s)", pc.Retention)
+		}
+		if pc.CheckInterval <= 0 {
+			return fmt.Errorf("EVENTS_PARTITION_CHECK_INTERVAL must be > 0 (got %s)", pc.CheckInterval)
+		}
+		// Retention never drops the default partition, so older events
+		// would be kept forever.
+		if pc.Retention > 0 && (pc.MaxEventAge == 0 || pc.MaxEventAge > pc.Retention) {
+			return fmt.Errorf("EVENTS_MAX_AGE must be > 0 and <= EVENTS_RETENTION when retention is set (max_age=%s retention=%s)", pc.MaxEventAge, pc.Retention)
+		}
+	}
+
+	// Rollups
+	if cfg.Rollups.CompactInterval <= 0 {
+		return fmt.Errorf("ROLLUP_COMPACT_INTERVAL must be > 0 (got %s)", cfg.Rollups.CompactInterval)
+	}
+
+	// Spool (only validated when enabled)
+	if cfg.Ingest.Spool.Dir != "" {
+		sp := cfg.Ingest.Spool
+		// The spool drains through one writer; shards would be ignored.
+		if cfg.Ingest.Shards > 1 {
+			return fmt.Errorf("WRITER_SHARDS must be 1 when SPOOL_DIR is set (got %d)", cfg.Ingest.Shards)
+		}
+		if sp.SegmentBytes <= 0 {
+			return fmt.Errorf("SPOOL_SEGMENT_BYTES must be > 0 (got %d)", sp.SegmentBytes)
+		}
+		if sp.MaxBytes < sp.SegmentBytes {
+			return fmt.Errorf("SPOOL_MAX_BYTES must be >= SPOOL_SEGMENT_BYTES (max=%d segment=%d)", sp.MaxBytes, sp.SegmentBytes)
+		}
+		switch sp.Fsync {
+		case "always", "interval", "never":
+		default:
+			return fmt.Errorf("SPOOL_FSYNC must be one of always, interval, never (got %q)", sp.Fsync)
+		}
+		if sp.FsyncInterval <= 0 {
+			return fmt.Errorf("SPOOL_FSYNC_INTERVAL must be > 0 (got %s)", sp.FsyncInterval)
+		}
+		if sp.DrainInterval <= 0 {
+			return fmt.Errorf("SPOOL_DRAIN_INTERVAL must be > 0 (got %s)", sp.DrainInterval)
+		}
+	}
 	return nil
 }
 
+func envString(key string, defaultVal string) string {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	return val
+}
+
+// it panics if the value is set but invalid
+func envBool(key string, defaultVal bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		panic(fmt.Sprintf("%s must be a boolean (got %q)", key, val))
+	}
+	return b
+}
+
 // it panics if the value is set but invalid
 func envInt(key string, defaultVal int) int {
 	val := os.Getenv(key)
@@ -130,6 +416,19 @@ func envInt(key string, defaultVal int) int {
 	return n
 }
 
+// it panics if the value is set but invalid
+func envFloat(key string, defaultVal float64) float64 {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		panic(fmt.Sprintf("%s must be a number (got %q)", key, val))
+	}
+	return f
+}
+
 // TODO: Add validation for the duration
 // e.g. 200ms", "2s", "1m"
 func envDuration(key string, defaultVal time.Duration) time.Duration {
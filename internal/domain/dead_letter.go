@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	DeadLetterPending  = "pending"
+	DeadLetterReplayed = "replayed"
+)
+
+// DeadLetter is an event that could not be persisted, kept so it can be
+// inspected and re-driven later.
+type DeadLetter struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Component string `json:"component"`
+	RequestID string `json:"request_id,omitempty"`
+	DedupKey  string `json:"dedup_key"`
+	Error     string `json:"error"`
+
+	// Payload is the client payload as received (nil when not available).
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Event   Event           `json:"event"`
+
+	Status          string     `json:"status"`
+	ReplayAttempts  int        `json:"replay_attempts"`
+	LastReplayError string     `json:"last_replay_error,omitempty"`
+	ReplayedAt      *time.Time `json:"replayed_at,omitempty"`
+}
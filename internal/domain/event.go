@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sort"
 	"strconv"
 	"strings"
@@ -22,17 +23,26 @@ type EventPayload struct {
 }
 
 type Event struct {
-	DedupKey   string
-	EventName  string
-	Channel    string
-	CampaignID string
-	UserID     string
-	Timestamp  time.Time
-	Tags       []string
-	Metadata   json.RawMessage
+	DedupKey   string          `json:"dedup_key"`
+	EventName  string          `json:"event_name"`
+	Channel    string          `json:"channel"`
+	CampaignID string          `json:"campaign_id,omitempty"`
+	UserID     string          `json:"user_id"`
+	Timestamp  time.Time       `json:"ts"`
+	Tags       []string        `json:"tags"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
 }
 
-func (p *EventPayload) Validate(now time.Time) error {
+// StoredEvent is an event as read back from the events table.
+type StoredEvent struct {
+	ID int64 `json:"id"`
+	Event
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks p against now. maxAge > 0 rejects timestamps older than
+// now minus maxAge (the oldest events the database has partitions for).
+func (p *EventPayload) Validate(now time.Time, maxAge time.Duration) error {
 	now = now.UTC()
 
 	if strings.TrimSpace(p.EventName) == "" {
@@ -57,6 +67,9 @@ func (p *EventPayload) Validate(now time.Time) error {
 	if ts.After(now.Add(maxFutureSkew)) {
 		return errors.New("timestamp must not be in the future")
 	}
+	if maxAge > 0 && ts.Before(now.Add(-maxAge)) {
+		return fmt.Errorf("timestamp must not be older than %s", maxAge)
+	}
 
 	if len(p.Metadata) != 0 && !json.Valid(p.Metadata) {
 		return errors.New("metadata must be valid JSON")
@@ -0,0 +1,168 @@
+// Package hll is a HyperLogLog distinct counter whose sketches can be stored
+// as bytes and merged (register-wise max), e.g. per rollup bucket.
+//
+// Items are hashed with the first 8 bytes of MD5 (big-endian) so sketches can
+// also be built in SQL from md5(); migrations/007_rollup_hll.sql does that to
+// backfill, and must stay in sync with Add and the encoding below.
+package hll
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits used as register index.
+	Precision = 14
+	registers = 1 << Precision
+
+	// RelativeStdError is the asymptotic relative standard error of
+	// Estimate, 1.04/sqrt(registers). It does not depend on the count; in
+	// the linear counting range (up to about 2.5 * registers) the actual
+	// error is smaller.
+	RelativeStdError = 1.04 / 128
+)
+
+// Encoding: a format byte, the precision, then either
+//   - sparse: (index uint16 big-endian, rank uint8) per non-zero register,
+//     in index order;
+//   - dense: one rank byte per register.
+//
+// Marshal picks the smaller one.
+const (
+	formatSparse = 1
+	formatDense  = 2
+
+	headerLen      = 2
+	sparseEntryLen = 3
+)
+
+var ErrInvalid = errors.New("hll: invalid sketch")
+
+// Sketch is the in-memory (dense) form. The zero value is not usable; use New.
+type Sketch struct {
+	regs []uint8
+}
+
+func New() *Sketch {
+	return &Sketch{regs: make([]uint8, registers)}
+}
+
+// Add records item and reports whether the sketch changed.
+func (s *Sketch) Add(item string) bool {
+	sum := md5.Sum([]byte(item))
+	idx, rank := register(binary.BigEndian.Uint64(sum[:8]))
+
+	if rank <= s.regs[idx] {
+		return false
+	}
+	s.regs[idx] = rank
+	return true
+}
+
+// register maps a hash to its register: the top Precision bits are the
+// index, and the rank is the leading zeros of the remaining 64-Precision
+// bits + 1, at most 64-Precision+1 when they are all zero (the sentinel bit
+// stops the count).
+func register(h uint64) (idx uint64, rank uint8) {
+	return h >> (64 - Precision), uint8(bits.LeadingZeros64(h<<Precision|1<<(Precision-1))) + 1
+}
+
+func (s *Sketch) Merge(o *Sketch) {
+	for i, r := range o.regs {
+		s.regs[i] = max(s.regs[i], r)
+	}
+}
+
+// MergeBytes merges an encoded sketch without allocating a Sketch for it.
+func (s *Sketch) MergeBytes(b []byte) error {
+	if len(b) < headerLen || b[1] != Precision {
+		return ErrInvalid
+	}
+	body := b[headerLen:]
+
+	switch b[0] {
+	case formatDense:
+		if len(body) != registers {
+			return ErrInvalid
+		}
+		for i, r := range body {
+			s.regs[i] = max(s.regs[i], r)
+		}
+	case formatSparse:
+		if len(body)%sparseEntryLen != 0 {
+			return ErrInvalid
+		}
+		for i := 0; i < len(body); i += sparseEntryLen {
+			idx := binary.BigEndian.Uint16(body[i:])
+			if int(idx) >= registers {
+				return ErrInvalid
+			}
+			s.regs[idx] = max(s.regs[idx], body[i+2])
+		}
+	default:
+		return ErrInvalid
+	}
+	return nil
+}
+
+func Unmarshal(b []byte) (*Sketch, error) {
+	s := New()
+	if err := s.MergeBytes(b); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Sketch) Marshal() []byte {
+	var n int
+	for _, r := range s.regs {
+		if r != 0 {
+			n++
+		}
+	}
+
+	if n*sparseEntryLen >= registers {
+		out := make([]byte, headerLen, headerLen+registers)
+		out[0], out[1] = formatDense, Precision
+		return append(out, s.regs...)
+	}
+
+	out := make([]byte, headerLen, headerLen+n*sparseEntryLen)
+	out[0], out[1] = formatSparse, Precision
+	for i, r := range s.regs {
+		if r != 0 {
+			out = binary.BigEndian.AppendUint16(out, uint16(i))
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Estimate returns the estimated number of distinct items, using linear
+// counting while there are empty registers and the raw estimate is small.
+// With 64-bit hashes no large-range correction is needed.
+func (s *Sketch) Estimate() int64 {
+	const m = float64(registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, r := range s.regs {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(e))
+}
@@ -0,0 +1,156 @@
+package hll
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func sketchOf(n int, prefix string) *Sketch {
+	s := New()
+	for i := range n {
+		s.Add(prefix + strconv.Itoa(i))
+	}
+	return s
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 5000, 100_000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			s := sketchOf(n, "u")
+			b := s.Marshal()
+
+			got, err := Unmarshal(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.regs, s.regs) {
+				t.Fatal("registers differ after Unmarshal")
+			}
+			if got.Estimate() != s.Estimate() {
+				t.Fatalf("estimate %d after round trip, want %d", got.Estimate(), s.Estimate())
+			}
+			if !bytes.Equal(got.Marshal(), b) {
+				t.Fatal("encoding is not stable")
+			}
+		})
+	}
+}
+
+func TestMergeBytes(t *testing.T) {
+	a, b := sketchOf(3000, "a"), sketchOf(50_000, "b") // sparse, dense
+	union := sketchOf(3000, "a")
+	for i := range 50_000 {
+		union.Add("b" + strconv.Itoa(i))
+	}
+
+	for _, order := range [][]*Sketch{{a, b}, {b, a}} {
+		got := New()
+		for _, s := range order {
+			if err := got.MergeBytes(s.Marshal()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !slices.Equal(got.regs, union.regs) {
+			t.Fatal("merged registers differ from the sketch of the union")
+		}
+	}
+
+	// Merge and MergeBytes agree, and merging is idempotent.
+	got := New()
+	got.Merge(a)
+	got.Merge(b)
+	got.Merge(b)
+	if !slices.Equal(got.regs, union.regs) {
+		t.Fatal("Merge differs from the sketch of the union")
+	}
+}
+
+func TestSparseDenseSwitch(t *testing.T) {
+	// Sparse while it is smaller than dense: n*3 < registers.
+	threshold := (registers + sparseEntryLen - 1) / sparseEntryLen
+
+	for _, tt := range []struct {
+		nonZero int
+		format  byte
+		size    int
+	}{
+		{0, formatSparse, headerLen},
+		{1, formatSparse, headerLen + sparseEntryLen},
+		{threshold - 1, formatSparse, headerLen + (threshold-1)*sparseEntryLen},
+		{threshold, formatDense, headerLen + registers},
+		{registers, formatDense, headerLen + registers},
+	} {
+		t.Run(strconv.Itoa(tt.nonZero), func(t *testing.T) {
+			s := New()
+			// Spread over the whole index range, with ranks up to the max.
+			for i := range tt.nonZero {
+				idx := i * registers / max(tt.nonZero, 1)
+				s.regs[idx] = uint8(i%(64-Precision+1) + 1)
+			}
+			b := s.Marshal()
+			if b[0] != tt.format || len(b) != tt.size {
+				t.Fatalf("format %d, %d bytes; want format %d, %d bytes", b[0], len(b), tt.format, tt.size)
+			}
+			if tt.format == formatSparse && tt.nonZero > 0 && len(b) >= headerLen+registers {
+				t.Fatal("sparse encoding is not smaller than dense")
+			}
+			got, err := Unmarshal(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.regs, s.regs) {
+				t.Fatal("registers differ after Unmarshal")
+			}
+		})
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	dense := append([]byte{formatDense, Precision}, make([]byte, registers)...)
+	for name, b := range map[string][]byte{
+		"empty":              nil,
+		"header only":        {formatSparse},
+		"wrong precision":    {formatSparse, 12},
+		"unknown format":     {3, Precision},
+		"short dense":        dense[:len(dense)-1],
+		"truncated sparse":   {formatSparse, Precision, 0, 1},
+		"index out of range": {formatSparse, Precision, 0x40, 0x00, 1},
+	} {
+		if _, err := Unmarshal(b); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: err = %v, want ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestEstimateError(t *testing.T) {
+	// Items are deterministic, so this is one fixed draw per cardinality;
+	// 3 standard errors leaves room for it. The small ones are in the
+	// linear counting range, which is far more accurate.
+	for _, tt := range []struct {
+		n      int
+		maxErr float64
+	}{
+		{1, 0},
+		{10, 0},
+		{100, 0.01},
+		{1000, 0.01},
+		{10_000, 3 * RelativeStdError},
+		{40_000, 3 * RelativeStdError},
+		{100_000, 3 * RelativeStdError},
+		{1_000_000, 3 * RelativeStdError},
+	} {
+		t.Run(strconv.Itoa(tt.n), func(t *testing.T) {
+			if tt.n >= 1_000_000 && testing.Short() {
+				t.Skip("short")
+			}
+			got := sketchOf(tt.n, "user-").Estimate()
+			if e := math.Abs(float64(got)-float64(tt.n)) / float64(tt.n); e > tt.maxErr {
+				t.Fatalf("estimate %d for %d: relative error %.4f > %.4f", got, tt.n, e, tt.maxErr)
+			}
+		})
+	}
+}
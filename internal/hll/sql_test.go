@@ -0,0 +1,145 @@
+package hll
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The backfill in migrations/007_rollup_hll.sql builds sketches in SQL. These
+// tests mirror its expressions one by one and check them against Add and
+// Marshal; sqlExprs pins the mirrored expressions to the migration text.
+const migration007 = "../../migrations/007_rollup_hll.sql"
+
+var sqlExprs = []string{
+	`('x' || left(md5(user_id), 16))::bit(64)::bigint AS h`,
+	`(h >> 50) & 16383 AS idx`,
+	`CASE WHEN h & 1125899906842623 = 0 THEN 51`,
+	`ELSE position('1' IN (h & 1125899906842623)::bit(64)::text) - 14`,
+	`'\x010e'::bytea || string_agg(int2send(idx::int2) || set_byte('\x00'::bytea, 0, rank), ''::bytea ORDER BY idx)`,
+}
+
+// sqlHash mirrors ('x' || left(md5(user_id), 16))::bit(64)::bigint.
+func sqlHash(userID string) int64 {
+	sum := md5.Sum([]byte(userID))
+	u, err := strconv.ParseUint(hex.EncodeToString(sum[:])[:16], 16, 64)
+	if err != nil {
+		panic(err)
+	}
+	return int64(u) // bit(64)::bigint keeps the bits, two's complement
+}
+
+// sqlRegister mirrors the idx and rank columns. >> on bigint is arithmetic,
+// hence the mask.
+func sqlRegister(h int64) (idx, rank int64) {
+	idx = (h >> 50) & 16383
+	low := h & 1125899906842623
+	if low == 0 {
+		return idx, 51
+	}
+	text := fmt.Sprintf("%064b", uint64(low)) // ::bit(64)::text
+	return idx, int64(strings.IndexByte(text, '1')+1) - 14
+}
+
+// sqlSparse mirrors the users_hll column: MAX(rank) per idx, then the
+// header and one (int2send(idx), rank byte) per register in idx order.
+func sqlSparse(userIDs []string) []byte {
+	ranks := make(map[int64]int64)
+	for _, id := range userIDs {
+		idx, rank := sqlRegister(sqlHash(id))
+		ranks[idx] = max(ranks[idx], rank)
+	}
+	idxs := make([]int64, 0, len(ranks))
+	for idx := range ranks {
+		idxs = append(idxs, idx)
+	}
+	slices.Sort(idxs)
+
+	out := []byte{0x01, 0x0e}
+	for _, idx := range idxs {
+		out = binary.BigEndian.AppendUint16(out, uint16(int16(idx)))
+		out = append(out, byte(ranks[idx]))
+	}
+	return out
+}
+
+func TestSQLExpressionsInMigration(t *testing.T) {
+	b, err := os.ReadFile(migration007)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := string(b)
+	for _, e := range sqlExprs {
+		if !strings.Contains(sql, e) {
+			t.Errorf("%s no longer contains %q; update the mirror in this test and hll.Add together", migration007, e)
+		}
+	}
+	if formatSparse != 0x01 || Precision != 0x0e {
+		t.Errorf("sparse header is %#x %#x, the migration writes 0x01 0x0e", formatSparse, Precision)
+	}
+}
+
+func TestSQLRegisterMatchesAdd(t *testing.T) {
+	// Hashes at the edges of the rank range, including all-zero low bits.
+	hashes := []uint64{
+		0,
+		1,
+		1 << 49,
+		1<<50 - 1,
+		1 << 50,
+		1 << 63,
+		1<<63 | 1,
+		1<<64 - 1,
+		0xffffc00000000000,
+		0x0003ffffffffffff,
+	}
+	for i := range 50 {
+		hashes = append(hashes, 1<<i, 1<<63|1<<i)
+	}
+	for _, h := range hashes {
+		idx, rank := register(h)
+		sqlIdx, sqlRank := sqlRegister(int64(h))
+		if int64(idx) != sqlIdx || int64(rank) != sqlRank {
+			t.Errorf("hash %#016x: Add (idx %d, rank %d), SQL (idx %d, rank %d)", h, idx, rank, sqlIdx, sqlRank)
+		}
+	}
+
+	for i := range 100_000 {
+		id := "user-" + strconv.Itoa(i)
+		sum := md5.Sum([]byte(id))
+		if h := binary.BigEndian.Uint64(sum[:8]); int64(h) != sqlHash(id) {
+			t.Fatalf("%s: hash %#x, SQL %#x", id, h, sqlHash(id))
+		}
+
+		s := New()
+		s.Add(id)
+		idx, rank := sqlRegister(sqlHash(id))
+		if s.regs[idx] != uint8(rank) {
+			t.Fatalf("%s: SQL sets register %d to %d, Add sets it to %d", id, idx, rank, s.regs[idx])
+		}
+	}
+}
+
+func TestSQLSparseMatchesMarshal(t *testing.T) {
+	for _, n := range []int{1, 2, 100, 3000, 5000} {
+		ids := make([]string, n)
+		s := New()
+		for i := range ids {
+			ids[i] = "u" + strconv.Itoa(i)
+			s.Add(ids[i])
+		}
+		b := s.Marshal()
+		if b[0] != formatSparse {
+			t.Fatalf("%d users: Marshal chose format %d", n, b[0])
+		}
+		if got := sqlSparse(ids); !slices.Equal(got, b) {
+			t.Fatalf("%d users: SQL encoding differs from Marshal", n)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/httpserver/middleware"
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// GET  /admin/api-keys  lists keys (never the secrets)
+// POST /admin/api-keys  creates a key; the plaintext is returned only once
+func (h *Handler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listAPIKeys(w, r)
+	case http.MethodPost:
+		h.createAPIKey(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *Handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeys.List(r.Context())
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "list_api_keys",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if keys == nil {
+		keys = []domain.APIKey{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"api_keys": keys})
+}
+
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "scopes is required")
+		return
+	}
+	seen := make(map[string]struct{}, len(req.Scopes))
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		s = strings.TrimSpace(s)
+		if !domain.ValidScope(s) {
+			writeError(w, http.StatusBadRequest, "unknown scope "+strconv.Quote(s)+" (allowed: "+strings.Join(domain.AllScopes, ", ")+")")
+			return
+		}
+		if _, dup := seen[s]; dup {
+			continue
+		}
+		seen[s] = struct{}{}
+		scopes = append(scopes, s)
+	}
+
+	plain, hash, prefix, err := domain.NewAPIKeySecret()
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "create_api_key",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	k, err := h.apiKeys.Create(r.Context(), req.Name, prefix, hash, scopes)
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "create_api_key",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"api_key": k,
+		"key":     plain,
+	})
+}
+
+// POST /admin/api-keys/{id}/revoke
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	if err := h.apiKeys.Revoke(r.Context(), id); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "active api key not found")
+			return
+		}
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "revoke_api_key",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if h.keyCache != nil {
+		h.keyCache.Forget(id)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": "revoked"})
+}
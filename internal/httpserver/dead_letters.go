@@ -0,0 +1,292 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/httpserver/middleware"
+	"github.com/cun0/insider-case/internal/ingest"
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+const (
+	defaultDeadLetterLimit = 100
+	maxDeadLetterLimit     = 1000
+
+	// replayConcurrency bounds the replays in flight, so a bulk replay shares
+	// writer batches instead of waiting out one batch window per letter.
+	replayConcurrency = 64
+
+	deadLetterBookkeepingTimeout = 2 * time.Second
+)
+
+// GET /admin/dead-letters?status=pending&before_id=&after_id=&limit=
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	f, err := parseDeadLetterFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	letters, err := h.deadLetters.List(r.Context(), f)
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "list_dead_letters",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := map[string]any{
+		"dead_letters": letters,
+	}
+	if len(letters) == f.Limit {
+		resp["next_before_id"] = letters[len(letters)-1].ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GET /admin/dead-letters/{id}
+func (h *Handler) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	dl, err := h.deadLetters.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "dead letter not found")
+			return
+		}
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "get_dead_letter",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dl)
+}
+
+// POST /admin/dead-letters/{id}/replay
+func (h *Handler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	dl, err := h.deadLetters.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "dead letter not found")
+			return
+		}
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "replay_dead_letter",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if dl.Status == domain.DeadLetterReplayed {
+		writeError(w, http.StatusConflict, "dead letter already replayed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.replayDeadLetter(r, dl))
+}
+
+// POST /admin/dead-letters/replay?after_id=&limit=
+// Re-drives the oldest pending dead letters concurrently until limit or the
+// request deadline is reached. last_id is the highest id of the replayed
+// prefix; pass it as after_id to resume past letters that failed again.
+func (h *Handler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	f, err := parseDeadLetterFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f.Status = domain.DeadLetterPending
+	f.OldestFirst = true
+
+	letters, err := h.deadLetters.List(r.Context(), f)
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "replay_dead_letters",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	// Letters are started in id order and none after the deadline, so the
+	// ones started are a prefix of letters.
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, replayConcurrency)
+		results = make([]deadLetterReplay, len(letters))
+		started = 0
+	)
+	for i, dl := range letters {
+		select {
+		case sem <- struct{}{}:
+		case <-r.Context().Done():
+		}
+		if r.Context().Err() != nil {
+			break
+		}
+		started++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = h.replayDeadLetter(r, dl)
+		}()
+	}
+	wg.Wait()
+	results = results[:started]
+
+	replayed, failed := 0, 0
+	for _, res := range results {
+		if res.Error == "" {
+			replayed++
+		} else {
+			failed++
+		}
+	}
+
+	resp := map[string]any{
+		"selected": len(letters),
+		"replayed": replayed,
+		"failed":   failed,
+		"results":  results,
+	}
+	if started > 0 {
+		resp["last_id"] = letters[started-1].ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type deadLetterReplay struct {
+	ID       int64  `json:"id"`
+	DedupKey string `json:"dedup_key"`
+	Status   string `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// replayDeadLetter submits the stored event through the normal sink and
+// records the outcome on the dead letter row.
+func (h *Handler) replayDeadLetter(r *http.Request, dl domain.DeadLetter) deadLetterReplay {
+	out := deadLetterReplay{ID: dl.ID, DedupKey: dl.DedupKey}
+
+	ctx := ingest.WithRequestMeta(r.Context(), ingest.RequestMeta{
+		RequestID:    middleware.GetRequestID(r.Context()),
+		Payload:      dl.Payload,
+		DeadLetterID: dl.ID,
+	})
+
+	res, err := h.ingest.Submit(ctx, dl.Event)
+
+	// Bookkeeping must survive an expired request context.
+	bctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), deadLetterBookkeepingTimeout)
+	defer cancel()
+
+	if err != nil {
+		out.Error = err.Error()
+		if markErr := h.deadLetters.MarkReplayFailed(bctx, dl.ID, err.Error()); markErr != nil {
+			h.logger.PrintError(markErr, map[string]string{
+				"request_id": middleware.GetRequestID(r.Context()),
+				"component":  "replay_dead_letter",
+			})
+		}
+		return out
+	}
+
+	switch {
+	case res.Accepted():
+		out.Status = "accepted"
+	case res.Duplicate():
+		out.Status = "duplicate"
+	default:
+		out.Status = "inserted"
+	}
+
+	if markErr := h.deadLetters.MarkReplayed(bctx, dl.ID); markErr != nil {
+		h.logger.PrintError(markErr, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "replay_dead_letter",
+		})
+	}
+	return out
+}
+
+func parseDeadLetterFilter(r *http.Request) (repo.DeadLetterFilter, error) {
+	q := r.URL.Query()
+
+	f := repo.DeadLetterFilter{
+		Status: strings.TrimSpace(q.Get("status")),
+		Limit:  defaultDeadLetterLimit,
+	}
+	switch f.Status {
+	case "", domain.DeadLetterPending, domain.DeadLetterReplayed:
+	default:
+		return f, errors.New("status must be pending or replayed")
+	}
+
+	if v := strings.TrimSpace(q.Get("before_id")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return f, errors.New("invalid before_id")
+		}
+		f.BeforeID = id
+	}
+
+	if v := strings.TrimSpace(q.Get("after_id")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return f, errors.New("invalid after_id")
+		}
+		f.AfterID = id
+	}
+
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxDeadLetterLimit {
+			return f, errors.New("limit must be between 1 and 1000")
+		}
+		f.Limit = n
+	}
+
+	return f, nil
+}
@@ -2,8 +2,12 @@ package httpserver
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/cun0/insider-case/internal/domain"
 	"github.com/cun0/insider-case/internal/httpserver/middleware"
@@ -25,7 +29,7 @@ func (h *Handler) PostEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	now := h.clock().UTC()
-	if err := p.Validate(now); err != nil {
+	if err := p.Validate(now, h.maxEventAge); err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -36,13 +40,31 @@ func (h *Handler) PostEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := h.ingest.Submit(r.Context(), ev)
+	// Re-encoded client payload, kept for dead letters if the write fails.
+	raw, _ := json.Marshal(p)
+	ctx := ingest.WithRequestMeta(r.Context(), ingest.RequestMeta{
+		RequestID: middleware.GetRequestID(r.Context()),
+		Payload:   raw,
+	})
+
+	res, err := h.ingest.Submit(ctx, ev)
 	if err != nil {
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			writeError(w, statusClientClosedRequest, "client closed request")
 			return
 		}
-		if errors.Is(err, ingest.ErrStopped) {
+		var rej *ingest.RejectedError
+		if errors.As(err, &rej) {
+			writeError(w, http.StatusUnprocessableEntity, rej.Error())
+			return
+		}
+		var over *ingest.OverloadedError
+		if errors.As(err, &over) {
+			w.Header().Set("Retry-After", retryAfterSeconds(over.RetryAfter))
+			writeError(w, http.StatusServiceUnavailable, "ingestion overloaded; retry later")
+			return
+		}
+		if errors.Is(err, ingest.ErrStopped) || errors.Is(err, ingest.ErrSpoolFull) {
 			writeError(w, http.StatusServiceUnavailable, "ingestion temporarily unavailable")
 			return
 		}
@@ -55,6 +77,15 @@ func (h *Handler) PostEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if res.Accepted() {
+		// Spooled to disk; committed to the database asynchronously.
+		writeJSON(w, http.StatusAccepted, map[string]any{
+			"status":    "accepted",
+			"dedup_key": ev.DedupKey,
+		})
+		return
+	}
+
 	status := "inserted"
 	if res.Duplicate() {
 		status = "duplicate"
@@ -65,3 +96,8 @@ func (h *Handler) PostEvent(w http.ResponseWriter, r *http.Request) {
 		"dedup_key": ev.DedupKey,
 	})
 }
+
+// retryAfterSeconds rounds up to whole seconds (at least 1) for Retry-After.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(d.Seconds()))))
+}
@@ -1,11 +1,41 @@
 package httpserver
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/httpserver/middleware"
 )
 
+// Per-item result statuses for bulk ingestion.
+const (
+	itemInserted  = "inserted"
+	itemDuplicate = "duplicate"
+	itemInvalid   = "invalid"
+	itemFailed    = "failed"
+)
+
+// itemsMediaType opts into per-item results via the Accept header
+// (same as ?results=items).
+const itemsMediaType = "application/vnd.event-ingest.items+json"
+
+type bulkItem struct {
+	Index    int    `json:"index"`
+	Status   string `json:"status"`
+	DedupKey string `json:"dedup_key,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func wantItemResults(r *http.Request) bool {
+	return r.URL.Query().Get("results") == "items" ||
+		strings.Contains(r.Header.Get("Accept"), itemsMediaType)
+}
+
 func (h *Handler) PostEventsBulk(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -21,50 +51,55 @@ func (h *Handler) PostEventsBulk(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "empty payload")
 		return
 	}
+	// RateLimit already charged one token for the request.
+	if !middleware.ChargeRate(w, r, len(payloads)-1) {
+		return
+	}
 
 	now := h.clock().UTC()
 
+	items := make([]bulkItem, len(payloads))
 	events := make([]domain.Event, 0, len(payloads))
+	// index into payloads for each accepted event
+	sources := make([]int, 0, len(payloads))
 	invalid := 0
 
 	for i := range payloads {
 		p := payloads[i]
+		items[i].Index = i
 
-		if err := p.Validate(now); err != nil {
+		if err := p.Validate(now, h.maxEventAge); err != nil {
 			invalid++
+			items[i].Status = itemInvalid
+			items[i].Error = err.Error()
 			continue
 		}
 
 		ev, err := p.ToEvent(now)
 		if err != nil {
 			invalid++
+			items[i].Status = itemInvalid
+			items[i].Error = err.Error()
 			continue
 		}
 
+		items[i].DedupKey = ev.DedupKey
 		events = append(events, ev)
+		sources = append(sources, i)
 	}
 
-	// Nothing valid.
-	if len(events) == 0 {
-		writeJSON(w, http.StatusOK, map[string]any{
-			"received":   len(payloads),
-			"inserted":   0,
-			"duplicate":  0,
-			"invalid":    invalid,
-			"processed":  0,
-			"batch_fail": 0,
-		})
-		return
-	}
-
-	// Chunk to avoid Postgres param limit (65535 params).
-	// InsertBatch uses 8 params per row => max rows ~= 8191. Keep safe margin.
-	const chunkSize = 4000
+	// Chunk to what one InsertBatch can take (the VALUES path is bound by
+	// Postgres' 65535 parameter limit; COPY is not).
+	chunkSize := h.events.MaxBatchRows()
 
 	inserted := 0
 	duplicate := 0
 	batchFail := 0
 
+	// The same event may appear twice in one request; only the first
+	// occurrence is reported as inserted.
+	claimed := make(map[string]struct{})
+
 	for start := 0; start < len(events); start += chunkSize {
 		end := start + chunkSize
 		if end > len(events) {
@@ -77,20 +112,81 @@ func (h *Handler) PostEventsBulk(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			// If a chunk fails, count it as batch_fail; we don't know duplicates/inserted.
 			batchFail += len(chunk)
+			for _, src := range sources[start:end] {
+				items[src].Status = itemFailed
+				items[src].Error = "insert failed; safe to retry"
+			}
+			raws := make([]json.RawMessage, 0, len(chunk))
+			for _, src := range sources[start:end] {
+				raw, _ := json.Marshal(payloads[src])
+				raws = append(raws, raw)
+			}
+			h.deadLetterChunk(r, "post_events_bulk", chunk, raws, err)
 			continue
 		}
 
 		// insertedKeys contains only keys that were actually inserted.
-		inserted += len(insertedKeys)
-		duplicate += (len(chunk) - len(insertedKeys))
+		for i, ev := range chunk {
+			src := sources[start+i]
+			_, ok := insertedKeys[ev.DedupKey]
+			if _, dup := claimed[ev.DedupKey]; ok && !dup {
+				claimed[ev.DedupKey] = struct{}{}
+				items[src].Status = itemInserted
+				inserted++
+			} else {
+				items[src].Status = itemDuplicate
+				duplicate++
+			}
+		}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	resp := map[string]any{
 		"received":   len(payloads),
 		"processed":  len(events),
 		"inserted":   inserted,
 		"duplicate":  duplicate,
 		"invalid":    invalid,
 		"batch_fail": batchFail,
+	}
+	if wantItemResults(r) {
+		resp["items"] = items
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// deadLetterChunk records every event of a failed chunk; raws holds the
+// client payload for each event.
+func (h *Handler) deadLetterChunk(r *http.Request, component string, chunk []domain.Event, raws []json.RawMessage, cause error) {
+	rid := middleware.GetRequestID(r.Context())
+
+	h.logger.PrintError(cause, map[string]string{
+		"request_id": rid,
+		"component":  component,
+		"chunk_size": strconv.Itoa(len(chunk)),
 	})
+
+	letters := make([]domain.DeadLetter, 0, len(chunk))
+	for i, ev := range chunk {
+		letters = append(letters, domain.DeadLetter{
+			Component: component,
+			RequestID: rid,
+			DedupKey:  ev.DedupKey,
+			Error:     cause.Error(),
+			Payload:   raws[i],
+			Event:     ev,
+		})
+	}
+
+	// The request context may already be spent; use a short detached one.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := h.deadLetters.Insert(ctx, letters); err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"request_id":   rid,
+			"component":    component,
+			"dead_letters": strconv.Itoa(len(letters)),
+		})
+	}
 }
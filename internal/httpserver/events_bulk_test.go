@@ -0,0 +1,261 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeEvents inserts every key it has not seen, in chunks of at most
+// maxRows. Calls numbered in failCalls (1-based) fail.
+type fakeEvents struct {
+	EventReadStore
+
+	maxRows   int
+	failCalls map[int]bool
+
+	mu      sync.Mutex
+	calls   int
+	batches []int
+	stored  map[string]bool
+}
+
+func newFakeEvents(maxRows int, existing ...string) *fakeEvents {
+	f := &fakeEvents{maxRows: maxRows, stored: make(map[string]bool)}
+	for _, k := range existing {
+		f.stored[k] = true
+	}
+	return f
+}
+
+func (f *fakeEvents) MaxBatchRows() int { return f.maxRows }
+
+func (f *fakeEvents) InsertBatch(_ context.Context, events []domain.Event) (map[string]struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.batches = append(f.batches, len(events))
+	if len(events) > f.maxRows {
+		return nil, fmt.Errorf("%d rows over the %d row limit", len(events), f.maxRows)
+	}
+	if f.failCalls[f.calls] {
+		return nil, errors.New("connection reset")
+	}
+	out := make(map[string]struct{})
+	for _, e := range events {
+		if !f.stored[e.DedupKey] {
+			f.stored[e.DedupKey] = true
+			out[e.DedupKey] = struct{}{}
+		}
+	}
+	return out, nil
+}
+
+// fakeDeadLetters keeps inserted letters; the replay methods are unused.
+type fakeDeadLetters struct {
+	DeadLetterStore
+
+	mu      sync.Mutex
+	letters []domain.DeadLetter
+}
+
+func (d *fakeDeadLetters) Insert(_ context.Context, letters []domain.DeadLetter) error {
+	d.mu.Lock()
+	d.letters = append(d.letters, letters...)
+	d.mu.Unlock()
+	return nil
+}
+
+func newTestHandler(events EventStore, dead DeadLetterStore) *Handler {
+	h := New(jsonlog.New(io.Discard, jsonlog.LevelError), nil, events, nil, dead, nil)
+	h.clock = func() time.Time { return testNow }
+	return h
+}
+
+func testPayload(user string, ago time.Duration) domain.EventPayload {
+	return domain.EventPayload{
+		EventName: "purchase",
+		Channel:   "web",
+		UserID:    user,
+		Timestamp: testNow.Add(-ago).Unix(),
+		Tags:      []string{},
+	}
+}
+
+// dedupKey is the key the handler derives for p once it is decoded from JSON.
+func dedupKey(t *testing.T, p domain.EventPayload) string {
+	t.Helper()
+	raw, _ := json.Marshal(p)
+	if err := json.Unmarshal(raw, &p); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := p.ToEvent(testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev.DedupKey
+}
+
+type bulkResponse struct {
+	Received  int        `json:"received"`
+	Processed int        `json:"processed"`
+	Inserted  int        `json:"inserted"`
+	Duplicate int        `json:"duplicate"`
+	Invalid   int        `json:"invalid"`
+	BatchFail int        `json:"batch_fail"`
+	Items     []bulkItem `json:"items"`
+}
+
+func TestPostEventsBulkItems(t *testing.T) {
+	a := testPayload("u1", time.Minute)
+	b := testPayload("u2", time.Minute)
+	c := testPayload("u3", time.Minute)
+	noUser := testPayload("", time.Minute)
+	stored := testPayload("u4", time.Minute)
+
+	tests := []struct {
+		name      string
+		payloads  []domain.EventPayload
+		maxRows   int
+		failCalls map[int]bool
+		want      []string // item statuses
+		wantDead  []string // dedup keys
+		batches   []int
+	}{
+		{
+			name:     "mixed",
+			payloads: []domain.EventPayload{a, noUser, stored, b, a},
+			maxRows:  100,
+			want:     []string{itemInserted, itemInvalid, itemDuplicate, itemInserted, itemDuplicate},
+			batches:  []int{4},
+		},
+		{
+			name:     "chunked",
+			payloads: []domain.EventPayload{a, b, c},
+			maxRows:  2,
+			want:     []string{itemInserted, itemInserted, itemInserted},
+			batches:  []int{2, 1},
+		},
+		{
+			name:      "failed chunk",
+			payloads:  []domain.EventPayload{a, b, c},
+			maxRows:   2,
+			failCalls: map[int]bool{2: true},
+			want:      []string{itemInserted, itemInserted, itemFailed},
+			wantDead:  []string{dedupKey(t, c)},
+			batches:   []int{2, 1},
+		},
+		{
+			name:     "all invalid",
+			payloads: []domain.EventPayload{noUser, noUser},
+			maxRows:  100,
+			want:     []string{itemInvalid, itemInvalid},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := newFakeEvents(tt.maxRows, dedupKey(t, stored))
+			events.failCalls = tt.failCalls
+			dead := &fakeDeadLetters{}
+			h := newTestHandler(events, dead)
+
+			body, _ := json.Marshal(tt.payloads)
+			req := httptest.NewRequest(http.MethodPost, "/events/bulk?results=items", strings.NewReader(string(body)))
+			rec := httptest.NewRecorder()
+			h.PostEventsBulk(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var resp bulkResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			counts := map[string]int{}
+			for i, item := range resp.Items {
+				if item.Index != i {
+					t.Errorf("item %d has index %d", i, item.Index)
+				}
+				if item.Status != tt.want[i] {
+					t.Errorf("item %d status %q, want %q", i, item.Status, tt.want[i])
+				}
+				if (item.Error != "") != (item.Status == itemInvalid || item.Status == itemFailed) {
+					t.Errorf("item %d: status %q with error %q", i, item.Status, item.Error)
+				}
+				if item.Status != itemInvalid && item.DedupKey != dedupKey(t, tt.payloads[i]) {
+					t.Errorf("item %d dedup_key %q", i, item.DedupKey)
+				}
+				counts[item.Status]++
+			}
+			if len(resp.Items) != len(tt.payloads) {
+				t.Fatalf("%d items for %d payloads", len(resp.Items), len(tt.payloads))
+			}
+			if resp.Received != len(tt.payloads) || resp.Processed != len(tt.payloads)-counts[itemInvalid] ||
+				resp.Inserted != counts[itemInserted] || resp.Duplicate != counts[itemDuplicate] ||
+				resp.Invalid != counts[itemInvalid] || resp.BatchFail != counts[itemFailed] {
+				t.Fatalf("totals %+v do not match items %v", resp, counts)
+			}
+
+			if fmt.Sprint(events.batches) != fmt.Sprint(tt.batches) {
+				t.Errorf("batches %v, want %v", events.batches, tt.batches)
+			}
+			var deadKeys []string
+			for _, dl := range dead.letters {
+				deadKeys = append(deadKeys, dl.DedupKey)
+				if dl.Component != "post_events_bulk" || len(dl.Payload) == 0 {
+					t.Errorf("dead letter %+v", dl)
+				}
+			}
+			if fmt.Sprint(deadKeys) != fmt.Sprint(tt.wantDead) {
+				t.Fatalf("dead letters %v, want %v", deadKeys, tt.wantDead)
+			}
+		})
+	}
+}
+
+func TestPostEventsBulkItemsOptIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   bool
+	}{
+		{"default", "/events/bulk", "", false},
+		{"query", "/events/bulk?results=items", "", true},
+		{"accept header", "/events/bulk", "application/json, " + itemsMediaType, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(newFakeEvents(100), &fakeDeadLetters{})
+			body, _ := json.Marshal([]domain.EventPayload{testPayload("u1", time.Minute)})
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(string(body)))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.PostEventsBulk(rec, req)
+
+			var resp map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := resp["items"]; ok != tt.want {
+				t.Fatalf("items present = %v, want %v: %s", ok, tt.want, rec.Body)
+			}
+		})
+	}
+}
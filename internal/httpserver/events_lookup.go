@@ -0,0 +1,155 @@
+package httpserver
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cun0/insider-case/internal/httpserver/middleware"
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+const (
+	defaultUserEventsLimit = 100
+	maxUserEventsLimit     = 1000
+)
+
+// GET /events/{dedup_key}
+func (h *Handler) GetEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	key := strings.TrimSpace(r.PathValue("dedup_key"))
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "dedup_key is required")
+		return
+	}
+
+	e, err := h.events.GetByDedupKey(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "get_event",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, e)
+}
+
+// GET /users/{user_id}/events?event_name=&from=&to=&cursor=&limit=
+func (h *Handler) ListUserEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	f, err := parseUserEventFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, err := h.events.ListByUser(r.Context(), f)
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"component":  "list_user_events",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := map[string]any{
+		"user_id": f.UserID,
+		"events":  events,
+	}
+	if len(events) == f.Limit {
+		last := events[len(events)-1]
+		resp["next_cursor"] = encodeEventCursor(repo.EventCursor{TS: last.Timestamp, ID: last.ID})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseUserEventFilter(r *http.Request) (repo.UserEventFilter, error) {
+	q := r.URL.Query()
+	f := repo.UserEventFilter{
+		UserID:    strings.TrimSpace(r.PathValue("user_id")),
+		EventName: strings.TrimSpace(q.Get("event_name")),
+		Limit:     defaultUserEventsLimit,
+	}
+	if f.UserID == "" {
+		return f, errors.New("user_id is required")
+	}
+
+	from, ok, err := parseUnixParam(q.Get("from"))
+	if err != nil {
+		return f, errors.New("invalid from")
+	}
+	if ok {
+		f.From = from
+	}
+	to, ok, err := parseUnixParam(q.Get("to"))
+	if err != nil {
+		return f, errors.New("invalid to")
+	}
+	if ok {
+		f.To = to
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, errors.New("from must be < to")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeEventCursor(v)
+		if err != nil {
+			return f, errors.New("invalid cursor")
+		}
+		f.After = &c
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxUserEventsLimit {
+			return f, errors.New("limit must be between 1 and " + strconv.Itoa(maxUserEventsLimit))
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+// Cursors are opaque to clients: base64url of "<ts unix nanos>:<id>".
+func encodeEventCursor(c repo.EventCursor) string {
+	raw := strconv.FormatInt(c.TS.UnixNano(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeEventCursor(s string) (repo.EventCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return repo.EventCursor{}, err
+	}
+	tsPart, idPart, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return repo.EventCursor{}, errors.New("malformed cursor")
+	}
+	ns, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return repo.EventCursor{}, err
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		return repo.EventCursor{}, errors.New("malformed cursor")
+	}
+	return repo.EventCursor{TS: time.Unix(0, ns).UTC(), ID: id}, nil
+}
@@ -0,0 +1,199 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+func TestEventCursorRoundTrip(t *testing.T) {
+	tests := []repo.EventCursor{
+		{TS: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), ID: 1},
+		// Postgres keeps microseconds; the cursor must not round them away.
+		{TS: time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC), ID: 9_007_199_254_740_993},
+		{TS: time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), ID: 7},
+	}
+	for _, c := range tests {
+		s := encodeEventCursor(c)
+		got, err := decodeEventCursor(s)
+		if err != nil {
+			t.Fatalf("decode(%q): %v", s, err)
+		}
+		if !got.TS.Equal(c.TS) || got.ID != c.ID || got.TS.Location() != time.UTC {
+			t.Fatalf("round trip of %+v gave %+v", c, got)
+		}
+	}
+}
+
+func TestDecodeEventCursorInvalid(t *testing.T) {
+	enc := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := map[string]string{
+		"not base64":     "***",
+		"padded base64":  base64.URLEncoding.EncodeToString([]byte("1:12")),
+		"no separator":   enc("123"),
+		"bad timestamp":  enc("x:1"),
+		"bad id":         enc("1:x"),
+		"zero id":        enc("1:0"),
+		"negative id":    enc("1:-5"),
+		"empty":          enc(":"),
+		"trailing junk":  enc("1:2:3"),
+		"timestamp only": enc("1:"),
+	}
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			if c, err := decodeEventCursor(s); err == nil {
+				t.Fatalf("decode(%q) = %+v, want an error", s, c)
+			}
+		})
+	}
+}
+
+// userEvents serves ListByUser from a fixed slice with the repo's keyset
+// semantics: newest first on (ts, id), strictly after the cursor.
+type userEvents struct {
+	EventBatchStore
+	events []domain.StoredEvent // sorted by (ts, id) descending
+}
+
+func (u *userEvents) GetByDedupKey(context.Context, string) (domain.StoredEvent, error) {
+	return domain.StoredEvent{}, repo.ErrNotFound
+}
+
+func (u *userEvents) ListByUser(_ context.Context, f repo.UserEventFilter) ([]domain.StoredEvent, error) {
+	var out []domain.StoredEvent
+	for _, e := range u.events {
+		if f.After != nil && !(e.Timestamp.Before(f.After.TS) || e.Timestamp.Equal(f.After.TS) && e.ID < f.After.ID) {
+			continue
+		}
+		out = append(out, e)
+		if len(out) == f.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func TestListUserEventsPaging(t *testing.T) {
+	// Seven events, several sharing a timestamp, newest first.
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var events []domain.StoredEvent
+	for i, ts := range []time.Duration{3, 3, 3, 2, 2, 1, 0} {
+		events = append(events, domain.StoredEvent{
+			ID:    int64(100 - i),
+			Event: domain.Event{UserID: "u1", Timestamp: base.Add(ts * time.Second)},
+		})
+	}
+	h := newTestHandler(&userEvents{events: events}, nil)
+
+	for _, limit := range []string{"1", "2", "3", "7", "10"} {
+		t.Run("limit "+limit, func(t *testing.T) {
+			var (
+				seen   []int64
+				cursor string
+			)
+			for page := 0; page < 10; page++ {
+				q := url.Values{"limit": {limit}}
+				if cursor != "" {
+					q.Set("cursor", cursor)
+				}
+				req := httptest.NewRequest(http.MethodGet, "/users/u1/events?"+q.Encode(), nil)
+				req.SetPathValue("user_id", "u1")
+				rec := httptest.NewRecorder()
+				h.ListUserEvents(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status %d: %s", rec.Code, rec.Body)
+				}
+
+				var resp struct {
+					Events     []domain.StoredEvent `json:"events"`
+					NextCursor string               `json:"next_cursor"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				for _, e := range resp.Events {
+					seen = append(seen, e.ID)
+				}
+				if resp.NextCursor == "" {
+					break
+				}
+				cursor = resp.NextCursor
+			}
+
+			if len(seen) != len(events) {
+				t.Fatalf("paged through ids %v, want all %d events once", seen, len(events))
+			}
+			for i, id := range seen {
+				if id != events[i].ID {
+					t.Fatalf("paged through ids %v, want them newest first", seen)
+				}
+			}
+		})
+	}
+}
+
+func TestParseUserEventFilter(t *testing.T) {
+	cursor := encodeEventCursor(repo.EventCursor{TS: time.Unix(1_772_000_000, 0).UTC(), ID: 5})
+
+	tests := []struct {
+		name    string
+		user    string
+		query   string
+		wantErr string
+		check   func(t *testing.T, f repo.UserEventFilter)
+	}{
+		{
+			name: "defaults",
+			user: "u1",
+			check: func(t *testing.T, f repo.UserEventFilter) {
+				if f.Limit != defaultUserEventsLimit || f.After != nil || !f.From.IsZero() || !f.To.IsZero() {
+					t.Fatalf("filter %+v", f)
+				}
+			},
+		},
+		{
+			name:  "every parameter",
+			user:  "u1",
+			query: "event_name=purchase&from=1772000000&to=1772003600&limit=5&cursor=" + cursor,
+			check: func(t *testing.T, f repo.UserEventFilter) {
+				if f.EventName != "purchase" || f.Limit != 5 || f.From.Unix() != 1_772_000_000 || f.To.Unix() != 1_772_003_600 {
+					t.Fatalf("filter %+v", f)
+				}
+				if f.After == nil || f.After.ID != 5 || f.After.TS.Unix() != 1_772_000_000 {
+					t.Fatalf("cursor %+v", f.After)
+				}
+			},
+		},
+		{name: "no user", user: " ", wantErr: "user_id is required"},
+		{name: "bad cursor", user: "u1", query: "cursor=nope", wantErr: "invalid cursor"},
+		{name: "bad from", user: "u1", query: "from=yesterday", wantErr: "invalid from"},
+		{name: "empty range", user: "u1", query: "from=1772003600&to=1772000000", wantErr: "from must be < to"},
+		{name: "limit too high", user: "u1", query: "limit=1001", wantErr: "limit must be between 1 and 1000"},
+		{name: "limit zero", user: "u1", query: "limit=0", wantErr: "limit must be between 1 and 1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/x/events?"+tt.query, nil)
+			req.SetPathValue("user_id", tt.user)
+			f, err := parseUserEventFilter(req)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, f)
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/httpserver/middleware"
+)
+
+const (
+	ndjsonMediaType = "application/x-ndjson"
+
+	maxStreamLine = 256 << 10 // 256KB, same as a single /events body
+	// streamIdleTimeout is how long the stream may stall between chunks.
+	streamIdleTimeout = 30 * time.Second
+	streamChunkRows   = 1000
+	// streamChunkTimeout bounds each chunk's insert; the Timeout middleware
+	// does not cover this endpoint.
+	streamChunkTimeout = 10 * time.Second
+)
+
+var errLineTooLong = errors.New("line exceeds 256KB")
+
+// PostEventsStream ingests an NDJSON body (one EventPayload per line) as it
+// is read, committing the valid events of every streamChunkRows lines (fewer
+// if the repo's MaxBatchRows is lower). There is no overall size cap. With
+// ?results=items (or the items Accept type) per-line results are streamed
+// back as NDJSON (index = 0-based line number), followed by a final summary
+// line.
+func (h *Handler) PostEventsStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != ndjsonMediaType {
+		writeError(w, http.StatusUnsupportedMediaType, "content type must be "+ndjsonMediaType)
+		return
+	}
+	defer r.Body.Close()
+
+	rc := http.NewResponseController(w)
+	extendDeadlines := func() {
+		d := time.Now().Add(streamIdleTimeout)
+		_ = rc.SetReadDeadline(d)
+		_ = rc.SetWriteDeadline(d)
+	}
+	extendDeadlines()
+
+	s := &ndjsonStream{
+		h:         h,
+		r:         r,
+		chunkSize: min(streamChunkRows, h.events.MaxBatchRows()),
+	}
+
+	if wantItemResults(r) {
+		// Results are written while the body is still being read.
+		_ = rc.EnableFullDuplex()
+		w.Header().Set("Content-Type", ndjsonMediaType)
+		w.WriteHeader(http.StatusOK)
+		s.enc = json.NewEncoder(w)
+		s.flush = func() { _ = rc.Flush() }
+	}
+
+	br := bufio.NewReaderSize(r.Body, 64<<10)
+
+	var readErr error
+	for line := 0; ; line++ {
+		raw, err := readLine(br, maxStreamLine)
+		if errors.Is(err, io.EOF) && len(raw) == 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, errLineTooLong) {
+			readErr = err
+			break
+		}
+
+		if errors.Is(err, errLineTooLong) {
+			s.received++
+			s.add(line, bulkItem{Status: itemInvalid, Error: err.Error()}, nil, nil)
+		} else if raw = bytes.TrimSpace(raw); len(raw) == 0 {
+			// blank lines are allowed and ignored
+		} else {
+			s.received++
+			// A stream can run for hours: validate against the time the line
+			// arrived, not the time the stream started.
+			now := h.clock().UTC()
+			var p domain.EventPayload
+			if err := decodeJSON(io.NopCloser(bytes.NewReader(raw)), &p); err != nil {
+				s.add(line, bulkItem{Status: itemInvalid, Error: err.Error()}, nil, nil)
+			} else if err := p.Validate(now, h.maxEventAge); err != nil {
+				s.add(line, bulkItem{Status: itemInvalid, Error: err.Error()}, nil, nil)
+			} else if ev, err := p.ToEvent(now); err != nil {
+				s.add(line, bulkItem{Status: itemInvalid, Error: err.Error()}, nil, nil)
+			} else {
+				s.add(line, bulkItem{DedupKey: ev.DedupKey}, &ev, append(json.RawMessage(nil), raw...))
+			}
+		}
+
+		if len(s.pending) >= s.chunkSize {
+			s.commit()
+			extendDeadlines()
+		}
+		if r.Context().Err() != nil {
+			readErr = r.Context().Err()
+			break
+		}
+	}
+	s.commit()
+
+	summary := map[string]any{
+		"received":   s.received,
+		"processed":  s.processed,
+		"inserted":   s.inserted,
+		"duplicate":  s.duplicate,
+		"invalid":    s.invalid,
+		"batch_fail": s.batchFail,
+	}
+	if readErr != nil {
+		// Everything before the error was processed and is reported above.
+		summary["error"] = "stream aborted: " + readErr.Error()
+	}
+
+	if s.enc != nil {
+		_ = s.enc.Encode(map[string]any{"summary": summary})
+		return
+	}
+	if readErr != nil {
+		writeJSON(w, http.StatusBadRequest, summary)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+type ndjsonStream struct {
+	h         *Handler
+	r         *http.Request
+	chunkSize int
+
+	// pending results in line order; events/raws/slots hold the valid ones.
+	pending []bulkItem
+	events  []domain.Event
+	raws    []json.RawMessage
+	slots   []int
+
+	enc   *json.Encoder
+	flush func()
+
+	received, processed, inserted, duplicate, invalid, batchFail int
+}
+
+func (s *ndjsonStream) add(line int, item bulkItem, ev *domain.Event, raw json.RawMessage) {
+	item.Index = line
+	if item.Status == itemInvalid {
+		s.invalid++
+	}
+	if ev != nil {
+		s.slots = append(s.slots, len(s.pending))
+		s.events = append(s.events, *ev)
+		s.raws = append(s.raws, raw)
+	}
+	s.pending = append(s.pending, item)
+}
+
+// commit inserts the buffered chunk and emits its results.
+func (s *ndjsonStream) commit() {
+	if len(s.events) > 0 {
+		s.processed += len(s.events)
+
+		// Pace the stream to the caller's rate limit rather than failing it;
+		// if the request is cancelled while waiting, the insert fails below.
+		_ = middleware.WaitRate(s.r.Context(), len(s.events))
+
+		ctx, cancel := context.WithTimeout(s.r.Context(), streamChunkTimeout)
+		insertedKeys, err := s.h.events.InsertBatch(ctx, s.events)
+		cancel()
+		if err != nil {
+			s.batchFail += len(s.events)
+			for _, slot := range s.slots {
+				s.pending[slot].Status = itemFailed
+				s.pending[slot].Error = "insert failed; safe to retry"
+			}
+			s.h.deadLetterChunk(s.r, "post_events_stream", s.events, s.raws, err)
+		} else {
+			claimed := make(map[string]struct{}, len(insertedKeys))
+			for i, ev := range s.events {
+				slot := s.slots[i]
+				_, ok := insertedKeys[ev.DedupKey]
+				if _, dup := claimed[ev.DedupKey]; ok && !dup {
+					claimed[ev.DedupKey] = struct{}{}
+					s.pending[slot].Status = itemInserted
+					s.inserted++
+				} else {
+					s.pending[slot].Status = itemDuplicate
+					s.duplicate++
+				}
+			}
+		}
+	}
+
+	if s.enc != nil && len(s.pending) > 0 {
+		for _, item := range s.pending {
+			_ = s.enc.Encode(item)
+		}
+		s.flush()
+	}
+
+	s.pending = s.pending[:0]
+	s.events = s.events[:0]
+	s.raws = s.raws[:0]
+	s.slots = s.slots[:0]
+}
+
+// readLine returns the next line without its terminator. Lines longer than
+// max are consumed and reported as errLineTooLong. io.EOF is returned with
+// the final line if it has no trailing newline.
+func readLine(br *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max+1 {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		switch {
+		case err == nil:
+			if tooLong {
+				return nil, errLineTooLong
+			}
+			return bytes.TrimRight(line, "\r\n"), nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			if tooLong {
+				return nil, errLineTooLong
+			}
+			return line, io.EOF
+		default:
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package httpserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadLine(t *testing.T) {
+	const max = 8
+
+	type line struct {
+		text string
+		err  error
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  []line
+	}{
+		{
+			name:  "lines",
+			input: "a\nbb\n",
+			want:  []line{{"a", nil}, {"bb", nil}, {"", io.EOF}},
+		},
+		{
+			name:  "crlf and blank",
+			input: "a\r\n\r\nb\r\n",
+			want:  []line{{"a", nil}, {"", nil}, {"b", nil}, {"", io.EOF}},
+		},
+		{
+			name:  "no trailing newline",
+			input: "a\nlast",
+			want:  []line{{"a", nil}, {"last", io.EOF}},
+		},
+		{
+			name:  "exactly max",
+			input: "12345678\n",
+			want:  []line{{"12345678", nil}, {"", io.EOF}},
+		},
+		{
+			// The rest of a long line is consumed; the next one is intact.
+			name:  "too long",
+			input: "123456789\nok\n",
+			want:  []line{{"", errLineTooLong}, {"ok", nil}, {"", io.EOF}},
+		},
+		{
+			name:  "too long at eof",
+			input: "ok\n" + strings.Repeat("x", 100),
+			want:  []line{{"ok", nil}, {"", errLineTooLong}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A buffer smaller than a long line exercises ErrBufferFull.
+			br := bufio.NewReaderSize(strings.NewReader(tt.input), 16)
+			for i, want := range tt.want {
+				got, err := readLine(br, max)
+				if string(got) != want.text || !errors.Is(err, want.err) || (want.err == nil && err != nil) {
+					t.Fatalf("line %d = %q, %v; want %q, %v", i, got, err, want.text, want.err)
+				}
+			}
+		})
+	}
+}
+
+func streamBody(t *testing.T, lines ...any) string {
+	t.Helper()
+	var b strings.Builder
+	for _, l := range lines {
+		if s, ok := l.(string); ok {
+			b.WriteString(s + "\n")
+			continue
+		}
+		raw, err := json.Marshal(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(raw)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func postStream(h *Handler, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", ndjsonMediaType+"; charset=utf-8")
+	rec := httptest.NewRecorder()
+	h.PostEventsStream(rec, req)
+	return rec
+}
+
+func TestPostEventsStream(t *testing.T) {
+	a := testPayload("u1", time.Minute)
+	b := testPayload("u2", time.Minute)
+	c := testPayload("u3", time.Minute)
+
+	body := streamBody(t,
+		a,
+		`{"event_name":`,                      // 1: malformed JSON
+		"",                                    // 2: blank, ignored
+		testPayload("", time.Minute),          // 3: fails validation
+		b,                                     // 4
+		`{"unknown":1}`,                       // 5: unknown field
+		strings.Repeat("x", maxStreamLine+10), // 6: too long
+		a,                                     // 7: duplicate of line 0
+		c,                                     // 8
+	)
+
+	events := newFakeEvents(2)
+	h := newTestHandler(events, &fakeDeadLetters{})
+	rec := postStream(h, "/events/stream?results=items", body)
+
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), ndjsonMediaType) {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var (
+		items   []bulkItem
+		summary bulkResponse
+	)
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var line map[string]json.RawMessage
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		if raw, ok := line["summary"]; ok {
+			if err := json.Unmarshal(raw, &summary); err != nil {
+				t.Fatal(err)
+			}
+			if dec.More() {
+				t.Fatal("output after the summary line")
+			}
+			break
+		}
+		raw, _ := json.Marshal(line)
+		var item bulkItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+
+	want := map[int]string{
+		0: itemInserted,
+		1: itemInvalid,
+		3: itemInvalid,
+		4: itemInserted,
+		5: itemInvalid,
+		6: itemInvalid,
+		7: itemDuplicate,
+		8: itemInserted,
+	}
+	if len(items) != len(want) {
+		t.Fatalf("%d result lines, want %d: %+v", len(items), len(want), items)
+	}
+	last := -1
+	for _, item := range items {
+		if item.Index <= last {
+			t.Fatalf("results out of line order: %+v", items)
+		}
+		last = item.Index
+		if item.Status != want[item.Index] {
+			t.Errorf("line %d status %q, want %q (%s)", item.Index, item.Status, want[item.Index], item.Error)
+		}
+		if (item.Status == itemInvalid) != (item.Error != "") {
+			t.Errorf("line %d: status %q with error %q", item.Index, item.Status, item.Error)
+		}
+	}
+	if items[5].Error != errLineTooLong.Error() {
+		t.Errorf("long line error %q", items[5].Error)
+	}
+
+	// A chunk is MaxBatchRows result lines, invalid ones included; only
+	// its valid events are inserted.
+	if got := events.batches; len(got) != 3 || got[0] != 1 || got[1] != 1 || got[2] != 2 {
+		t.Errorf("batches %v, want [1 1 2]", got)
+	}
+	if summary.Received != 8 || summary.Processed != 4 || summary.Inserted != 3 ||
+		summary.Duplicate != 1 || summary.Invalid != 4 || summary.BatchFail != 0 {
+		t.Fatalf("summary %+v", summary)
+	}
+}
+
+func TestPostEventsStreamSummaryOnly(t *testing.T) {
+	events := newFakeEvents(100)
+	events.failCalls = map[int]bool{1: true}
+	dead := &fakeDeadLetters{}
+	h := newTestHandler(events, dead)
+
+	rec := postStream(h, "/events/stream", streamBody(t, testPayload("u1", time.Minute), testPayload("u2", time.Minute)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var summary bulkResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Received != 2 || summary.BatchFail != 2 || summary.Inserted != 0 || summary.Items != nil {
+		t.Fatalf("summary %+v", summary)
+	}
+	if len(dead.letters) != 2 || dead.letters[0].Component != "post_events_stream" {
+		t.Fatalf("dead letters %+v", dead.letters)
+	}
+}
+
+func TestPostEventsStreamContentType(t *testing.T) {
+	h := newTestHandler(newFakeEvents(100), &fakeDeadLetters{})
+	req := httptest.NewRequest(http.MethodPost, "/events/stream", strings.NewReader("{}\n"))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.PostEventsStream(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status %d, want 415", rec.Code)
+	}
+}
+
+func TestPostEventsStreamClock(t *testing.T) {
+	// The clock moves ten minutes per read. Each event is stamped five
+	// minutes past the stream start times its line number, so each is in
+	// the future when the stream starts but not when its line is read.
+	var (
+		mu    sync.Mutex
+		reads int
+	)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		reads++
+		return testNow.Add(time.Duration(reads) * 10 * time.Minute)
+	}
+
+	var lines []any
+	for i := range 3 {
+		p := testPayload("u1", 0)
+		p.Timestamp = testNow.Add(time.Duration(i+1) * 5 * time.Minute).Unix()
+		lines = append(lines, p)
+	}
+
+	h := newTestHandler(newFakeEvents(100), &fakeDeadLetters{})
+	h.clock = clock
+	rec := postStream(h, "/events/stream", streamBody(t, lines...))
+
+	var summary bulkResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Invalid != 0 || summary.Inserted != 3 {
+		t.Fatalf("summary %+v, want 3 inserted", summary)
+	}
+}
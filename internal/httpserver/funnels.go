@@ -0,0 +1,161 @@
+package httpserver
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+const (
+	defaultFunnelWindow = 24 * time.Hour
+	maxFunnelWindow     = 90 * 24 * time.Hour
+	// Funnels look further back than /metrics by default.
+	defaultFunnelRange = 7 * 24 * time.Hour
+)
+
+// GET /funnels?steps=view,add_to_cart,purchase&window=24h&from=&to=&channel=&campaign_id=&group_by=channel
+func (h *Handler) GetFunnel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+
+	steps, err := listParam(q, "steps")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(steps) < 2 || len(steps) > repo.MaxFunnelSteps {
+		writeError(w, http.StatusBadRequest, "steps must list 2 to "+strconv.Itoa(repo.MaxFunnelSteps)+" event names")
+		return
+	}
+
+	window := defaultFunnelWindow
+	if v := strings.TrimSpace(q.Get("window")); v != "" {
+		window, err = parseWindow(v)
+		if err != nil || window <= 0 || window > maxFunnelWindow {
+			writeError(w, http.StatusBadRequest, "window must be a positive duration up to 90d (e.g. 30m, 24h, 7d)")
+			return
+		}
+	}
+
+	from, to, err := parseTimeRange(q, h.clock(), defaultFunnelRange)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fq := repo.FunnelQuery{
+		Steps:   steps,
+		Window:  window,
+		From:    from,
+		To:      to,
+		Channel: strings.TrimSpace(q.Get("channel")),
+	}
+	if fq.CampaignIDs, err = listParam(q, "campaign_id"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch g := strings.TrimSpace(q.Get("group_by")); g {
+	case "":
+	case string(repo.DimChannel):
+		fq.ByChannel = true
+	default:
+		writeError(w, http.StatusBadRequest, "group_by must be channel")
+		return
+	}
+
+	rows, err := h.metrics.Funnel(r.Context(), fq)
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"component": "get_funnel",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := map[string]any{
+		"from":           from.Unix(),
+		"to":             to.Unix(),
+		"window_seconds": int64(window / time.Second),
+	}
+	if fq.Channel != "" {
+		resp["channel"] = fq.Channel
+	}
+	if len(fq.CampaignIDs) > 0 {
+		resp["campaign_id"] = fq.CampaignIDs
+	}
+
+	if !fq.ByChannel {
+		var users []int64
+		if len(rows) > 0 {
+			users = rows[0].Users
+		}
+		resp["steps"] = funnelSteps(steps, users)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	breakdown := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		breakdown = append(breakdown, map[string]any{
+			"channel": row.Channel,
+			"steps":   funnelSteps(steps, row.Users),
+		})
+	}
+	resp["group_by"] = "channel"
+	resp["breakdown"] = breakdown
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type funnelStep struct {
+	EventName string `json:"event_name"`
+	Users     int64  `json:"users"`
+	// Conversion is relative to the first step, StepConversion to the
+	// previous one.
+	Conversion     float64 `json:"conversion"`
+	StepConversion float64 `json:"step_conversion"`
+}
+
+func funnelSteps(names []string, users []int64) []funnelStep {
+	out := make([]funnelStep, len(names))
+	for i, name := range names {
+		out[i] = funnelStep{EventName: name}
+		if i < len(users) {
+			out[i].Users = users[i]
+		}
+	}
+	for i := range out {
+		prev := out[max(i-1, 0)].Users
+		out[i].Conversion = ratio(out[i].Users, out[0].Users)
+		out[i].StepConversion = ratio(out[i].Users, prev)
+	}
+	return out
+}
+
+// ratio rounds to 4 decimals; 0 when there is nothing to convert from.
+func ratio(n, d int64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(d)*10000) / 10000
+}
+
+// parseWindow accepts Go durations (30m, 24h) and whole days (7d).
+func parseWindow(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 || n > 366 {
+			return 0, errors.New("invalid window")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,79 @@
+package httpserver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30m", want: 30 * time.Minute},
+		{in: "24h", want: 24 * time.Hour},
+		{in: "7d", want: 7 * 24 * time.Hour},
+		{in: "0d", want: 0},
+		{in: "366d", want: 366 * 24 * time.Hour},
+		{in: "367d", wantErr: true},
+		{in: "-1d", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "week", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseWindow(tt.in)
+			if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+				t.Fatalf("parseWindow(%q) = %s, %v; want %s, error = %v", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFunnelSteps(t *testing.T) {
+	names := []string{"view", "cart", "purchase"}
+	tests := []struct {
+		name  string
+		users []int64
+		want  []funnelStep
+	}{
+		{
+			name:  "conversions",
+			users: []int64{200, 50, 20},
+			want: []funnelStep{
+				{"view", 200, 1, 1},
+				{"cart", 50, 0.25, 0.25},
+				{"purchase", 20, 0.1, 0.4},
+			},
+		},
+		{
+			name:  "rounded to 4 decimals",
+			users: []int64{3, 1, 1},
+			want: []funnelStep{
+				{"view", 3, 1, 1},
+				{"cart", 1, 0.3333, 0.3333},
+				{"purchase", 1, 0.3333, 1},
+			},
+		},
+		{
+			// No rows at all: every step is reported with zeros.
+			name: "no users",
+			want: []funnelStep{{"view", 0, 0, 0}, {"cart", 0, 0, 0}, {"purchase", 0, 0, 0}},
+		},
+		{
+			name:  "drop to zero",
+			users: []int64{10, 0, 0},
+			want:  []funnelStep{{"view", 10, 1, 1}, {"cart", 0, 0, 0}, {"purchase", 0, 0, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := funnelSteps(names, tt.users); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("funnelSteps = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,38 +6,103 @@ import (
 	"time"
 
 	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/httpserver/middleware"
 	"github.com/cun0/insider-case/internal/ingest"
 	"github.com/cun0/insider-case/internal/jsonlog"
 	"github.com/cun0/insider-case/internal/repo"
 )
 
 type MetricsStore interface {
-	Totals(ctx context.Context, eventName string, from, to time.Time, channel string) (repo.MetricsTotals, error)
-	ByChannel(ctx context.Context, eventName string, from, to time.Time, channel string) ([]repo.MetricsByChannelRow, error)
+	Totals(ctx context.Context, f repo.MetricsFilter, agg repo.Aggregate, acc repo.Accuracy) (repo.MetricsTotals, error)
+	Breakdown(ctx context.Context, f repo.MetricsFilter, agg repo.Aggregate, acc repo.Accuracy, dims []repo.Dimension, topN int) ([]repo.BreakdownRow, error)
+	Series(ctx context.Context, f repo.MetricsFilter, agg repo.Aggregate, acc repo.Accuracy, interval time.Duration, loc *time.Location) ([]repo.MetricsBucket, error)
+	Funnel(ctx context.Context, fq repo.FunnelQuery) ([]repo.FunnelRow, error)
+	Retention(ctx context.Context, rq repo.RetentionQuery) ([]repo.RetentionCohort, error)
 }
 
 type EventBatchStore interface {
 	InsertBatch(ctx context.Context, events []domain.Event) (map[string]struct{}, error)
+	MaxBatchRows() int
+}
+
+type EventReadStore interface {
+	GetByDedupKey(ctx context.Context, dedupKey string) (domain.StoredEvent, error)
+	ListByUser(ctx context.Context, f repo.UserEventFilter) ([]domain.StoredEvent, error)
+}
+
+// EventStore is the events table: batch writes for /events/bulk and reads
+// for the lookup routes.
+type EventStore interface {
+	EventBatchStore
+	EventReadStore
+}
+
+type DeadLetterStore interface {
+	Insert(ctx context.Context, letters []domain.DeadLetter) error
+	List(ctx context.Context, f repo.DeadLetterFilter) ([]domain.DeadLetter, error)
+	Get(ctx context.Context, id int64) (domain.DeadLetter, error)
+	MarkReplayed(ctx context.Context, id int64) error
+	MarkReplayFailed(ctx context.Context, id int64, replayErr string) error
+}
+
+type APIKeyStore interface {
+	Create(ctx context.Context, name, prefix string, hash []byte, scopes []string) (domain.APIKey, error)
+	List(ctx context.Context) ([]domain.APIKey, error)
+	Revoke(ctx context.Context, id int64) error
+	GetByHash(ctx context.Context, hash []byte) (domain.APIKey, error)
 }
 
 type Handler struct {
-	logger  *jsonlog.Logger
-	ingest  ingest.Sink
-	events  EventBatchStore
-	metrics MetricsStore
-	clock   func() time.Time
+	logger      *jsonlog.Logger
+	ingest      ingest.Sink
+	events      EventStore
+	metrics     MetricsStore
+	deadLetters DeadLetterStore
+	apiKeys     APIKeyStore
+	keyCache    *middleware.APIKeys // nil when auth is disabled
+	health      *Health             // nil skips the database check
+	clock       func() time.Time
+	// maxEventAge rejects older timestamps at validation; 0 disables it.
+	maxEventAge time.Duration
 }
 
-func New(logger *jsonlog.Logger, sink ingest.Sink, events EventBatchStore, metrics MetricsStore) *Handler {
+func New(logger *jsonlog.Logger, sink ingest.Sink, events EventStore, metrics MetricsStore, deadLetters DeadLetterStore, apiKeys APIKeyStore) *Handler {
 	return &Handler{
-		logger:  logger,
-		ingest:  sink,
-		events:  events,
-		metrics: metrics,
-		clock:   time.Now,
+		logger:      logger,
+		ingest:      sink,
+		events:      events,
+		metrics:     metrics,
+		deadLetters: deadLetters,
+		apiKeys:     apiKeys,
+		clock:       time.Now,
 	}
 }
 
+// spoolDepther is implemented by sinks that buffer on local disk.
+type spoolDepther interface {
+	Depth() ingest.SpoolStats
+}
+
+// admissionReporter is implemented by sinks with admission control.
+type admissionReporter interface {
+	Admission() ingest.AdmissionStats
+}
+
+// batchingReporter is implemented by the in-memory writers.
+type batchingReporter interface {
+	Batching() ingest.BatchingStats
+}
+
 func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	resp := map[string]any{"status": "ok"}
+	if sd, ok := h.ingest.(spoolDepther); ok {
+		resp["spool"] = sd.Depth()
+	}
+	if ar, ok := h.ingest.(admissionReporter); ok {
+		resp["admission"] = ar.Admission()
+	}
+	if br, ok := h.ingest.(batchingReporter); ok {
+		resp["batching"] = br.Batching()
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
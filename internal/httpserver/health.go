@@ -0,0 +1,167 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Optional sink capabilities used by the readiness checks.
+type (
+	runningReporter interface {
+		Running() bool
+	}
+	queueReporter interface {
+		QueueStats() (depth, capacity int)
+	}
+	flushErrorReporter interface {
+		FlushErrors() (flushes, failures int)
+	}
+)
+
+const (
+	// pingTTL caches the database ping so probes do not hit the pool every time.
+	pingTTL     = 2 * time.Second
+	pingTimeout = time.Second
+
+	// not ready above this queue fill ratio
+	maxQueueSaturation = 0.9
+	// not ready above this failed-commit ratio over the last minute,
+	// once there were at least minFlushesForRate commits
+	maxFlushErrorRate = 0.5
+	minFlushesForRate = 5
+)
+
+// Health tracks readiness: database reachability, writer state, queue
+// saturation and recent flush errors. Serve marks it draining as soon as
+// shutdown begins so load balancers stop routing before the writer stops.
+type Health struct {
+	db       Pinger
+	draining atomic.Bool
+
+	mu        sync.Mutex
+	pingErr   error
+	pingTook  time.Duration
+	checkedAt time.Time
+}
+
+func NewHealth(db Pinger) *Health {
+	return &Health{db: db}
+}
+
+// StartDraining makes /readyz fail from now on. Safe on a nil *Health.
+func (hl *Health) StartDraining() {
+	if hl == nil {
+		return
+	}
+	hl.draining.Store(true)
+}
+
+func (hl *Health) Draining() bool {
+	return hl != nil && hl.draining.Load()
+}
+
+// ping returns the cached result, refreshing it when older than pingTTL.
+// It does not use the probe's context: a short request timeout must not be
+// cached as a database failure.
+func (hl *Health) ping() (took time.Duration, at time.Time, err error) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	if time.Since(hl.checkedAt) < pingTTL {
+		return hl.pingTook, hl.checkedAt, hl.pingErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	start := time.Now()
+	hl.pingErr = hl.db.Ping(ctx)
+	hl.pingTook = time.Since(start)
+	hl.checkedAt = time.Now()
+	return hl.pingTook, hl.checkedAt, hl.pingErr
+}
+
+type healthCheck struct {
+	OK    bool           `json:"ok"`
+	Error string         `json:"error,omitempty"`
+	Info  map[string]any `json:"info,omitempty"`
+}
+
+// GET /livez: the process is up and the writer has not died. It does not
+// depend on the database, so a DB outage does not trigger restarts.
+func (h *Handler) Livez(w http.ResponseWriter, r *http.Request) {
+	if rr, ok := h.ingest.(runningReporter); ok && !rr.Running() && !h.health.Draining() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "writer stopped"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+// GET /readyz: 200 when every check passes, 503 otherwise; the body
+// details each check either way.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{}
+	ready := true
+	add := func(name string, c healthCheck) {
+		checks[name] = c
+		ready = ready && c.OK
+	}
+
+	if h.health.Draining() {
+		add("shutdown", healthCheck{OK: false, Error: "shutting down"})
+	} else {
+		add("shutdown", healthCheck{OK: true})
+	}
+
+	if h.health != nil && h.health.db != nil {
+		took, at, err := h.health.ping()
+		c := healthCheck{OK: err == nil, Info: map[string]any{
+			"latency_ms": took.Milliseconds(),
+			"checked_at": at.UTC().Format(time.RFC3339Nano),
+		}}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		add("database", c)
+	}
+
+	if rr, ok := h.ingest.(runningReporter); ok {
+		c := healthCheck{OK: rr.Running()}
+		if !c.OK {
+			c.Error = "writer not running"
+		}
+		add("writer", c)
+	}
+
+	if q, ok := h.ingest.(queueReporter); ok {
+		depth, capacity := q.QueueStats()
+		c := healthCheck{OK: true, Info: map[string]any{"depth": depth, "capacity": capacity}}
+		if capacity > 0 && float64(depth)/float64(capacity) > maxQueueSaturation {
+			c.OK = false
+			c.Error = "queue saturated"
+		}
+		add("queue", c)
+	}
+
+	if fe, ok := h.ingest.(flushErrorReporter); ok {
+		flushes, failures := fe.FlushErrors()
+		c := healthCheck{OK: true, Info: map[string]any{"flushes_1m": flushes, "failures_1m": failures}}
+		if flushes >= minFlushesForRate && float64(failures)/float64(flushes) > maxFlushErrorRate {
+			c.OK = false
+			c.Error = "high flush error rate"
+		}
+		add("flush_errors", c)
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
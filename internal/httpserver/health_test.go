@@ -0,0 +1,192 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/cun0/insider-case/internal/ingest"
+)
+
+// fakeSink reports writer state for the health checks; Submit is unused.
+type fakeSink struct {
+	ingest.Sink
+
+	mu                sync.Mutex
+	running           bool
+	depth, capacity   int
+	flushes, failures int
+}
+
+func (s *fakeSink) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func (s *fakeSink) QueueStats() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth, s.capacity
+}
+
+func (s *fakeSink) FlushErrors() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushes, s.failures
+}
+
+func (s *fakeSink) setRunning(running bool) {
+	s.mu.Lock()
+	s.running = running
+	s.mu.Unlock()
+}
+
+type fakePinger struct {
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (p *fakePinger) Ping(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return p.err
+}
+
+type probeResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+func probe(t *testing.T, fn http.HandlerFunc, target string) (int, probeResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	fn(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var resp probeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, resp
+}
+
+func newHealthHandler(sink ingest.Sink, db Pinger) *Handler {
+	h := newTestHandler(nil, nil)
+	h.ingest = sink
+	h.health = NewHealth(db)
+	return h
+}
+
+func TestProbesDuringShutdown(t *testing.T) {
+	sink := &fakeSink{running: true, depth: 10, capacity: 100}
+	h := newHealthHandler(sink, &fakePinger{})
+
+	steps := []struct {
+		name      string
+		apply     func()
+		wantLive  int
+		wantReady int
+		failing   string // readiness check expected to fail
+	}{
+		{
+			name:      "serving",
+			apply:     func() {},
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusOK,
+		},
+		{
+			// Readiness fails first so load balancers stop routing.
+			name:      "draining",
+			apply:     h.health.StartDraining,
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusServiceUnavailable,
+			failing:   "shutdown",
+		},
+		{
+			// The writer stopping during shutdown is expected, not a crash.
+			name:      "writer stopped while draining",
+			apply:     func() { sink.setRunning(false) },
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusServiceUnavailable,
+			failing:   "writer",
+		},
+	}
+	for _, s := range steps {
+		s.apply()
+		if code, resp := probe(t, h.Livez, "/livez"); code != s.wantLive {
+			t.Fatalf("%s: /livez %d (%+v), want %d", s.name, code, resp, s.wantLive)
+		}
+		code, resp := probe(t, h.Readyz, "/readyz")
+		if code != s.wantReady {
+			t.Fatalf("%s: /readyz %d (%+v), want %d", s.name, code, resp, s.wantReady)
+		}
+		if s.failing != "" && resp.Checks[s.failing].OK {
+			t.Fatalf("%s: check %q passed: %+v", s.name, s.failing, resp.Checks)
+		}
+		if wantStatus := map[bool]string{true: "ready", false: "not_ready"}[code == http.StatusOK]; resp.Status != wantStatus {
+			t.Fatalf("%s: status %q, want %q", s.name, resp.Status, wantStatus)
+		}
+	}
+}
+
+func TestLivezWriterDied(t *testing.T) {
+	h := newHealthHandler(&fakeSink{running: false}, nil)
+	if code, _ := probe(t, h.Livez, "/livez"); code != http.StatusServiceUnavailable {
+		t.Fatalf("/livez %d with the writer stopped outside shutdown, want 503", code)
+	}
+}
+
+func TestReadyzChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		sink    *fakeSink
+		dbErr   error
+		failing string
+	}{
+		{name: "healthy", sink: &fakeSink{running: true, depth: 90, capacity: 100}},
+		{name: "database down", sink: &fakeSink{running: true}, dbErr: errors.New("connection refused"), failing: "database"},
+		{name: "queue saturated", sink: &fakeSink{running: true, depth: 91, capacity: 100}, failing: "queue"},
+		{name: "flush errors", sink: &fakeSink{running: true, flushes: 10, failures: 6}, failing: "flush_errors"},
+		// Too few commits to judge the error rate.
+		{name: "few flushes", sink: &fakeSink{running: true, flushes: 4, failures: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHealthHandler(tt.sink, &fakePinger{err: tt.dbErr})
+			code, resp := probe(t, h.Readyz, "/readyz")
+
+			for name, c := range resp.Checks {
+				if c.OK == (name == tt.failing) {
+					t.Errorf("check %q ok = %v", name, c.OK)
+				}
+			}
+			want := http.StatusOK
+			if tt.failing != "" {
+				want = http.StatusServiceUnavailable
+			}
+			if code != want {
+				t.Fatalf("/readyz %d, want %d", code, want)
+			}
+			// A database outage is not a liveness failure.
+			if code, _ := probe(t, h.Livez, "/livez"); code != http.StatusOK {
+				t.Fatalf("/livez %d, want 200", code)
+			}
+		})
+	}
+}
+
+func TestReadyzCachesPing(t *testing.T) {
+	db := &fakePinger{}
+	h := newHealthHandler(&fakeSink{running: true}, db)
+	for range 5 {
+		probe(t, h.Readyz, "/readyz")
+	}
+	if db.calls != 1 {
+		t.Fatalf("%d pings for 5 probes within pingTTL, want 1", db.calls)
+	}
+}
@@ -1,11 +1,14 @@
 package httpserver
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cun0/insider-case/internal/hll"
 	"github.com/cun0/insider-case/internal/repo"
 )
 
@@ -23,38 +26,66 @@ func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	now := h.clock().UTC()
-
-	from, ok, err := parseUnixParam(q.Get("from"))
+	// If not provided: default last 1 hour.
+	from, to, err := parseTimeRange(q, h.clock(), time.Hour)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid from")
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	to, ok2, err := parseUnixParam(q.Get("to"))
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid to")
+
+	channel := strings.TrimSpace(q.Get("channel")) // optional filter
+
+	f := repo.MetricsFilter{EventName: eventName, From: from, To: to, Channel: channel}
+	if err := parseMetricsFilters(q, &f); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// If not provided: default last 1 hour.
-	if !ok2 {
-		to = now
+	dims, err := parseGroupBy(q.Get("group_by"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	if !ok {
-		from = to.Add(-1 * time.Hour)
+	// Without limit every group is returned, ordered by value.
+	topN := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxBreakdownLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxBreakdownLimit))
+			return
+		}
+		topN = n
 	}
 
-	from = from.UTC()
-	to = to.UTC()
+	agg, err := parseAggregate(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if !from.Before(to) {
-		writeError(w, http.StatusBadRequest, "from must be < to")
+	acc := repo.AccuracyExact
+	if v := strings.TrimSpace(q.Get("accuracy")); v != "" {
+		if acc, err = repo.ParseAccuracy(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if acc == repo.AccuracyApprox && !f.Rollupable(dims, agg) {
+		writeError(w, http.StatusBadRequest, "accuracy=approx only supports channel and campaign_id filters and group_by, without field/agg")
 		return
 	}
 
-	channel := strings.TrimSpace(q.Get("channel")) // optional filter
+	interval, loc, err := parseSeriesParams(q.Get("interval"), q.Get("tz"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if interval > 0 && int(to.Sub(from)/interval)+1 > maxSeriesBuckets {
+		writeError(w, http.StatusBadRequest, "too many buckets: use a larger interval or a shorter range")
+		return
+	}
 
-	totals, err := h.metrics.Totals(r.Context(), eventName, from, to, channel)
+	totals, err := h.metrics.Totals(r.Context(), f, agg, acc)
 	if err != nil {
 		h.logger.PrintError(err, map[string]string{
 			"component": "get_metrics",
@@ -63,7 +94,7 @@ func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	byChannel, err := h.metrics.ByChannel(r.Context(), eventName, from, to, channel)
+	groups, err := h.metrics.Breakdown(r.Context(), f, agg, acc, dims, topN)
 	if err != nil {
 		h.logger.PrintError(err, map[string]string{
 			"component": "get_metrics",
@@ -72,19 +103,30 @@ func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type channelRow struct {
-		Channel string `json:"channel"`
-		Total   int64  `json:"total"`
-		Unique  int64  `json:"unique"`
+	// One object per group, keyed by dimension name so the default
+	// group_by=channel keeps its {"channel", "total", "unique"} shape.
+	out := make([]map[string]any, 0, len(groups))
+	for _, g := range groups {
+		row := make(map[string]any, len(dims)+2)
+		for i, d := range dims {
+			switch {
+			case g.Other[i]:
+				row[d.String()] = otherBucket
+			case g.Values[i] == nil:
+				row[d.String()] = nil
+			default:
+				row[d.String()] = *g.Values[i]
+			}
+		}
+		row["total"] = g.Total
+		row["unique"] = g.Unique
+		addAggs(row, agg, g.Aggs)
+		out = append(out, row)
 	}
 
-	out := make([]channelRow, 0, len(byChannel))
-	for _, r := range byChannel {
-		out = append(out, channelRow{
-			Channel: r.Channel,
-			Total:   r.Total,
-			Unique:  r.Unique,
-		})
+	groupBy := make([]string, len(dims))
+	for i, d := range dims {
+		groupBy[i] = d.String()
 	}
 
 	resp := map[string]any{
@@ -93,17 +135,256 @@ func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 		"to":         to.Unix(),
 		"total":      totals.Total,
 		"unique":     totals.Unique,
-		"group_by":   "channel",
+		"accuracy":   acc,
+		"group_by":   strings.Join(groupBy, ","),
 		"breakdown":  out,
 	}
+	if acc == repo.AccuracyApprox {
+		// The estimator's asymptotic relative standard error, the same for
+		// every unique value in the response (not a per-value bound).
+		resp["unique_relative_std_error"] = hll.RelativeStdError
+	}
 
 	if channel != "" {
 		resp["channel"] = channel
 	}
+	if len(agg.Funcs) > 0 {
+		resp["field"] = agg.Field()
+		addAggs(resp, agg, totals.Aggs)
+	}
+	if filters := describeMetricsFilters(f); len(filters) > 0 {
+		resp["filters"] = filters
+	}
+
+	if interval > 0 {
+		buckets, err := h.metrics.Series(r.Context(), f, agg, acc, interval, loc)
+		if err != nil {
+			h.logger.PrintError(err, map[string]string{
+				"component": "get_metrics",
+			})
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		series := make([]map[string]any, 0, len(buckets))
+		for _, b := range buckets {
+			row := map[string]any{"ts": b.Start.Unix(), "total": b.Total, "unique": b.Unique}
+			addAggs(row, agg, b.Aggs)
+			series = append(series, row)
+		}
+
+		resp["interval"] = q.Get("interval")
+		resp["timezone"] = loc.String()
+		resp["series"] = series
+	}
 
 	writeJSON(w, http.StatusOK, resp)
 }
 
+const (
+	maxBreakdownLimit = 1000
+
+	// otherBucket labels the group folding values outside the top limit.
+	otherBucket = "__other__"
+)
+
+// parseGroupBy reads a comma-separated list of dimensions (default channel).
+func parseGroupBy(v string) ([]repo.Dimension, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		v = string(repo.DimChannel)
+	}
+
+	parts := strings.Split(v, ",")
+	if len(parts) > repo.MaxDimensions {
+		return nil, errors.New("group_by accepts at most " + strconv.Itoa(repo.MaxDimensions) + " dimensions")
+	}
+	dims := make([]repo.Dimension, 0, len(parts))
+	seen := make(map[string]bool, len(parts))
+	for _, p := range parts {
+		d, err := repo.ParseDimension(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		if seen[d.String()] {
+			return nil, errors.New("duplicate group_by dimension " + strconv.Quote(d.String()))
+		}
+		seen[d.String()] = true
+		dims = append(dims, d)
+	}
+	return dims, nil
+}
+
+const (
+	maxFilterValues    = 100
+	maxMetadataFilters = 10
+)
+
+// parseMetricsFilters reads campaign_id, tags_any and tags_all (comma
+// separated or repeated) and filter=metadata.<path><op><value> (repeated,
+// ANDed) into f.
+func parseMetricsFilters(q url.Values, f *repo.MetricsFilter) error {
+	var err error
+	if f.CampaignIDs, err = listParam(q, "campaign_id"); err != nil {
+		return err
+	}
+	if f.TagsAny, err = listParam(q, "tags_any"); err != nil {
+		return err
+	}
+	if f.TagsAll, err = listParam(q, "tags_all"); err != nil {
+		return err
+	}
+
+	raw := q["filter"]
+	if len(raw) > maxMetadataFilters {
+		return errors.New("at most " + strconv.Itoa(maxMetadataFilters) + " filter parameters")
+	}
+	for _, v := range raw {
+		p, err := repo.ParseMetadataPredicate(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		f.Metadata = append(f.Metadata, p)
+	}
+	return nil
+}
+
+func listParam(q url.Values, name string) ([]string, error) {
+	var out []string
+	for _, v := range q[name] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	if len(out) > maxFilterValues {
+		return nil, errors.New(name + " accepts at most " + strconv.Itoa(maxFilterValues) + " values")
+	}
+	return out, nil
+}
+
+// describeMetricsFilters echoes the optional filters in the response.
+func describeMetricsFilters(f repo.MetricsFilter) map[string]any {
+	out := map[string]any{}
+	if len(f.CampaignIDs) > 0 {
+		out["campaign_id"] = f.CampaignIDs
+	}
+	if len(f.TagsAny) > 0 {
+		out["tags_any"] = f.TagsAny
+	}
+	if len(f.TagsAll) > 0 {
+		out["tags_all"] = f.TagsAll
+	}
+	if len(f.Metadata) > 0 {
+		preds := make([]string, len(f.Metadata))
+		for i, p := range f.Metadata {
+			preds[i] = p.String()
+		}
+		out["metadata"] = preds
+	}
+	return out
+}
+
+// parseAggregate reads field=metadata.<path> and agg (comma separated or
+// repeated). Without field no aggregates are computed.
+func parseAggregate(q url.Values) (repo.Aggregate, error) {
+	field := strings.TrimSpace(q.Get("field"))
+	funcs, err := listParam(q, "agg")
+	if err != nil {
+		return repo.Aggregate{}, err
+	}
+	if field == "" {
+		if len(funcs) > 0 {
+			return repo.Aggregate{}, errors.New("agg requires field")
+		}
+		return repo.Aggregate{}, nil
+	}
+	return repo.ParseAggregate(field, funcs)
+}
+
+// addAggs sets one key per aggregate (e.g. "sum", "p95"); null when no event
+// in the group had a numeric value.
+func addAggs(row map[string]any, agg repo.Aggregate, vals []*float64) {
+	for i, fn := range agg.Funcs {
+		if vals[i] == nil {
+			row[string(fn)] = nil
+		} else {
+			row[string(fn)] = *vals[i]
+		}
+	}
+}
+
+// seriesIntervals are the supported bucket widths for ?interval=.
+var seriesIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// maxSeriesBuckets bounds the response size (1m over a day is 1440).
+const maxSeriesBuckets = 2000
+
+// parseSeriesParams returns interval 0 when no series is requested. tz only
+// changes day buckets; shorter ones are UTC-aligned.
+func parseSeriesParams(intervalParam, tzParam string) (time.Duration, *time.Location, error) {
+	intervalParam = strings.TrimSpace(intervalParam)
+	tzParam = strings.TrimSpace(tzParam)
+	if intervalParam == "" {
+		if tzParam != "" {
+			return 0, nil, errors.New("tz requires interval")
+		}
+		return 0, nil, nil
+	}
+
+	interval, ok := seriesIntervals[intervalParam]
+	if !ok {
+		return 0, nil, errors.New("interval must be one of 1m, 5m, 1h, 1d")
+	}
+
+	loc := time.UTC
+	if tzParam != "" {
+		l, err := time.LoadLocation(tzParam)
+		if err != nil || tzParam == "Local" {
+			return 0, nil, errors.New("invalid tz")
+		}
+		if interval != 24*time.Hour && l != time.UTC {
+			return 0, nil, errors.New("tz is only supported with interval=1d")
+		}
+		loc = l
+	}
+	return interval, loc, nil
+}
+
+// parseTimeRange reads from/to (unix sec or ms). to defaults to now and from
+// to span before to.
+func parseTimeRange(q url.Values, now time.Time, span time.Duration) (from, to time.Time, err error) {
+	from, ok, err := parseUnixParam(q.Get("from"))
+	if err != nil {
+		return from, to, errors.New("invalid from")
+	}
+	to, ok2, err := parseUnixParam(q.Get("to"))
+	if err != nil {
+		return from, to, errors.New("invalid to")
+	}
+
+	if !ok2 {
+		to = now
+	}
+	if !ok {
+		from = to.Add(-span)
+	}
+
+	from = from.UTC()
+	to = to.UTC()
+
+	if !from.Before(to) {
+		return from, to, errors.New("from must be < to")
+	}
+	return from, to, nil
+}
+
 // parseUnixParam accepts seconds or milliseconds.
 // return ok=false if empty.
 func parseUnixParam(v string) (t time.Time, ok bool, err error) {
@@ -124,6 +405,3 @@ func parseUnixParam(v string) (t time.Time, ok bool, err error) {
 
 	return time.Unix(n, 0).UTC(), true, nil
 }
-
-// compile guard (remove if unused in your project)
-var _ = repo.MetricsTotals{}
@@ -1,12 +1,15 @@
 package middleware
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/telemetry"
 )
 
 type statusRecorder struct {
@@ -29,13 +32,55 @@ func (sr *statusRecorder) Write(p []byte) (int, error) {
 	return n, err
 }
 
-func AccessLog(logger *jsonlog.Logger) func(http.Handler) http.Handler {
+// Unwrap lets http.ResponseController reach the underlying writer (Flush, deadlines).
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// accessLogFields lets inner middleware (e.g. Authenticate) add properties
+// to the access log line written by the outer AccessLog.
+type accessLogFields struct {
+	mu    sync.Mutex
+	props map[string]string
+}
+
+type ctxKeyAccessLog struct{}
+
+func setAccessLogField(ctx context.Context, key, val string) {
+	f, ok := ctx.Value(ctxKeyAccessLog{}).(*accessLogFields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	f.props[key] = val
+	f.mu.Unlock()
+}
+
+// AccessLog logs every request and, when latency is non-nil, observes its
+// duration labelled by route pattern, method and status. It must wrap the
+// ServeMux directly so the matched pattern is visible afterwards.
+func AccessLog(logger *jsonlog.Logger, latency *telemetry.HistogramVec) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			sr := &statusRecorder{ResponseWriter: w}
+			extra := &accessLogFields{props: map[string]string{}}
 
-			next.ServeHTTP(sr, r)
+			req := r.WithContext(context.WithValue(r.Context(), ctxKeyAccessLog{}, extra))
+			next.ServeHTTP(sr, req)
+			took := time.Since(start)
+
+			if latency != nil {
+				route := req.Pattern
+				if route == "" {
+					route = "unmatched"
+				}
+				status := sr.status
+				if status == 0 {
+					status = http.StatusOK // nothing written; net/http sends 200
+				}
+				latency.With(route, r.Method, strconv.Itoa(status)).Observe(took.Seconds())
+			}
 
 			props := map[string]string{
 				"request_id":  GetRequestID(r.Context()),
@@ -43,9 +88,14 @@ func AccessLog(logger *jsonlog.Logger) func(http.Handler) http.Handler {
 				"path":        r.URL.Path,
 				"status":      strconv.Itoa(sr.status),
 				"bytes":       strconv.Itoa(sr.bytes),
-				"duration_ms": strconv.FormatInt(time.Since(start).Milliseconds(), 10),
+				"duration_ms": strconv.FormatInt(took.Milliseconds(), 10),
 				"remote_ip":   clientIP(r),
 			}
+			extra.mu.Lock()
+			for k, v := range extra.props {
+				props[k] = v
+			}
+			extra.mu.Unlock()
 
 			logger.PrintInfo("request completed", props)
 		}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+type ctxKeyAPIKey struct{}
+
+// APIKeyStore looks keys up by hash. GetByHash returns domain.ErrNotFound
+// when no key has the hash; any other error is treated as unavailability.
+type APIKeyStore interface {
+	GetByHash(ctx context.Context, hash []byte) (domain.APIKey, error)
+}
+
+// APIKeys resolves presented keys, caching lookups (including misses) for
+// ttl so the database is not hit on every request. Revocations made on this
+// instance apply immediately (Forget); elsewhere within ttl.
+type APIKeys struct {
+	store     APIKeyStore
+	ttl       time.Duration
+	bootstrap []byte
+
+	mu      sync.Mutex
+	entries map[string]keyEntry
+}
+
+type keyEntry struct {
+	key     domain.APIKey
+	found   bool
+	expires time.Time
+}
+
+// maxKeyEntries bounds the cache; random keys from a scanner cannot grow it forever.
+const maxKeyEntries = 10_000
+
+// bootstrapKeyID identifies the key configured via env (it has no DB row).
+const bootstrapKeyID = -1
+
+// NewAPIKeys creates a resolver. A non-empty bootstrap key is accepted with
+// every scope, so the first real keys can be created through the admin API.
+func NewAPIKeys(store APIKeyStore, ttl time.Duration, bootstrap string) *APIKeys {
+	a := &APIKeys{
+		store:   store,
+		ttl:     ttl,
+		entries: make(map[string]keyEntry),
+	}
+	if bootstrap != "" {
+		a.bootstrap = domain.HashAPIKey(bootstrap)
+	}
+	return a
+}
+
+func (a *APIKeys) Resolve(ctx context.Context, plain string) (domain.APIKey, bool, error) {
+	hash := domain.HashAPIKey(plain)
+
+	if a.bootstrap != nil && subtle.ConstantTimeCompare(hash, a.bootstrap) == 1 {
+		return domain.APIKey{ID: bootstrapKeyID, Name: "bootstrap", Scopes: domain.AllScopes}, true, nil
+	}
+
+	now := time.Now()
+	ck := string(hash)
+
+	a.mu.Lock()
+	e, ok := a.entries[ck]
+	a.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.key, e.found, nil
+	}
+
+	k, err := a.store.GetByHash(ctx, hash)
+	found := err == nil
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		// Keep serving a known key while the database is unavailable.
+		if ok && e.found {
+			return e.key, true, nil
+		}
+		return domain.APIKey{}, false, err
+	}
+
+	a.mu.Lock()
+	if len(a.entries) >= maxKeyEntries {
+		a.entries = make(map[string]keyEntry)
+	}
+	a.entries[ck] = keyEntry{key: k, found: found, expires: now.Add(a.ttl)}
+	a.mu.Unlock()
+
+	return k, found, nil
+}
+
+// Forget drops cached entries for a key id (e.g. right after revoking it).
+func (a *APIKeys) Forget(id int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for ck, e := range a.entries {
+		if e.found && e.key.ID == id {
+			delete(a.entries, ck)
+		}
+	}
+}
+
+// Authenticate requires a valid, unrevoked key in "Authorization: Bearer <key>"
+// or "X-API-Key". The key is stored in the context and recorded in the access log.
+func Authenticate(keys *APIKeys, logger *jsonlog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			plain := presentedKey(r)
+			if plain == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="event-ingest"`)
+				writeJSONError(w, http.StatusUnauthorized, "missing API key")
+				return
+			}
+
+			k, found, err := keys.Resolve(r.Context(), plain)
+			if err != nil {
+				logger.PrintError(err, map[string]string{
+					"request_id": GetRequestID(r.Context()),
+					"component":  "auth",
+				})
+				writeJSONError(w, http.StatusServiceUnavailable, "authentication temporarily unavailable")
+				return
+			}
+			if !found || k.Revoked() {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="event-ingest", error="invalid_token"`)
+				writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+				return
+			}
+
+			setAccessLogField(r.Context(), "api_key_id", formatKeyID(k.ID))
+			ctx := context.WithValue(r.Context(), ctxKeyAPIKey{}, k)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequireScope must run after Authenticate.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			k, ok := GetAPIKey(r.Context())
+			if !ok || !k.HasScope(scope) {
+				writeJSONError(w, http.StatusForbidden, "API key lacks scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func GetAPIKey(ctx context.Context) (domain.APIKey, bool) {
+	k, ok := ctx.Value(ctxKeyAPIKey{}).(domain.APIKey)
+	return k, ok
+}
+
+func presentedKey(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+func formatKeyID(id int64) string {
+	if id == bootstrapKeyID {
+		return "bootstrap"
+	}
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Decompress honors Content-Encoding gzip/zstd on request bodies. The
+// decompressed body is capped at maxBytes (<= 0 means no cap) so a small
+// compressed body cannot expand without bound; the compressed size is
+// still limited by BodyLimit in front of this middleware.
+// Unsupported encodings get 415.
+func Decompress(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+			var body io.ReadCloser
+			switch enc {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+
+			case "gzip", "x-gzip":
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					writeJSONError(w, http.StatusBadRequest, "invalid gzip body")
+					return
+				}
+				body = &decodedBody{Reader: zr, close: func() { _ = zr.Close() }, raw: r.Body}
+
+			case "zstd":
+				zr, err := zstd.NewReader(r.Body,
+					zstd.WithDecoderConcurrency(1),
+					zstd.WithDecoderMaxWindow(8<<20),
+				)
+				if err != nil {
+					writeJSONError(w, http.StatusBadRequest, "invalid zstd body")
+					return
+				}
+				body = &decodedBody{Reader: zr, close: zr.Close, raw: r.Body}
+
+			default:
+				writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported content encoding (allowed: gzip, zstd)")
+				return
+			}
+
+			if maxBytes > 0 {
+				body = http.MaxBytesReader(w, body, maxBytes)
+			}
+
+			r.Body = body
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+type decodedBody struct {
+	io.Reader
+	close func()
+	raw   io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	b.close()
+	return b.raw.Close()
+}
+
+// writeJSONError mirrors the {"error": "..."} shape used by the handlers.
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": msg})
+}
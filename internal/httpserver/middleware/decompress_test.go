@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zw.Close()
+	return zw.EncodeAll(data, nil)
+}
+
+func TestDecompress(t *testing.T) {
+	const limit = 1 << 10
+	plain := []byte(`{"event_name":"purchase"}`)
+	big := bytes.Repeat([]byte("a"), limit+1)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		wantCode int
+		wantBody string
+		// wantReadErr is set when the handler sees a read error.
+		wantReadErr bool
+		wantTooBig  bool
+	}{
+		{name: "none", body: plain, wantCode: http.StatusOK, wantBody: string(plain)},
+		{name: "identity", encoding: "identity", body: plain, wantCode: http.StatusOK, wantBody: string(plain)},
+		{name: "gzip", encoding: "gzip", body: gzipBytes(t, plain), wantCode: http.StatusOK, wantBody: string(plain)},
+		{name: "x-gzip", encoding: "x-gzip", body: gzipBytes(t, plain), wantCode: http.StatusOK, wantBody: string(plain)},
+		{name: "case and spaces", encoding: " GZIP ", body: gzipBytes(t, plain), wantCode: http.StatusOK, wantBody: string(plain)},
+		{name: "zstd", encoding: "zstd", body: zstdBytes(t, plain), wantCode: http.StatusOK, wantBody: string(plain)},
+		{name: "unsupported", encoding: "br", body: plain, wantCode: http.StatusUnsupportedMediaType},
+		{name: "invalid gzip header", encoding: "gzip", body: plain, wantCode: http.StatusBadRequest},
+		{name: "invalid zstd", encoding: "zstd", body: plain, wantCode: http.StatusOK, wantReadErr: true},
+		{name: "gzip at the limit", encoding: "gzip", body: gzipBytes(t, big[:limit]), wantCode: http.StatusOK, wantBody: string(big[:limit])},
+		{name: "gzip over the limit", encoding: "gzip", body: gzipBytes(t, big), wantCode: http.StatusOK, wantReadErr: true, wantTooBig: true},
+		{name: "zstd over the limit", encoding: "zstd", body: zstdBytes(t, big), wantCode: http.StatusOK, wantReadErr: true, wantTooBig: true},
+		// The limit is on the decoded size only.
+		{name: "plain over the limit", body: big, wantCode: http.StatusOK, wantBody: string(big)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got     []byte
+				readErr error
+				headers http.Header
+				length  int64
+			)
+			h := Decompress(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, readErr = io.ReadAll(r.Body)
+				_ = r.Body.Close()
+				headers, length = r.Header, r.ContentLength
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), `"error"`) {
+					t.Fatalf("body %q, want a JSON error", rec.Body)
+				}
+				return
+			}
+			if (readErr != nil) != tt.wantReadErr {
+				t.Fatalf("read error %v, want error = %v", readErr, tt.wantReadErr)
+			}
+			var tooBig *http.MaxBytesError
+			if errors.As(readErr, &tooBig) != tt.wantTooBig {
+				t.Fatalf("read error %v, want MaxBytesError = %v", readErr, tt.wantTooBig)
+			}
+			if tt.wantReadErr {
+				return
+			}
+			if string(got) != tt.wantBody {
+				t.Fatalf("body %q, want %q", got, tt.wantBody)
+			}
+			if tt.encoding != "" && tt.encoding != "identity" {
+				if headers.Get("Content-Encoding") != "" || length != -1 {
+					t.Fatalf("Content-Encoding %q, ContentLength %d after decoding", headers.Get("Content-Encoding"), length)
+				}
+			}
+		})
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDecompressClosesRawBody(t *testing.T) {
+	for _, enc := range []string{"gzip", "zstd"} {
+		t.Run(enc, func(t *testing.T) {
+			data := []byte("payload")
+			if enc == "gzip" {
+				data = gzipBytes(t, data)
+			} else {
+				data = zstdBytes(t, data)
+			}
+			raw := &closeRecorder{Reader: bytes.NewReader(data)}
+
+			h := Decompress(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.ReadAll(r.Body)
+				_ = r.Body.Close()
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/events", nil)
+			req.Body = raw
+			req.Header.Set("Content-Encoding", enc)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !raw.closed {
+				t.Fatal("raw body not closed")
+			}
+		})
+	}
+}
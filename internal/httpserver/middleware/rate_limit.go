@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiter is a set of token buckets (one per client) sharing a rate and burst.
+// Clients are identified by API key when authenticated, otherwise by IP.
+type Limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns nil (no limiting) when rate <= 0.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take removes n tokens if available. It reports the tokens left and, when
+// refused, how long until n tokens will be available. n is capped at burst so
+// a single large request can always pass on a full bucket.
+func (l *Limiter) take(key string, n float64, now time.Time) (ok bool, remaining float64, wait time.Duration) {
+	if n > l.burst {
+		n = l.burst
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= n {
+		b.tokens -= n
+		return true, b.tokens, 0
+	}
+	return false, b.tokens, time.Duration((n - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweepLocked drops buckets that have refilled completely (they are
+// indistinguishable from new ones), at most once a minute.
+func (l *Limiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+type ctxKeyRateLimit struct{}
+
+type rateCharge struct {
+	l   *Limiter
+	key string
+}
+
+// RateLimit charges one token per request against l. Run it after
+// Authenticate so the bucket is keyed by API key. Handlers whose cost depends
+// on the body (bulk, stream) charge the rest via ChargeRate / WaitRate.
+// A nil limiter disables limiting.
+func RateLimit(l *Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := rateKey(r)
+
+			ok, remaining, wait := l.take(key, 1, time.Now())
+			setRateHeaders(w, l, remaining)
+			if !ok {
+				writeTooManyRequests(w, wait)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ctxKeyRateLimit{}, rateCharge{l: l, key: key})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// ChargeRate takes n more tokens for this request (e.g. the number of events
+// in a bulk body beyond the one already charged). On refusal it writes 429
+// and returns false.
+func ChargeRate(w http.ResponseWriter, r *http.Request, n int) bool {
+	c, ok := r.Context().Value(ctxKeyRateLimit{}).(rateCharge)
+	if !ok || n <= 0 {
+		return true
+	}
+
+	allowed, remaining, wait := c.l.take(c.key, float64(n), time.Now())
+	setRateHeaders(w, c.l, remaining)
+	if !allowed {
+		writeTooManyRequests(w, wait)
+		return false
+	}
+	return true
+}
+
+// WaitRate blocks until n tokens are available for this request, pacing
+// long-running streams instead of rejecting them mid-body.
+func WaitRate(ctx context.Context, n int) error {
+	c, ok := ctx.Value(ctxKeyRateLimit{}).(rateCharge)
+	if !ok {
+		return nil
+	}
+
+	for n > 0 {
+		step := min(n, int(c.l.burst))
+		allowed, _, wait := c.l.take(c.key, float64(step), time.Now())
+		if allowed {
+			n -= step
+			continue
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
+func rateKey(r *http.Request) string {
+	if k, ok := GetAPIKey(r.Context()); ok {
+		return "key:" + formatKeyID(k.ID)
+	}
+	return "ip:" + clientIP(r)
+}
+
+func setRateHeaders(w http.ResponseWriter, l *Limiter, remaining float64) {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(int(l.burst)))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	// seconds until the bucket is full again
+	h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil((l.burst-remaining)/l.rate))))
+}
+
+func writeTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+)
+
+func TestLimiterTake(t *testing.T) {
+	type step struct {
+		after         time.Duration // since the previous step
+		n             float64
+		wantOK        bool
+		wantRemaining float64
+		wantWait      time.Duration
+	}
+	// 10 tokens per second, burst 5.
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then refuse",
+			steps: []step{
+				{n: 1, wantOK: true, wantRemaining: 4},
+				{n: 4, wantOK: true, wantRemaining: 0},
+				{n: 1, wantOK: false, wantRemaining: 0, wantWait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name: "refill",
+			steps: []step{
+				{n: 5, wantOK: true, wantRemaining: 0},
+				{after: 200 * time.Millisecond, n: 3, wantOK: false, wantRemaining: 2, wantWait: 100 * time.Millisecond},
+				{after: 100 * time.Millisecond, n: 3, wantOK: true, wantRemaining: 0},
+			},
+		},
+		{
+			name: "refill stops at burst",
+			steps: []step{
+				{n: 1, wantOK: true, wantRemaining: 4},
+				{after: time.Hour, n: 0, wantOK: true, wantRemaining: 5},
+			},
+		},
+		{
+			// A request larger than the burst passes on a full bucket.
+			name: "n capped at burst",
+			steps: []step{
+				{n: 50, wantOK: true, wantRemaining: 0},
+				{after: 100 * time.Millisecond, n: 50, wantOK: false, wantRemaining: 1, wantWait: 400 * time.Millisecond},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(10, 5)
+			now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				ok, remaining, wait := l.take("k", s.n, now)
+				if ok != s.wantOK || !near(remaining, s.wantRemaining) || !near(wait.Seconds(), s.wantWait.Seconds()) {
+					t.Fatalf("step %d: take = %v, %.3f, %s; want %v, %.3f, %s",
+						i, ok, remaining, wait, s.wantOK, s.wantRemaining, s.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestLimiterKeysAndSweep(t *testing.T) {
+	l := NewLimiter(1, 2)
+	// Sweeps are timed from construction on the wall clock.
+	now := time.Now()
+
+	for range 2 {
+		if ok, _, _ := l.take("a", 1, now); !ok {
+			t.Fatal("a refused within its burst")
+		}
+	}
+	if ok, _, _ := l.take("a", 1, now); ok {
+		t.Fatal("a allowed past its burst")
+	}
+	// Each client has its own bucket.
+	if ok, _, _ := l.take("b", 1, now); !ok {
+		t.Fatal("b refused because of a")
+	}
+
+	// A minute later both buckets are full again and are swept.
+	now = now.Add(time.Minute + time.Second)
+	l.take("c", 1, now)
+	if _, ok := l.buckets["a"]; ok {
+		t.Fatal("full bucket a kept after sweep")
+	}
+	if len(l.buckets) != 1 {
+		t.Fatalf("%d buckets after sweep, want only c", len(l.buckets))
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	if NewLimiter(0, 10) != nil {
+		t.Fatal("rate 0 should disable limiting")
+	}
+	if l := NewLimiter(1, 0); l.burst != 1 {
+		t.Fatalf("burst = %v, want at least 1", l.burst)
+	}
+
+	// A nil limiter passes requests through untouched.
+	called := false
+	h := RateLimit(nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !called {
+		t.Fatal("nil limiter blocked the request")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := NewLimiter(1, 3)
+	var bulkOK bool
+	h := RateLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := r.URL.Query().Get("events"); n != "" {
+			bulkOK = ChargeRate(w, r, len(n)-1)
+		}
+	}))
+
+	do := func(target, ip string, key *domain.APIKey) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.RemoteAddr = ip + ":1234"
+		if key != nil {
+			req = req.WithContext(context.WithValue(req.Context(), ctxKeyAPIKey{}, *key))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// One token for the request, two more for a three-event body.
+	rec := do("/events/bulk?events=xxx", "10.0.0.1", nil)
+	if rec.Code != http.StatusOK || !bulkOK {
+		t.Fatalf("status %d, charged %v", rec.Code, bulkOK)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Fatalf("RateLimit-Remaining = %q, want 0", got)
+	}
+	if got := rec.Header().Get("RateLimit-Limit"); got != "3" {
+		t.Fatalf("RateLimit-Limit = %q, want 3", got)
+	}
+
+	rec = do("/events", "10.0.0.1", nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Fatalf("Retry-After = %q, want 1", got)
+	}
+
+	// Other IPs and API keys have their own buckets; a key is not limited
+	// by the IP it connects from.
+	if rec := do("/events", "10.0.0.2", nil); rec.Code != http.StatusOK {
+		t.Fatalf("other IP: status %d", rec.Code)
+	}
+	if rec := do("/events", "10.0.0.1", &domain.APIKey{ID: 7}); rec.Code != http.StatusOK {
+		t.Fatalf("API key: status %d", rec.Code)
+	}
+}
@@ -6,9 +6,17 @@ import (
 	"time"
 )
 
-func Timeout(d time.Duration) func(http.Handler) http.Handler {
+// Timeout bounds every request by d, except for skipPaths (long-lived
+// streaming endpoints that manage their own deadlines).
+func Timeout(d time.Duration, skipPaths ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range skipPaths {
+				if r.URL.Path == p {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
 			ctx, cancel := context.WithTimeout(r.Context(), d)
 			defer cancel()
 			next.ServeHTTP(w, r.WithContext(ctx))
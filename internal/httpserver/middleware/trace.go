@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cun0/insider-case/internal/telemetry"
+)
+
+// Trace starts a server span per request, continuing an incoming W3C
+// traceparent, and returns the span's own traceparent in the response.
+// It must wrap the ServeMux directly so the span can be named after the
+// matched route; the trace id is added to the access log line, and the
+// matched pattern is copied back onto r so AccessLog still sees it.
+// A nil tracer disables it.
+func Trace(tracer *telemetry.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if tracer == nil {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			opts := []telemetry.SpanOption{telemetry.WithKind(telemetry.SpanKindServer)}
+			if remote, ok := telemetry.ParseTraceparent(r.Header.Get("traceparent")); ok {
+				opts = append(opts, telemetry.WithRemoteParent(remote))
+			}
+
+			ctx, span := tracer.Start(r.Context(), r.Method, opts...)
+			defer span.End()
+
+			sc := span.Context()
+			w.Header().Set("traceparent", sc.Traceparent())
+			setAccessLogField(ctx, "trace_id", sc.TraceID.String())
+
+			sr := &statusRecorder{ResponseWriter: w}
+			req := r.WithContext(ctx)
+			next.ServeHTTP(sr, req)
+			// The mux sets Pattern on this copy of the request.
+			r.Pattern = req.Pattern
+
+			status := sr.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if req.Pattern != "" {
+				span.SetName(r.Method + " " + req.Pattern)
+				span.SetAttr("http.route", req.Pattern)
+			}
+			span.SetAttr("http.request.method", r.Method)
+			span.SetAttr("url.path", r.URL.Path)
+			span.SetAttr("http.response.status_code", status)
+			span.SetAttr("request_id", GetRequestID(ctx))
+			if status >= 500 {
+				span.SetError(errStatus(status))
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+type errStatus int
+
+func (e errStatus) Error() string { return "HTTP " + strconv.Itoa(int(e)) }
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/telemetry"
+)
+
+type discardExporter struct{}
+
+func (discardExporter) Export(context.Context, string, []*telemetry.Span) error { return nil }
+func (discardExporter) Close() error                                            { return nil }
+
+// With tracing on, Trace sits between AccessLog and the mux; the latency
+// histogram must still be labelled with the matched route.
+func TestAccessLogSeesPatternThroughTrace(t *testing.T) {
+	logger := jsonlog.New(io.Discard, jsonlog.LevelError)
+	tracer := telemetry.NewTracer("test", 1, discardExporter{}, logger)
+	defer tracer.Shutdown(context.Background())
+
+	reg := telemetry.NewRegistry()
+	latency := reg.NewHistogramVec("http_request_duration_seconds", "test", []float64{1}, "route", "method", "status")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/things/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	var h http.Handler = mux
+	h = Trace(tracer)(h)
+	h = AccessLog(logger, latency)(h)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/42", nil))
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/metrics", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `route="/things/{id}"`) {
+		t.Fatalf("latency not labelled with the route:\n%s", body)
+	}
+	if strings.Contains(body, `route="unmatched"`) {
+		t.Fatalf("request labelled unmatched:\n%s", body)
+	}
+}
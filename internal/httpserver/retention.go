@@ -0,0 +1,146 @@
+package httpserver
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cun0/insider-case/internal/repo"
+)
+
+var retentionMaxPeriods = map[repo.RetentionPeriod]int{
+	repo.RetentionDay:  90,
+	repo.RetentionWeek: 52,
+}
+
+const defaultRetentionPeriods = 8
+
+// GET /retention?cohort_event=signup&return_event=purchase&period=week&periods=8&from=&to=&tz=
+// plus the /metrics filters (channel, campaign_id, tags_any, tags_all, filter).
+func (h *Handler) GetRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+
+	rq := repo.RetentionQuery{
+		CohortEvent: strings.TrimSpace(q.Get("cohort_event")),
+		ReturnEvent: strings.TrimSpace(q.Get("return_event")),
+		Period:      repo.RetentionPeriod(strings.TrimSpace(q.Get("period"))),
+		Periods:     defaultRetentionPeriods,
+		Location:    time.UTC,
+		Now:         h.clock().UTC(),
+	}
+	if rq.CohortEvent == "" {
+		writeError(w, http.StatusBadRequest, "cohort_event is required")
+		return
+	}
+	if rq.ReturnEvent == "" {
+		rq.ReturnEvent = rq.CohortEvent
+	}
+	if rq.Period == "" {
+		rq.Period = repo.RetentionWeek
+	}
+	maxPeriods, ok := retentionMaxPeriods[rq.Period]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "period must be day or week")
+		return
+	}
+	if v := q.Get("periods"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxPeriods {
+			writeError(w, http.StatusBadRequest, "periods must be between 1 and "+strconv.Itoa(maxPeriods)+" for period="+string(rq.Period))
+			return
+		}
+		rq.Periods = n
+	}
+
+	if v := strings.TrimSpace(q.Get("tz")); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil || v == "Local" {
+			writeError(w, http.StatusBadRequest, "invalid tz")
+			return
+		}
+		rq.Location = loc
+	}
+
+	// Default: cohorts over the last Periods periods (a full triangle).
+	periodLen := 24 * time.Hour
+	if rq.Period == repo.RetentionWeek {
+		periodLen *= 7
+	}
+	from, to, err := parseTimeRange(q, rq.Now, time.Duration(rq.Periods)*periodLen)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if to.Sub(from) > time.Duration(maxPeriods)*periodLen {
+		writeError(w, http.StatusBadRequest, "range covers more than "+strconv.Itoa(maxPeriods)+" cohorts")
+		return
+	}
+	rq.From, rq.To = from, to
+
+	rq.Filter.Channel = strings.TrimSpace(q.Get("channel"))
+	if err := parseMetricsFilters(q, &rq.Filter); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cohorts, err := h.metrics.Retention(r.Context(), rq)
+	if err != nil {
+		h.logger.PrintError(err, map[string]string{
+			"component": "get_retention",
+		})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	type cohortRow struct {
+		Start       int64      `json:"cohort_start"`
+		Users       int64      `json:"users"`
+		Counts      []*int64   `json:"counts"`
+		Percentages []*float64 `json:"percentages"`
+	}
+	out := make([]cohortRow, 0, len(cohorts))
+	for _, c := range cohorts {
+		row := cohortRow{
+			Start:       c.Start.Unix(),
+			Users:       c.Users,
+			Counts:      c.Returned,
+			Percentages: make([]*float64, len(c.Returned)),
+		}
+		for k, n := range c.Returned {
+			if n == nil {
+				continue
+			}
+			var pct float64
+			if c.Users > 0 {
+				pct = math.Round(float64(*n)/float64(c.Users)*10000) / 100
+			}
+			row.Percentages[k] = &pct
+		}
+		out = append(out, row)
+	}
+
+	resp := map[string]any{
+		"cohort_event": rq.CohortEvent,
+		"return_event": rq.ReturnEvent,
+		"period":       rq.Period,
+		"periods":      rq.Periods,
+		"from":         from.Unix(),
+		"to":           to.Unix(),
+		"timezone":     rq.Location.String(),
+		"cohorts":      out,
+	}
+	if rq.Filter.Channel != "" {
+		resp["channel"] = rq.Filter.Channel
+	}
+	if filters := describeMetricsFilters(rq.Filter); len(filters) > 0 {
+		resp["filters"] = filters
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -4,44 +4,144 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/cun0/insider-case/internal/domain"
 	"github.com/cun0/insider-case/internal/httpserver/middleware"
 	"github.com/cun0/insider-case/internal/ingest"
 	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/telemetry"
 )
 
 type Config struct {
 	RequestTimeout time.Duration
+	Auth           AuthConfig
+	RateLimit      RateLimitConfig
+
+	// Telemetry, when set, is served on /internal/metrics and records
+	// per-route request latency.
+	Telemetry *telemetry.Registry
+	// Tracer, when set, creates a server span per request.
+	Tracer *telemetry.Tracer
+
+	// Health backs /readyz; pass the same value to Serve.
+	Health *Health
+
+	// MaxEventAge rejects events with an older timestamp with 400; 0 accepts
+	// any past timestamp (the default).
+	MaxEventAge time.Duration
 }
 
-func BuildHandler(cfg Config, logger *jsonlog.Logger, sink ingest.Sink, events EventBatchStore, metrics MetricsStore) http.Handler {
-	h := New(logger, sink, events, metrics)
+type AuthConfig struct {
+	Enabled      bool
+	BootstrapKey string
+	CacheTTL     time.Duration
+}
 
-	mux := http.NewServeMux()
+// RateLimitConfig is per route class; a zero Rate disables that limit.
+type RateLimitConfig struct {
+	Ingest  RateLimit
+	Metrics RateLimit
+	Admin   RateLimit
+}
+
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func BuildHandler(cfg Config, logger *jsonlog.Logger, sink ingest.Sink, events EventStore, metrics MetricsStore, deadLetters DeadLetterStore, apiKeys APIKeyStore) http.Handler {
+	h := New(logger, sink, events, metrics, deadLetters, apiKeys)
+	h.health = cfg.Health
+	h.maxEventAge = cfg.MaxEventAge
+
+	// protect requires an API key with scope; a no-op when auth is disabled.
+	protect := func(scope string, next http.Handler) http.Handler { return next }
+	if cfg.Auth.Enabled {
+		h.keyCache = middleware.NewAPIKeys(apiKeys, cfg.Auth.CacheTTL, cfg.Auth.BootstrapKey)
+		authn := middleware.Authenticate(h.keyCache, logger)
+		protect = func(scope string, next http.Handler) http.Handler {
+			return authn(middleware.RequireScope(scope)(next))
+		}
+	}
 
 	const (
 		maxEventsBody     = 256 << 10 // 256KB
 		maxEventsBulkBody = 5 << 20   // 5MB
+		maxAdminBody      = 64 << 10  // 64KB
+	)
+
+	// One bucket set per route class, keyed by API key (client IP when auth
+	// is disabled). Limiting runs after authentication.
+	var (
+		ingestLimit  = middleware.RateLimit(middleware.NewLimiter(cfg.RateLimit.Ingest.Rate, cfg.RateLimit.Ingest.Burst))
+		metricsLimit = middleware.RateLimit(middleware.NewLimiter(cfg.RateLimit.Metrics.Rate, cfg.RateLimit.Metrics.Burst))
+		adminLimit   = middleware.RateLimit(middleware.NewLimiter(cfg.RateLimit.Admin.Rate, cfg.RateLimit.Admin.Burst))
 	)
+	admin := func(h http.HandlerFunc) http.Handler {
+		return protect(domain.ScopeAdmin, adminLimit(middleware.BodyLimit(maxAdminBody)(h)))
+	}
+
+	mux := http.NewServeMux()
 
 	mux.HandleFunc("/healthz", h.Healthz)
+	mux.HandleFunc("/livez", h.Livez)
+	mux.HandleFunc("/readyz", h.Readyz)
 
-	mux.Handle("/events",
+	// Pipeline internals for Prometheus; unauthenticated like /healthz (it
+	// carries no event data), so keep it off the public listener in production.
+	var latency *telemetry.HistogramVec
+	if cfg.Telemetry != nil {
+		latency = cfg.Telemetry.NewHistogramVec("http_request_duration_seconds",
+			"HTTP request latency by route pattern, method and status.",
+			nil, "route", "method", "status")
+		mux.Handle("/internal/metrics", cfg.Telemetry.Handler())
+	}
+
+	// BodyLimit caps the compressed size, Decompress the decompressed size.
+	mux.Handle("/events", protect(domain.ScopeIngest, ingestLimit(
 		middleware.BodyLimit(maxEventsBody)(
-			http.HandlerFunc(h.PostEvent),
+			middleware.Decompress(maxEventsBody)(
+				http.HandlerFunc(h.PostEvent),
+			),
 		),
-	)
+	)))
 
-	mux.Handle("/events/bulk",
+	// Bulk and stream charge one token per event (see ChargeRate / WaitRate).
+	mux.Handle("/events/bulk", protect(domain.ScopeIngest, ingestLimit(
 		middleware.BodyLimit(maxEventsBulkBody)(
-			http.HandlerFunc(h.PostEventsBulk),
+			middleware.Decompress(maxEventsBulkBody)(
+				http.HandlerFunc(h.PostEventsBulk),
+			),
 		),
-	)
+	)))
+
+	// No overall body cap: the stream handler enforces a per-line limit.
+	mux.Handle("/events/stream", protect(domain.ScopeIngest, ingestLimit(
+		middleware.Decompress(0)(
+			http.HandlerFunc(h.PostEventsStream),
+		),
+	)))
+
+	mux.Handle("/metrics", protect(domain.ScopeMetricsRead, metricsLimit(http.HandlerFunc(h.GetMetrics))))
+	mux.Handle("/funnels", protect(domain.ScopeMetricsRead, metricsLimit(http.HandlerFunc(h.GetFunnel))))
+	mux.Handle("/retention", protect(domain.ScopeMetricsRead, metricsLimit(http.HandlerFunc(h.GetRetention))))
+
+	// Event lookups share the read limit with /metrics. /events/bulk and
+	// /events/stream are more specific patterns and still win.
+	mux.Handle("/events/{dedup_key}", protect(domain.ScopeEventsRead, metricsLimit(http.HandlerFunc(h.GetEvent))))
+	mux.Handle("/users/{user_id}/events", protect(domain.ScopeEventsRead, metricsLimit(http.HandlerFunc(h.ListUserEvents))))
+
+	mux.Handle("/admin/dead-letters", admin(h.ListDeadLetters))
+	mux.Handle("/admin/dead-letters/replay", admin(h.ReplayDeadLetters))
+	mux.Handle("/admin/dead-letters/{id}", admin(h.GetDeadLetter))
+	mux.Handle("/admin/dead-letters/{id}/replay", admin(h.ReplayDeadLetter))
 
-	mux.HandleFunc("/metrics", h.GetMetrics)
+	mux.Handle("/admin/api-keys", admin(h.APIKeys))
+	mux.Handle("/admin/api-keys/{id}/revoke", admin(h.RevokeAPIKey))
 
 	var handler http.Handler = mux
-	handler = middleware.AccessLog(logger)(handler)
-	handler = middleware.Timeout(cfg.RequestTimeout)(handler)
+	handler = middleware.Trace(cfg.Tracer)(handler)
+	handler = middleware.AccessLog(logger, latency)(handler)
+	handler = middleware.Timeout(cfg.RequestTimeout, "/events/stream")(handler)
 	handler = middleware.RequestID()(handler)
 	handler = middleware.Recover(logger)(handler)
 
@@ -14,7 +14,10 @@ import (
 	"github.com/cun0/insider-case/internal/jsonlog"
 )
 
-func Serve(cfg config.HTTPConfig, logger *jsonlog.Logger, handler http.Handler, onShutdown func(context.Context) error) error {
+// Serve runs until SIGINT/SIGTERM. On shutdown it first marks health as
+// draining and waits cfg.ShutdownDrainDelay so load balancers see /readyz
+// fail, then runs onShutdown (stopping background workers) and closes the server.
+func Serve(cfg config.HTTPConfig, logger *jsonlog.Logger, handler http.Handler, health *Health, onShutdown func(context.Context) error) error {
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.Port),
 		Handler:           handler,
@@ -36,6 +39,11 @@ func Serve(cfg config.HTTPConfig, logger *jsonlog.Logger, handler http.Handler,
 			"signal": s.String(),
 		})
 
+		health.StartDraining()
+		if cfg.ShutdownDrainDelay > 0 {
+			time.Sleep(cfg.ShutdownDrainDelay)
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
@@ -0,0 +1,136 @@
+package ingest
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// BatchingStats reports the batch shape a writer is currently using.
+type BatchingStats struct {
+	Adaptive bool `json:"adaptive"`
+	// WindowMS and MaxBatch are the values in effect (the configured ones
+	// when not adaptive).
+	WindowMS        float64 `json:"window_ms"`
+	MaxBatch        int     `json:"max_batch"`
+	ArrivalRate     float64 `json:"arrival_rate"` // events/s
+	CommitLatencyMS float64 `json:"commit_latency_ms"`
+}
+
+// batchTuner picks the window and max batch for the next batch from the
+// measured arrival rate and commit latency:
+//
+//   - expected = arrival rate × commit latency is how many events arrive
+//     while one batch commits.
+//   - expected < 1 (idle): flush as soon as an event arrives (MinBatchWindow);
+//     waiting would only add latency.
+//   - otherwise wait up to one commit latency for the batch to fill, and let
+//     the batch grow to 2 × expected so a backlog is taken in one commit.
+//
+// Both are clamped to [MinBatchWindow, BatchWindow] and [MinBatch, MaxBatch].
+// Without adaptive mode the configured BatchWindow and MaxBatch are fixed.
+type batchTuner struct {
+	adaptive             bool
+	minWindow, maxWindow time.Duration
+	minBatch, maxBatch   int
+
+	mu       sync.Mutex
+	window   time.Duration
+	batch    int
+	rate     float64       // EWMA events/s
+	latency  time.Duration // EWMA commit latency
+	arrived  int           // events since last tune
+	lastTune time.Time
+}
+
+// tuneAlpha weights the newest sample in the rate and latency averages.
+const tuneAlpha = 0.3
+
+func newBatchTuner(cfg Config) *batchTuner {
+	t := &batchTuner{
+		adaptive:  cfg.Adaptive,
+		minWindow: cfg.MinBatchWindow,
+		maxWindow: cfg.BatchWindow,
+		minBatch:  cfg.MinBatch,
+		maxBatch:  cfg.MaxBatch,
+		window:    cfg.BatchWindow,
+		batch:     cfg.MaxBatch,
+		lastTune:  time.Now(),
+	}
+	if t.minWindow > t.maxWindow {
+		t.minWindow = t.maxWindow
+	}
+	if t.minBatch <= 0 {
+		t.minBatch = 1
+	}
+	if t.minBatch > t.maxBatch {
+		t.minBatch = t.maxBatch
+	}
+	if t.adaptive {
+		// Start as if idle; the first flushes calibrate.
+		t.window = t.minWindow
+	}
+	return t
+}
+
+// shape returns the window and max batch to use now.
+func (t *batchTuner) shape() (time.Duration, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.window, t.batch
+}
+
+func (t *batchTuner) arrive() {
+	t.mu.Lock()
+	t.arrived++
+	t.mu.Unlock()
+}
+
+// observe records a flush and retunes the shape.
+func (t *batchTuner) observe(commit time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elapsed := now.Sub(t.lastTune).Seconds(); elapsed > 0 {
+		t.rate = ewma(t.rate, float64(t.arrived)/elapsed)
+	}
+	t.arrived = 0
+	t.lastTune = now
+	if t.latency == 0 {
+		t.latency = commit
+	} else {
+		t.latency = time.Duration(ewma(float64(t.latency), float64(commit)))
+	}
+
+	if !t.adaptive {
+		return
+	}
+
+	expected := t.rate * t.latency.Seconds()
+	if expected < 1 {
+		t.window = t.minWindow
+		t.batch = t.maxBatch // cheap to allow; an idle queue will not fill it
+		return
+	}
+	t.window = min(max(t.latency, t.minWindow), t.maxWindow)
+	t.batch = min(max(int(math.Ceil(2*expected)), t.minBatch), t.maxBatch)
+}
+
+func (t *batchTuner) stats() BatchingStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return BatchingStats{
+		Adaptive:        t.adaptive,
+		WindowMS:        float64(t.window) / float64(time.Millisecond),
+		MaxBatch:        t.batch,
+		ArrivalRate:     math.Round(t.rate*10) / 10,
+		CommitLatencyMS: float64(t.latency) / float64(time.Millisecond),
+	}
+}
+
+func ewma(old, sample float64) float64 {
+	if old == 0 {
+		return sample
+	}
+	return tuneAlpha*sample + (1-tuneAlpha)*old
+}
@@ -0,0 +1,147 @@
+package ingest
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// load is a steady arrival rate and commit latency.
+type load struct {
+	rate    float64 // events/s
+	latency time.Duration
+}
+
+// runTuner feeds t one flush every interval under l, n times.
+func runTuner(t *batchTuner, l load, interval time.Duration, n int, now time.Time) time.Time {
+	for range n {
+		now = now.Add(interval)
+		for range int(l.rate * interval.Seconds()) {
+			t.arrive()
+		}
+		t.observe(l.latency, now)
+	}
+	return now
+}
+
+func TestBatchTunerConverges(t *testing.T) {
+	cfg := Config{
+		Adaptive:       true,
+		MinBatchWindow: 2 * time.Millisecond,
+		BatchWindow:    100 * time.Millisecond,
+		MinBatch:       10,
+		MaxBatch:       1000,
+	}
+
+	tests := []struct {
+		name       string
+		load       load
+		wantWindow time.Duration
+		wantBatch  int
+	}{
+		// rate × latency < 1: flush at once, allow the full batch.
+		{"idle", load{rate: 10, latency: 20 * time.Millisecond}, 2 * time.Millisecond, 1000},
+		// 2000/s × 20ms = 40 events per commit: wait one commit, batch 80.
+		{"steady", load{rate: 2000, latency: 20 * time.Millisecond}, 20 * time.Millisecond, 80},
+		// Slow commits: the window stops at BatchWindow, the batch at MaxBatch.
+		{"slow database", load{rate: 5000, latency: 400 * time.Millisecond}, 100 * time.Millisecond, 1000},
+		// Fast commits: the window stops at MinBatchWindow, the batch at MinBatch.
+		{"fast database", load{rate: 2000, latency: time.Millisecond}, 2 * time.Millisecond, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner := newBatchTuner(cfg)
+			if w, b := tuner.shape(); w != cfg.MinBatchWindow || b != cfg.MaxBatch {
+				t.Fatalf("initial shape %s/%d, want the idle shape", w, b)
+			}
+
+			start := time.Now()
+			tuner.lastTune = start
+			runTuner(tuner, tt.load, 100*time.Millisecond, 20, start)
+
+			w, b := tuner.shape()
+			if w != tt.wantWindow || b != tt.wantBatch {
+				t.Fatalf("shape %s/%d, want %s/%d", w, b, tt.wantWindow, tt.wantBatch)
+			}
+			st := tuner.stats()
+			if math.Abs(st.ArrivalRate-tt.load.rate) > 0.5 || st.CommitLatencyMS != float64(tt.load.latency)/float64(time.Millisecond) {
+				t.Fatalf("stats %+v, want rate %v and latency %s", st, tt.load.rate, tt.load.latency)
+			}
+		})
+	}
+}
+
+func TestBatchTunerFollowsLoadChanges(t *testing.T) {
+	tuner := newBatchTuner(Config{
+		Adaptive:       true,
+		MinBatchWindow: time.Millisecond,
+		BatchWindow:    100 * time.Millisecond,
+		MaxBatch:       1000,
+	})
+	now := time.Now()
+	tuner.lastTune = now
+
+	busy := load{rate: 2000, latency: 20 * time.Millisecond}
+	now = runTuner(tuner, busy, 100*time.Millisecond, 20, now)
+	if w, b := tuner.shape(); w != 20*time.Millisecond || b != 80 {
+		t.Fatalf("busy shape %s/%d, want 20ms/80", w, b)
+	}
+
+	// The EWMA takes a few flushes to let go of the old rate, then the
+	// tuner goes back to flushing at once.
+	idle := load{rate: 10, latency: 20 * time.Millisecond}
+	now = runTuner(tuner, idle, 100*time.Millisecond, 1, now)
+	if w, _ := tuner.shape(); w == time.Millisecond {
+		t.Fatal("went idle after one quiet flush")
+	}
+	runTuner(tuner, idle, 100*time.Millisecond, 20, now)
+	if w, b := tuner.shape(); w != time.Millisecond || b != 1000 {
+		t.Fatalf("idle shape %s/%d, want 1ms/1000", w, b)
+	}
+}
+
+func TestBatchTunerFixed(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		wantWindow time.Duration
+		wantBatch  int
+		wantMin    [2]int // minWindow ms, minBatch
+	}{
+		{
+			name:       "not adaptive",
+			cfg:        Config{BatchWindow: 50 * time.Millisecond, MaxBatch: 500},
+			wantWindow: 50 * time.Millisecond,
+			wantBatch:  500,
+			wantMin:    [2]int{0, 1},
+		},
+		{
+			name: "minimums above maximums",
+			cfg: Config{
+				Adaptive:       true,
+				MinBatchWindow: time.Second,
+				BatchWindow:    50 * time.Millisecond,
+				MinBatch:       1000,
+				MaxBatch:       500,
+			},
+			wantWindow: 50 * time.Millisecond,
+			wantBatch:  500,
+			wantMin:    [2]int{50, 500},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner := newBatchTuner(tt.cfg)
+			now := time.Now()
+			tuner.lastTune = now
+			runTuner(tuner, load{rate: 2000, latency: 20 * time.Millisecond}, 100*time.Millisecond, 20, now)
+
+			if w, b := tuner.shape(); w != tt.wantWindow || b != tt.wantBatch {
+				t.Fatalf("shape %s/%d, want %s/%d", w, b, tt.wantWindow, tt.wantBatch)
+			}
+			if got := [2]int{int(tuner.minWindow / time.Millisecond), tuner.minBatch}; got != tt.wantMin {
+				t.Fatalf("minimums %v, want %v", got, tt.wantMin)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type AdmissionPolicy string
+
+const (
+	// AdmitAll queues every event until the caller's context expires.
+	AdmitAll AdmissionPolicy = "off"
+	// AdmitByDeadline rejects an event up front when the estimated time to
+	// commit it exceeds the caller's remaining deadline (or MaxWait).
+	AdmitByDeadline AdmissionPolicy = "deadline"
+)
+
+type AdmissionConfig struct {
+	Policy AdmissionPolicy
+	// MaxWait caps the estimated time to commit for callers without a
+	// deadline (0 = no cap).
+	MaxWait time.Duration
+}
+
+// OverloadedError is returned by Submit when an event is not admitted.
+// RetryAfter is roughly how long the current backlog takes to drain.
+type OverloadedError struct {
+	Estimate   time.Duration
+	Budget     time.Duration
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("ingest overloaded: estimated commit in %s, budget %s", e.Estimate.Round(time.Millisecond), e.Budget.Round(time.Millisecond))
+}
+
+// AdmissionStats is the current view of a sink's admission controller.
+type AdmissionStats struct {
+	Policy          AdmissionPolicy `json:"policy"`
+	QueueDepth      int             `json:"queue_depth"`
+	FlushLatencyMS  int64           `json:"flush_latency_ms"`
+	EstimatedWaitMS int64           `json:"estimated_wait_ms"`
+	Rejected        uint64          `json:"rejected"`
+}
+
+// flushEWMAAlpha weights the newest flush; ~10 flushes dominate the average.
+const flushEWMAAlpha = 0.2
+
+// flushIdleHalfLife is how fast the flush average decays toward the batch
+// window while the lane is idle, so one slow flush does not keep the
+// estimate high once traffic stops.
+const flushIdleHalfLife = time.Second
+
+// admission estimates time-to-commit for one writer lane from its queue
+// depth and an EWMA of observed flush latency:
+//
+//	wait ≈ ceil((depth+1) / MaxBatch) × flush latency
+//	       + BatchWindow (only while the queue is too short to fill a batch)
+//
+// so the estimate reacts both to a growing queue and to a slowing database.
+// A flush that is still running counts with its elapsed time once that
+// exceeds the average, so a stalled database is noticed before it returns.
+//
+// The estimate only moves when flushes run, and flushes only run when events
+// are admitted, so an empty queue, or an idle lane whose backlog fits one
+// flush, always admits: otherwise a single slow flush would reject
+// everything from then on. A deeper queue is estimated even between
+// flushes, or the gap between two flushes would admit it all.
+type admission struct {
+	cfg AdmissionConfig
+	// shape reports the writer's current batch window and max batch.
+	shape func() (time.Duration, int)
+	now   func() time.Time
+
+	mu       sync.Mutex
+	flush    time.Duration // EWMA; 0 until the first flush
+	inflight time.Time     // start of the running flush, zero if idle
+	idle     time.Time     // end of the last flush
+	rejected uint64
+}
+
+func newAdmission(cfg AdmissionConfig, shape func() (time.Duration, int)) *admission {
+	if cfg.Policy == "" {
+		cfg.Policy = AdmitAll
+	}
+	return &admission{cfg: cfg, shape: shape, now: time.Now}
+}
+
+func (a *admission) flushStarted(now time.Time) {
+	a.mu.Lock()
+	a.inflight = now
+	a.mu.Unlock()
+}
+
+func (a *admission) observeFlush(took time.Duration) {
+	a.mu.Lock()
+	a.inflight = time.Time{}
+	a.idle = a.now()
+	if a.flush == 0 {
+		a.flush = took
+	} else {
+		a.flush = time.Duration(flushEWMAAlpha*float64(took) + (1-flushEWMAAlpha)*float64(a.flush))
+	}
+	a.mu.Unlock()
+}
+
+// estimate returns the expected time to commit and, of that, the time to
+// drain what is already queued.
+func (a *admission) estimate(depth int) (total, drain time.Duration) {
+	window, maxBatch := a.shape()
+
+	a.mu.Lock()
+	flush := a.currentFlush(window)
+	a.mu.Unlock()
+
+	batches := (depth + maxBatch) / maxBatch // ceil((depth+1)/maxBatch)
+	drain = time.Duration(batches) * flush
+	if depth+1 < maxBatch {
+		return drain + window, drain
+	}
+	return drain, drain
+}
+
+// currentFlush is the flush latency to plan with: the running flush's elapsed
+// time if that is longer, otherwise the average decayed toward window for
+// the time the lane has been idle. Called with mu held.
+func (a *admission) currentFlush(window time.Duration) time.Duration {
+	now := a.now()
+	if !a.inflight.IsZero() {
+		return max(a.flush, now.Sub(a.inflight))
+	}
+	if a.flush <= window || a.idle.IsZero() {
+		return a.flush
+	}
+	idle := now.Sub(a.idle)
+	excess := float64(a.flush-window) * math.Exp2(-float64(idle)/float64(flushIdleHalfLife))
+	return window + time.Duration(excess)
+}
+
+// admit returns an *OverloadedError if the event should be rejected now.
+func (a *admission) admit(ctx context.Context, depth int) error {
+	if a.cfg.Policy != AdmitByDeadline {
+		return nil
+	}
+
+	_, maxBatch := a.shape()
+	a.mu.Lock()
+	idle := a.inflight.IsZero()
+	a.mu.Unlock()
+	if depth == 0 || (idle && depth <= maxBatch) {
+		return nil
+	}
+
+	budget := a.cfg.MaxWait
+	if dl, ok := ctx.Deadline(); ok {
+		if left := time.Until(dl); budget <= 0 || left < budget {
+			budget = left
+		}
+	}
+	if budget <= 0 {
+		return nil
+	}
+
+	est, drain := a.estimate(depth)
+	if est <= budget {
+		return nil
+	}
+
+	a.mu.Lock()
+	a.rejected++
+	a.mu.Unlock()
+
+	return &OverloadedError{
+		Estimate:   est,
+		Budget:     budget,
+		RetryAfter: drain,
+	}
+}
+
+func (a *admission) stats(depth int) AdmissionStats {
+	a.mu.Lock()
+	flush, rejected := a.flush, a.rejected
+	a.mu.Unlock()
+	est, _ := a.estimate(depth)
+	return AdmissionStats{
+		Policy:          a.cfg.Policy,
+		QueueDepth:      depth,
+		FlushLatencyMS:  flush.Milliseconds(),
+		EstimatedWaitMS: est.Milliseconds(),
+		Rejected:        rejected,
+	}
+}
@@ -0,0 +1,191 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+// slowRepo takes delays[i] for the i-th InsertBatch (0 once exhausted).
+type slowRepo struct {
+	mu     sync.Mutex
+	calls  int
+	delays []time.Duration
+}
+
+func (r *slowRepo) InsertBatch(ctx context.Context, events []domain.Event) (map[string]struct{}, error) {
+	r.mu.Lock()
+	var d time.Duration
+	if r.calls < len(r.delays) {
+		d = r.delays[r.calls]
+	}
+	r.calls++
+	r.mu.Unlock()
+
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	out := make(map[string]struct{}, len(events))
+	for _, e := range events {
+		out[e.DedupKey] = struct{}{}
+	}
+	return out, nil
+}
+
+type nopDeadLetters struct{}
+
+func (nopDeadLetters) Insert(context.Context, []domain.DeadLetter) error { return nil }
+
+func TestAdmissionRecoversAfterSlowFlush(t *testing.T) {
+	repo := &slowRepo{delays: []time.Duration{300 * time.Millisecond}}
+	w := NewSingleWriter(repo, nopDeadLetters{}, Config{
+		BatchWindow: 5 * time.Millisecond,
+		MaxBatch:    10,
+		QueueSize:   100,
+		Admission:   AdmissionConfig{Policy: AdmitByDeadline},
+	}, jsonlog.New(io.Discard, jsonlog.LevelError))
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop(context.Background())
+
+	submit := func(i int, budget time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), budget)
+		defer cancel()
+		_, err := w.Submit(ctx, domain.Event{DedupKey: "k" + strconv.Itoa(i)})
+		return err
+	}
+
+	// One slow flush pushes the estimate far above the next budgets.
+	if err := submit(0, 2*time.Second); err != nil {
+		t.Fatalf("slow flush: %v", err)
+	}
+	if got := w.Admission().FlushLatencyMS; got < 250 {
+		t.Fatalf("flush latency = %dms, want the slow flush to be recorded", got)
+	}
+
+	// The lane is idle again: events must be admitted, commit fast and pull
+	// the estimate back down.
+	for i := 1; i <= 20; i++ {
+		if err := submit(i, 100*time.Millisecond); err != nil {
+			var ov *OverloadedError
+			if errors.As(err, &ov) {
+				t.Fatalf("event %d rejected after recovery: %v", i, err)
+			}
+			t.Fatalf("event %d: %v", i, err)
+		}
+	}
+	if got := w.Admission().FlushLatencyMS; got >= 100 {
+		t.Fatalf("flush latency = %dms after fast flushes, want it to recover", got)
+	}
+}
+
+func TestAdmissionDeepQueueOnIdleLane(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := newAdmission(AdmissionConfig{Policy: AdmitByDeadline}, func() (time.Duration, int) {
+		return 10 * time.Millisecond, 100
+	})
+	a.now = func() time.Time { return now }
+
+	// 100ms flushes, and no flush running: the gap between two flushes.
+	for range 5 {
+		a.flushStarted(now)
+		a.observeFlush(100 * time.Millisecond)
+	}
+
+	tests := []struct {
+		depth  int
+		budget time.Duration
+		admit  bool
+	}{
+		{0, 50 * time.Millisecond, true},
+		{100, 50 * time.Millisecond, true},   // fits one flush
+		{101, 150 * time.Millisecond, false}, // two flushes: ~200ms
+		{101, 300 * time.Millisecond, true},
+		{50_000, time.Second, false},
+		{50_000, time.Minute, true},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), tt.budget)
+		err := a.admit(ctx, tt.depth)
+		cancel()
+
+		var ov *OverloadedError
+		switch {
+		case tt.admit && err != nil:
+			t.Errorf("depth %d, budget %s: rejected: %v", tt.depth, tt.budget, err)
+		case !tt.admit && !errors.As(err, &ov):
+			t.Errorf("depth %d, budget %s: err = %v, want *OverloadedError", tt.depth, tt.budget, err)
+		case !tt.admit && ov.RetryAfter < time.Duration(tt.depth/100)*100*time.Millisecond:
+			t.Errorf("depth %d: RetryAfter %s shorter than the backlog", tt.depth, ov.RetryAfter)
+		}
+	}
+}
+
+func TestAdmissionEstimate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := newAdmission(AdmissionConfig{Policy: AdmitByDeadline}, func() (time.Duration, int) {
+		return 10 * time.Millisecond, 100
+	})
+	a.now = func() time.Time { return now }
+
+	budgetCtx := func(d time.Duration) context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	a.flushStarted(now)
+	now = now.Add(2 * time.Second)
+	a.observeFlush(2 * time.Second)
+
+	// Idle lane with a backlog that fits one flush: admitted, whatever the
+	// estimate.
+	if err := a.admit(budgetCtx(50*time.Millisecond), 5); err != nil {
+		t.Fatalf("idle lane rejected: %v", err)
+	}
+	if err := a.admit(budgetCtx(50*time.Millisecond), 100); err != nil {
+		t.Fatalf("idle lane with one batch queued rejected: %v", err)
+	}
+
+	// Busy lane with a queue: the slow average rejects short budgets.
+	a.flushStarted(now)
+	if err := a.admit(budgetCtx(50*time.Millisecond), 5); err == nil {
+		t.Fatal("busy lane with a 2s flush average admitted a 50ms budget")
+	}
+	// ... but never an empty queue.
+	if err := a.admit(budgetCtx(50*time.Millisecond), 0); err != nil {
+		t.Fatalf("empty queue rejected: %v", err)
+	}
+	a.observeFlush(0) // average 1.6s
+
+	// Idle time decays the average toward the window.
+	tests := []struct {
+		idle time.Duration
+		max  time.Duration
+	}{
+		{0, 2 * time.Second},
+		{time.Second, 900 * time.Millisecond},
+		{5 * time.Second, 70 * time.Millisecond},
+		{30 * time.Second, 11 * time.Millisecond},
+	}
+	base := now
+	for _, tt := range tests {
+		now = base.Add(tt.idle)
+		a.mu.Lock()
+		got := a.currentFlush(10 * time.Millisecond)
+		a.mu.Unlock()
+		if got > tt.max || got < 10*time.Millisecond {
+			t.Errorf("after %s idle: flush = %s, want between 10ms and %s", tt.idle, got, tt.max)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+// DeadLetterStore persists events that could not be written. It may be nil,
+// in which case failed events are only logged.
+type DeadLetterStore interface {
+	Insert(ctx context.Context, letters []domain.DeadLetter) error
+}
+
+// deadLetterReopener is implemented by stores that can put a re-driven dead
+// letter back in pending when its replay fails after it was accepted.
+type deadLetterReopener interface {
+	MarkReplayFailed(ctx context.Context, id int64, replayErr string) error
+}
+
+// RequestMeta carries request-scoped details the sink needs to build a dead
+// letter after the event has left the handler.
+type RequestMeta struct {
+	RequestID string
+	Payload   json.RawMessage
+	// DeadLetterID is set when re-driving an existing dead letter; the writer
+	// then leaves bookkeeping to the caller instead of recording a new one,
+	// and the spool keeps it with the record to reopen that letter.
+	DeadLetterID int64
+}
+
+type ctxKeyRequestMeta struct{}
+
+func WithRequestMeta(ctx context.Context, m RequestMeta) context.Context {
+	return context.WithValue(ctx, ctxKeyRequestMeta{}, m)
+}
+
+func requestMetaFrom(ctx context.Context) RequestMeta {
+	m, _ := ctx.Value(ctxKeyRequestMeta{}).(RequestMeta)
+	return m
+}
+
+// recordDeadLetters stores letters with a bounded timeout. If that fails too
+// (typically during a DB outage) the letters are logged in full so they can
+// still be recovered from logs.
+func recordDeadLetters(store DeadLetterStore, logger *jsonlog.Logger, letters []domain.DeadLetter) {
+	if len(letters) == 0 {
+		return
+	}
+
+	var err error
+	if store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err = store.Insert(ctx, letters)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+
+	if logger == nil {
+		return
+	}
+	for _, dl := range letters {
+		ev, _ := json.Marshal(dl.Event)
+		props := map[string]string{
+			"component":          "dead_letter",
+			"source":             dl.Component,
+			"request_id":         dl.RequestID,
+			"dedup_key":          dl.DedupKey,
+			"dead_letter_reason": dl.Error,
+			"event":              string(ev),
+			"payload":            string(dl.Payload),
+		}
+		if err != nil {
+			props["store_error"] = err.Error()
+		}
+		logger.PrintError(errors.New("dead letter not stored"), props)
+	}
+}
+
+// reopenDeadLetter marks a re-driven dead letter as failed again instead of
+// recording a second letter for the same event.
+func reopenDeadLetter(store DeadLetterStore, logger *jsonlog.Logger, dl domain.DeadLetter, id int64) {
+	var err error
+	if r, ok := store.(deadLetterReopener); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err = r.MarkReplayFailed(ctx, id, dl.Error)
+		cancel()
+		if err == nil {
+			return
+		}
+	} else {
+		err = errors.New("dead letter store cannot reopen letters")
+	}
+
+	if logger == nil {
+		return
+	}
+	ev, _ := json.Marshal(dl.Event)
+	logger.PrintError(errors.New("dead letter not reopened"), map[string]string{
+		"component":          "dead_letter",
+		"source":             dl.Component,
+		"dead_letter_id":     strconv.FormatInt(id, 10),
+		"dedup_key":          dl.DedupKey,
+		"dead_letter_reason": dl.Error,
+		"event":              string(ev),
+		"store_error":        err.Error(),
+	})
+}
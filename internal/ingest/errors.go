@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type errClass int
+
+const (
+	// errPermanent fails the whole batch as-is (e.g. schema or syntax errors).
+	errPermanent errClass = iota
+	// errTransient is worth retrying the same batch (connection loss, deadlock, overload).
+	errTransient
+	// errData is caused by row contents; bisecting the batch isolates the bad rows.
+	errData
+)
+
+func classifyError(err error) errClass {
+	// The caller gave up or the attempt ran out of time; retrying only
+	// delays the answer.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return errPermanent
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case len(pgErr.Code) < 2:
+			return errPermanent
+		case pgErr.Code[:2] == "22", // data_exception: invalid jsonb, NUL bytes, bad encoding, overflow
+			pgErr.Code[:2] == "23": // integrity_constraint_violation
+			return errData
+		case pgErr.Code[:2] == "08", // connection_exception
+			pgErr.Code[:2] == "53", // insufficient_resources
+			pgErr.Code == "40001",  // serialization_failure
+			pgErr.Code == "40P01",  // deadlock_detected
+			pgErr.Code == "57P01",  // admin_shutdown
+			pgErr.Code == "57P03":  // cannot_connect_now
+			return errTransient
+		default:
+			return errPermanent
+		}
+	}
+
+	// Other errors without a SQLSTATE never reached the server's row checks
+	// (network errors, closed connections), so retrying is the safe bet.
+	return errTransient
+}
+
+// RejectedError is returned for an event the database refused to store
+// because of its contents. Other events in the same batch are unaffected.
+type RejectedError struct {
+	DedupKey string
+	Err      error
+}
+
+func (e *RejectedError) Error() string {
+	var pgErr *pgconn.PgError
+	if errors.As(e.Err, &pgErr) {
+		return fmt.Sprintf("event rejected by database: %s (SQLSTATE %s)", pgErr.Message, pgErr.Code)
+	}
+	return "event rejected by database: " + e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error { return e.Err }
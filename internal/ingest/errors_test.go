@@ -0,0 +1,37 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errClass
+	}{
+		{"canceled", context.Canceled, errPermanent},
+		{"deadline", context.DeadlineExceeded, errPermanent},
+		{"wrapped deadline", fmt.Errorf("insert: %w", context.DeadlineExceeded), errPermanent},
+		{"network", io.ErrUnexpectedEOF, errTransient},
+		{"invalid jsonb", &pgconn.PgError{Code: "22P02"}, errData},
+		{"no partition", &pgconn.PgError{Code: "23514"}, errData},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, errTransient},
+		{"connection", &pgconn.PgError{Code: "08006"}, errTransient},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, errTransient},
+		{"undefined table", &pgconn.PgError{Code: "42P01"}, errPermanent},
+		{"no code", &pgconn.PgError{}, errPermanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Fatalf("classifyError(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
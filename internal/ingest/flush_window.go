@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"sync"
+	"time"
+)
+
+// flushWindow counts commits and failed commits over the last minute, in
+// 10s buckets. Being time-based, it recovers on its own once errors stop,
+// even if no traffic arrives to produce successful flushes.
+type flushWindow struct {
+	mu      sync.Mutex
+	buckets [6]flushBucket
+}
+
+type flushBucket struct {
+	start    int64 // unix seconds / 10
+	flushes  int
+	failures int
+}
+
+const flushBucketSeconds = 10
+
+func (f *flushWindow) record(failed bool, now time.Time) {
+	slot := now.Unix() / flushBucketSeconds
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b := &f.buckets[slot%int64(len(f.buckets))]
+	if b.start != slot {
+		*b = flushBucket{start: slot}
+	}
+	b.flushes++
+	if failed {
+		b.failures++
+	}
+}
+
+func (f *flushWindow) counts(now time.Time) (flushes, failures int) {
+	slot := now.Unix() / flushBucketSeconds
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, b := range f.buckets {
+		if slot-b.start < int64(len(f.buckets)) {
+			flushes += b.flushes
+			failures += b.failures
+		}
+	}
+	return flushes, failures
+}
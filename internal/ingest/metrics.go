@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cun0/insider-case/internal/telemetry"
+)
+
+// Metrics instruments the write path (writer flushes and spool replays).
+// A nil *Metrics records nothing.
+type Metrics struct {
+	batchSize    *telemetry.HistogramVec
+	flushSeconds *telemetry.HistogramVec
+	flushErrors  *telemetry.CounterVec
+	events       *telemetry.CounterVec
+	rejected     *telemetry.CounterVec
+}
+
+func NewMetrics(reg *telemetry.Registry) *Metrics {
+	return &Metrics{
+		batchSize: reg.NewHistogramVec("ingest_batch_size",
+			"Events per flushed batch.",
+			[]float64{1, 5, 10, 25, 50, 100, 250, 500, 800, 1000, 2500, 5000},
+			"sink"),
+		flushSeconds: reg.NewHistogramVec("ingest_flush_duration_seconds",
+			"Time to commit a batch, including retries and bisection.",
+			nil, "sink"),
+		flushErrors: reg.NewCounterVec("ingest_flush_errors_total",
+			"Failed batch commits by error class (after retries).",
+			"sink", "class"),
+		events: reg.NewCounterVec("ingest_events_total",
+			"Events committed by outcome.",
+			"sink", "result"),
+		rejected: reg.NewCounterVec("ingest_admission_rejected_total",
+			"Events refused by admission control.",
+			"sink"),
+	}
+}
+
+func (m *Metrics) observeFlush(sink string, size int, took time.Duration) {
+	if m == nil {
+		return
+	}
+	m.batchSize.With(sink).Observe(float64(size))
+	m.flushSeconds.With(sink).Observe(took.Seconds())
+}
+
+func (m *Metrics) observeError(sink string, err error) {
+	if m == nil {
+		return
+	}
+	class := "permanent"
+	var rej *RejectedError
+	switch {
+	case errors.As(err, &rej):
+		class = "rejected"
+	case errors.Is(err, errCorruptRecord):
+		class = "corrupt"
+	case classifyError(err) == errTransient:
+		class = "transient"
+	}
+	m.flushErrors.With(sink, class).Inc()
+}
+
+func (m *Metrics) observeEvents(sink string, inserted, duplicate, failed int) {
+	if m == nil {
+		return
+	}
+	m.events.With(sink, "inserted").Add(float64(inserted))
+	m.events.With(sink, "duplicate").Add(float64(duplicate))
+	m.events.With(sink, "failed").Add(float64(failed))
+}
+
+func (m *Metrics) observeRejected(sink string) {
+	if m == nil {
+		return
+	}
+	m.rejected.With(sink).Inc()
+}
@@ -6,6 +6,9 @@ type Status int
 const (
 	StatusInserted Status = iota
 	StatusDuplicate
+	// StatusAccepted means the event is durably spooled but not yet committed,
+	// so whether it is a duplicate is not known yet.
+	StatusAccepted
 )
 
 type Result struct {
@@ -14,3 +17,4 @@ type Result struct {
 
 func (r Result) Inserted() bool  { return r.Status == StatusInserted }
 func (r Result) Duplicate() bool { return r.Status == StatusDuplicate }
+func (r Result) Accepted() bool  { return r.Status == StatusAccepted }
@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+// ShardedWriter spreads events across N independent SingleWriter lanes.
+// Each lane has its own queue, timer and flush, so commits overlap.
+// A given dedup_key always hashes to the same lane.
+type ShardedWriter struct {
+	shards []*SingleWriter
+}
+
+// NewShardedWriter splits cfg.QueueSize evenly across the lanes (the first
+// lanes take the remainder, and every lane gets at least 1); BatchWindow and
+// MaxBatch apply per lane.
+func NewShardedWriter(repo batchRepo, dead DeadLetterStore, cfg Config, shards int, logger *jsonlog.Logger) *ShardedWriter {
+	if shards <= 0 {
+		shards = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 50_000
+	}
+
+	w := &ShardedWriter{shards: make([]*SingleWriter, shards)}
+	for i := range w.shards {
+		laneCfg := cfg
+		laneCfg.QueueSize = cfg.QueueSize / shards
+		if i < cfg.QueueSize%shards {
+			laneCfg.QueueSize++
+		}
+		laneCfg.QueueSize = max(laneCfg.QueueSize, 1)
+
+		sw := NewSingleWriter(repo, dead, laneCfg, logger)
+		sw.lane = strconv.Itoa(i)
+		w.shards[i] = sw
+	}
+	return w
+}
+
+func (w *ShardedWriter) Start() error {
+	for _, s := range w.shards {
+		if err := s.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop signals every lane first so they drain concurrently, then waits for all of them.
+func (w *ShardedWriter) Stop(ctx context.Context) error {
+	errs := make(chan error, len(w.shards))
+	for _, s := range w.shards {
+		go func(s *SingleWriter) {
+			errs <- s.Stop(ctx)
+		}(s)
+	}
+
+	var out error
+	for range w.shards {
+		if err := <-errs; err != nil {
+			out = errors.Join(out, err)
+		}
+	}
+	return out
+}
+
+// Running requires every lane to be running.
+func (w *ShardedWriter) Running() bool {
+	for _, s := range w.shards {
+		if !s.Running() {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *ShardedWriter) FlushErrors() (flushes, failures int) {
+	for _, s := range w.shards {
+		f, e := s.FlushErrors()
+		flushes += f
+		failures += e
+	}
+	return flushes, failures
+}
+
+// QueueStats sums the lanes.
+func (w *ShardedWriter) QueueStats() (depth, capacity int) {
+	for _, s := range w.shards {
+		d, c := s.QueueStats()
+		depth += d
+		capacity += c
+	}
+	return depth, capacity
+}
+
+// Admission sums depth and rejections and reports the slowest lane's
+// latency and estimate (a lane is picked by key, so the worst one matters).
+func (w *ShardedWriter) Admission() AdmissionStats {
+	var out AdmissionStats
+	for _, s := range w.shards {
+		st := s.Admission()
+		out.Policy = st.Policy
+		out.QueueDepth += st.QueueDepth
+		out.Rejected += st.Rejected
+		if st.EstimatedWaitMS >= out.EstimatedWaitMS {
+			out.FlushLatencyMS = st.FlushLatencyMS
+			out.EstimatedWaitMS = st.EstimatedWaitMS
+		}
+	}
+	return out
+}
+
+// Batching sums arrival rates and reports the widest lane shape and the
+// slowest commit latency.
+func (w *ShardedWriter) Batching() BatchingStats {
+	var out BatchingStats
+	for _, s := range w.shards {
+		st := s.Batching()
+		out.Adaptive = st.Adaptive
+		out.WindowMS = max(out.WindowMS, st.WindowMS)
+		out.MaxBatch = max(out.MaxBatch, st.MaxBatch)
+		out.ArrivalRate += st.ArrivalRate
+		out.CommitLatencyMS = max(out.CommitLatencyMS, st.CommitLatencyMS)
+	}
+	return out
+}
+
+func (w *ShardedWriter) Submit(ctx context.Context, e domain.Event) (Result, error) {
+	return w.shards[w.shardFor(e.DedupKey)].Submit(ctx, e)
+}
+
+func (w *ShardedWriter) shardFor(key string) int {
+	if len(w.shards) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(w.shards)))
+}
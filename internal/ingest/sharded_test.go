@@ -0,0 +1,209 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+// gateRepo holds every InsertBatch until open is closed.
+type gateRepo struct {
+	open chan struct{}
+
+	mu      sync.Mutex
+	waiting int
+	keys    map[string]int
+}
+
+func newGateRepo() *gateRepo {
+	return &gateRepo{open: make(chan struct{}), keys: make(map[string]int)}
+}
+
+func (r *gateRepo) InsertBatch(ctx context.Context, events []domain.Event) (map[string]struct{}, error) {
+	r.mu.Lock()
+	r.waiting++
+	r.mu.Unlock()
+
+	select {
+	case <-r.open:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waiting--
+	out := make(map[string]struct{}, len(events))
+	for _, e := range events {
+		r.keys[e.DedupKey]++
+		out[e.DedupKey] = struct{}{}
+	}
+	return out, nil
+}
+
+func (r *gateRepo) blocked() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.waiting
+}
+
+func newTestShardedWriter(repo batchRepo, cfg Config, shards int) *ShardedWriter {
+	return NewShardedWriter(repo, nopDeadLetters{}, cfg, shards, jsonlog.New(io.Discard, jsonlog.LevelError))
+}
+
+func TestShardedWriterLaneForKey(t *testing.T) {
+	w := newTestShardedWriter(&memRepo{}, Config{}, 8)
+
+	used := make(map[int]int)
+	for i := range 1000 {
+		key := "key-" + strconv.Itoa(i)
+		lane := w.shardFor(key)
+		for range 3 {
+			if got := w.shardFor(key); got != lane {
+				t.Fatalf("key %q mapped to lanes %d and %d", key, lane, got)
+			}
+		}
+		used[lane]++
+	}
+	// FNV spreads 1000 keys over every lane.
+	for lane := range 8 {
+		if used[lane] == 0 {
+			t.Errorf("lane %d never used: %v", lane, used)
+		}
+	}
+
+	if lane := newTestShardedWriter(&memRepo{}, Config{}, 1).shardFor("any"); lane != 0 {
+		t.Fatalf("single lane: shardFor = %d, want 0", lane)
+	}
+}
+
+func TestShardedWriterQueueSplit(t *testing.T) {
+	tests := []struct {
+		queue, shards int
+		want          []int
+	}{
+		{100, 4, []int{25, 25, 25, 25}},
+		{10, 4, []int{3, 3, 2, 2}},
+		{3, 2, []int{2, 1}},
+		{4, 4, []int{1, 1, 1, 1}},
+		// Smaller than the lane count (config validation forbids it): every
+		// lane still gets a slot.
+		{2, 4, []int{1, 1, 1, 1}},
+		{0, 2, []int{25_000, 25_000}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%d", tt.queue, tt.shards), func(t *testing.T) {
+			w := newTestShardedWriter(&memRepo{}, Config{QueueSize: tt.queue}, tt.shards)
+			total := 0
+			for i, s := range w.shards {
+				_, c := s.QueueStats()
+				if c != tt.want[i] {
+					t.Errorf("lane %d capacity %d, want %d", i, c, tt.want[i])
+				}
+				total += c
+			}
+			if _, c := w.QueueStats(); c != total {
+				t.Fatalf("QueueStats capacity %d, lanes add up to %d", c, total)
+			}
+		})
+	}
+}
+
+func TestShardedWriterStopDrainsEveryLane(t *testing.T) {
+	const (
+		shards = 4
+		events = 200
+	)
+	repo := newGateRepo()
+	// One event per flush, so each lane has one flush held in the repo and
+	// the rest of its events in its queue.
+	w := newTestShardedWriter(repo, Config{BatchWindow: time.Millisecond, MaxBatch: 1, QueueSize: 1000}, shards)
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]error, events)
+	)
+	for i := range events {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := w.Submit(context.Background(), domain.Event{DedupKey: "k" + strconv.Itoa(i)})
+			if err == nil && !res.Inserted() {
+				err = fmt.Errorf("result %+v, want inserted", res)
+			}
+			results[i] = err
+		}()
+	}
+
+	// Wait until every event is held in a flush or queued.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		depth, _ := w.QueueStats()
+		if depth+repo.blocked() == events {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d, in flight %d; want %d in total", depth, repo.blocked(), events)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// QueueStats and Admission add up the lanes.
+	depth, capacity := w.QueueStats()
+	sumDepth, sumCap := 0, 0
+	for _, s := range w.shards {
+		d, c := s.QueueStats()
+		sumDepth += d
+		sumCap += c
+	}
+	if depth != sumDepth || capacity != sumCap || capacity != 1000 {
+		t.Fatalf("QueueStats = %d/%d, lanes add up to %d/%d (capacity want 1000)", depth, capacity, sumDepth, sumCap)
+	}
+	if got := w.Admission().QueueDepth; got != depth {
+		t.Fatalf("Admission().QueueDepth = %d, want %d", got, depth)
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- w.Stop(context.Background()) }()
+	close(repo.open)
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	wg.Wait()
+	if w.Running() {
+		t.Fatal("Running after Stop")
+	}
+
+	for i, err := range results {
+		if err != nil {
+			t.Errorf("event %d: %v", i, err)
+		}
+	}
+	if len(repo.keys) != events {
+		t.Fatalf("%d events committed, want %d", len(repo.keys), events)
+	}
+	for k, n := range repo.keys {
+		if n != 1 {
+			t.Errorf("%s committed %d times", k, n)
+		}
+	}
+	if depth, _ := w.QueueStats(); depth != 0 {
+		t.Fatalf("%d events left queued after Stop", depth)
+	}
+}
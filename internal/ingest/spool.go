@@ -0,0 +1,704 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/telemetry"
+)
+
+var ErrSpoolFull = errors.New("ingest spool full")
+
+type FsyncPolicy string
+
+const (
+	// FsyncAlways acks only after the record is fsynced (concurrent submits share one fsync).
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval acks after write; the active segment is fsynced every FsyncInterval.
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves flushing to the OS.
+	FsyncNever FsyncPolicy = "never"
+)
+
+type SpoolConfig struct {
+	Dir string
+
+	SegmentBytes int64
+	MaxBytes     int64
+
+	Fsync         FsyncPolicy
+	FsyncInterval time.Duration
+
+	// MaxBatch is the number of records replayed per InsertBatch call.
+	MaxBatch int
+	// DrainInterval is how often the drainer seals the active segment and replays it.
+	DrainInterval time.Duration
+
+	// Metrics and Tracer are optional.
+	Metrics *Metrics
+	Tracer  *telemetry.Tracer
+}
+
+type SpoolStats struct {
+	Segments int   `json:"segments"`
+	Records  int64 `json:"records"`
+	Bytes    int64 `json:"bytes"`
+}
+
+type segmentInfo struct {
+	id      uint64
+	path    string
+	size    int64
+	records int64
+	// offset of the first record not yet committed to the repo.
+	replayed int64
+}
+
+// Spool is a Sink that acknowledges events once they are appended (and, per
+// policy, fsynced) to a local segmented log. A background drainer replays
+// sealed segments into the repo and deletes them once committed, so short
+// database outages do not reject traffic.
+type Spool struct {
+	repo   batchRepo
+	dead   DeadLetterStore
+	cfg    SpoolConfig
+	logger *jsonlog.Logger
+
+	// syncMu serializes fsync and rotation; always taken before mu.
+	syncMu sync.Mutex
+	synced uint64
+
+	mu            sync.Mutex
+	active        *os.File
+	activeID      uint64
+	activeSize    int64
+	activeRecords int64
+	written       uint64
+	sealed        []segmentInfo
+
+	pendingRecords atomic.Int64
+	pendingBytes   atomic.Int64
+
+	kick        chan struct{}
+	stopOnce    sync.Once
+	stopCh      chan struct{}
+	doneCh      chan struct{}
+	drainCtx    context.Context
+	cancelDrain context.CancelFunc
+
+	flushes flushWindow
+}
+
+func NewSpool(repo batchRepo, dead DeadLetterStore, cfg SpoolConfig, logger *jsonlog.Logger) *Spool {
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = 64 << 20
+	}
+	if cfg.Fsync == "" {
+		cfg.Fsync = FsyncAlways
+	}
+	if cfg.FsyncInterval <= 0 {
+		cfg.FsyncInterval = 100 * time.Millisecond
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = 800
+	}
+	if cfg.DrainInterval <= 0 {
+		cfg.DrainInterval = 200 * time.Millisecond
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Spool{
+		repo:        repo,
+		dead:        dead,
+		cfg:         cfg,
+		logger:      logger,
+		kick:        make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+		doneCh:      make(chan struct{}),
+		drainCtx:    ctx,
+		cancelDrain: cancel,
+	}
+}
+
+// Start recovers existing segments (truncating torn tails), opens a fresh
+// active segment and starts the drainer.
+func (s *Spool) Start() error {
+	if err := s.recover(); err != nil {
+		return err
+	}
+	if err := s.openActive(s.activeID); err != nil {
+		return err
+	}
+
+	go s.drainLoop()
+	if s.cfg.Fsync == FsyncInterval {
+		go s.syncLoop()
+	}
+	return nil
+}
+
+func (s *Spool) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+
+	var err error
+	select {
+	case <-s.doneCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.cancelDrain()
+		<-s.doneCh
+	}
+
+	s.syncMu.Lock()
+	s.mu.Lock()
+	if s.active != nil {
+		if syncErr := s.active.Sync(); syncErr != nil {
+			err = errors.Join(err, syncErr)
+		}
+		_ = s.active.Close()
+		if s.activeRecords == 0 {
+			_ = os.Remove(filepath.Join(s.cfg.Dir, segmentName(s.activeID)))
+		}
+		s.active = nil
+	}
+	s.mu.Unlock()
+	s.syncMu.Unlock()
+
+	return err
+}
+
+func (s *Spool) Submit(ctx context.Context, e domain.Event) (_ Result, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "ingest.spool_append")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	select {
+	case <-s.stopCh:
+		return Result{}, ErrStopped
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	rec, err := encodeRecord(e, requestMetaFrom(ctx), telemetry.SpanFromContext(ctx).Context())
+	if err != nil {
+		return Result{}, err
+	}
+	if !s.reserve(int64(len(rec))) {
+		return Result{}, ErrSpoolFull
+	}
+
+	seq, full, err := s.append(rec)
+	if err != nil {
+		s.pendingBytes.Add(-int64(len(rec)))
+		return Result{}, err
+	}
+
+	if s.cfg.Fsync == FsyncAlways {
+		if err := s.syncTo(seq); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if full {
+		if err := s.rotate(false); err != nil && s.logger != nil {
+			s.logger.PrintError(err, map[string]string{"component": "ingest_spool"})
+		}
+	}
+
+	return Result{Status: StatusAccepted}, nil
+}
+
+// Running is false once the drainer has exited (or is stopping).
+func (s *Spool) Running() bool {
+	select {
+	case <-s.stopCh:
+		return false
+	case <-s.doneCh:
+		return false
+	default:
+		return true
+	}
+}
+
+// FlushErrors reports replay commits and failed ones over the last minute.
+func (s *Spool) FlushErrors() (flushes, failures int) {
+	return s.flushes.counts(time.Now())
+}
+
+// Depth reports how much data is spooled but not yet committed.
+func (s *Spool) Depth() SpoolStats {
+	s.mu.Lock()
+	segments := len(s.sealed)
+	if s.activeRecords > 0 {
+		segments++
+	}
+	s.mu.Unlock()
+
+	return SpoolStats{
+		Segments: segments,
+		Records:  s.pendingRecords.Load(),
+		Bytes:    s.pendingBytes.Load(),
+	}
+}
+
+// reserve counts n bytes as pending, failing if that would exceed MaxBytes.
+// The check and the add are one step, so concurrent submitters cannot all
+// pass the check and overshoot the limit together.
+func (s *Spool) reserve(n int64) bool {
+	for {
+		cur := s.pendingBytes.Load()
+		if s.cfg.MaxBytes > 0 && cur+n > s.cfg.MaxBytes {
+			return false
+		}
+		if s.pendingBytes.CompareAndSwap(cur, cur+n) {
+			return true
+		}
+	}
+}
+
+// append writes rec to the active segment; its bytes are already reserved.
+func (s *Spool) append(rec []byte) (seq uint64, full bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return 0, false, ErrStopped
+	}
+
+	if _, err := s.active.Write(rec); err != nil {
+		// Cut off a partial write so later records stay readable.
+		_ = s.active.Truncate(s.activeSize)
+		_, _ = s.active.Seek(s.activeSize, io.SeekStart)
+		return 0, false, err
+	}
+
+	s.activeSize += int64(len(rec))
+	s.activeRecords++
+	s.written++
+	s.pendingRecords.Add(1)
+
+	return s.written, s.activeSize >= s.cfg.SegmentBytes, nil
+}
+
+// syncTo fsyncs the active segment unless seq is already durable. Writers
+// that arrive while an fsync is in flight are covered by the next one.
+func (s *Spool) syncTo(seq uint64) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	if s.synced >= seq {
+		return nil
+	}
+
+	s.mu.Lock()
+	f := s.active
+	target := s.written
+	s.mu.Unlock()
+
+	if f == nil {
+		return ErrStopped
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	s.synced = target
+	return nil
+}
+
+func (s *Spool) syncLoop() {
+	t := time.NewTicker(s.cfg.FsyncInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-t.C:
+			s.mu.Lock()
+			seq := s.written
+			s.mu.Unlock()
+			if err := s.syncTo(seq); err != nil && !errors.Is(err, ErrStopped) && s.logger != nil {
+				s.logger.PrintError(err, map[string]string{"component": "ingest_spool"})
+			}
+		}
+	}
+}
+
+// rotate seals the active segment and opens the next one. Without force it
+// only rotates when the segment has reached SegmentBytes.
+func (s *Spool) rotate(force bool) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil || s.activeRecords == 0 {
+		return nil
+	}
+	if !force && s.activeSize < s.cfg.SegmentBytes {
+		return nil
+	}
+
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+	if err := s.active.Close(); err != nil {
+		return err
+	}
+	s.synced = s.written
+
+	s.sealed = append(s.sealed, segmentInfo{
+		id:      s.activeID,
+		path:    filepath.Join(s.cfg.Dir, segmentName(s.activeID)),
+		size:    s.activeSize,
+		records: s.activeRecords,
+	})
+	s.active = nil
+
+	if err := s.openActiveLocked(s.activeID + 1); err != nil {
+		return err
+	}
+
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Spool) openActive(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openActiveLocked(id)
+}
+
+func (s *Spool) openActiveLocked(id uint64) error {
+	path := filepath.Join(s.cfg.Dir, segmentName(id))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(s.cfg.Dir); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.active = f
+	s.activeID = id
+	s.activeSize = 0
+	s.activeRecords = 0
+	return nil
+}
+
+// recover scans leftover segments, truncates torn or corrupt tails, removes
+// empty segments and queues the rest for replay.
+func (s *Spool) recover() error {
+	if err := os.MkdirAll(s.cfg.Dir, 0o755); err != nil {
+		return err
+	}
+
+	ids, err := listSegments(s.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	next := uint64(1)
+	for _, id := range ids {
+		next = id + 1
+		path := filepath.Join(s.cfg.Dir, segmentName(id))
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		records, valid, err := scanSegment(path)
+		if err != nil {
+			return err
+		}
+
+		if valid < fi.Size() {
+			if s.logger != nil {
+				s.logger.PrintInfo("spool: truncating torn segment tail", map[string]string{
+					"segment":   segmentName(id),
+					"valid":     strconv.FormatInt(valid, 10),
+					"discarded": strconv.FormatInt(fi.Size()-valid, 10),
+				})
+			}
+			if err := os.Truncate(path, valid); err != nil {
+				return err
+			}
+		}
+
+		if records == 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s.sealed = append(s.sealed, segmentInfo{id: id, path: path, size: valid, records: records})
+		s.pendingRecords.Add(records)
+		s.pendingBytes.Add(valid)
+	}
+
+	if len(s.sealed) > 0 && s.logger != nil {
+		s.logger.PrintInfo("spool: recovered segments", map[string]string{
+			"segments": itoa(len(s.sealed)),
+			"records":  strconv.FormatInt(s.pendingRecords.Load(), 10),
+		})
+	}
+
+	s.activeID = next
+	return nil
+}
+
+func (s *Spool) drainLoop() {
+	defer close(s.doneCh)
+
+	t := time.NewTicker(s.cfg.DrainInterval)
+	defer t.Stop()
+
+	backoff := s.cfg.DrainInterval
+	const maxBackoff = 5 * time.Second
+
+	for {
+		stopping := false
+		select {
+		case <-s.stopCh:
+			stopping = true
+		case <-s.kick:
+		case <-t.C:
+		}
+
+		// Seal the active segment only once the backlog is replayed, so an
+		// outage does not turn every tick into a tiny segment.
+		s.mu.Lock()
+		caughtUp := len(s.sealed) == 0
+		s.mu.Unlock()
+		if caughtUp || stopping {
+			if err := s.rotate(true); err != nil && s.logger != nil {
+				s.logger.PrintError(err, map[string]string{"component": "ingest_spool"})
+			}
+		}
+
+		err := s.drainSealed()
+		if stopping {
+			// One last pass; whatever remains is replayed on next start.
+			return
+		}
+		if err == nil {
+			backoff = s.cfg.DrainInterval
+			continue
+		}
+
+		if s.logger != nil {
+			s.logger.PrintError(err, map[string]string{
+				"component": "ingest_spool",
+				"retry_in":  backoff.String(),
+			})
+		}
+		select {
+		case <-s.stopCh:
+			_ = s.drainSealed()
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// drainSealed replays sealed segments oldest first and removes each one
+// after all of its records are committed.
+func (s *Spool) drainSealed() error {
+	for {
+		s.mu.Lock()
+		if len(s.sealed) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		seg := s.sealed[0]
+		s.mu.Unlock()
+
+		if err := s.replaySegment(&seg); err != nil {
+			s.mu.Lock()
+			s.sealed[0].replayed = seg.replayed
+			s.mu.Unlock()
+			return err
+		}
+
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		_ = syncDir(s.cfg.Dir)
+
+		s.mu.Lock()
+		s.sealed = s.sealed[1:]
+		s.mu.Unlock()
+	}
+}
+
+func (s *Spool) replaySegment(seg *segmentInfo) error {
+	sr, err := openSegmentReader(seg.path, seg.replayed)
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	batch := make([]spooledEvent, 0, s.cfg.MaxBatch)
+	batchStart := sr.offset
+	skipped := 0
+
+	commit := func() error {
+		if len(batch) == 0 {
+			if skipped > 0 {
+				s.pendingRecords.Add(-int64(skipped))
+				s.pendingBytes.Add(-(sr.offset - batchStart))
+				seg.replayed = sr.offset
+				batchStart = sr.offset
+				skipped = 0
+			}
+			return nil
+		}
+		// A replay serves many earlier requests: it starts its own trace
+		// and links to each of them.
+		_, span := s.cfg.Tracer.Start(s.drainCtx, "ingest.spool_replay", telemetry.AsRoot())
+		span.SetAttr("batch_size", len(batch))
+		span.SetAttr("segment", int64(seg.id))
+		for _, se := range batch {
+			span.AddLink(se.trace)
+		}
+
+		start := time.Now()
+		err := s.insertIsolating(telemetry.ContextWithSpan(s.drainCtx, span), batch)
+		span.SetError(err)
+		span.End()
+		s.flushes.record(err != nil, time.Now())
+		if err != nil {
+			s.cfg.Metrics.observeError("spool", err)
+			return err
+		}
+		s.cfg.Metrics.observeFlush("spool", len(batch), time.Since(start))
+
+		s.pendingRecords.Add(-int64(len(batch) + skipped))
+		s.pendingBytes.Add(-(sr.offset - batchStart))
+		seg.replayed = sr.offset
+		batchStart = sr.offset
+		batch = batch[:0]
+		skipped = 0
+		return nil
+	}
+
+	for {
+		payload, err := sr.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		se, err := decodeRecord(payload)
+		if err != nil {
+			// Retrying cannot fix it; keep the payload in the log and move on
+			// rather than stall the backlog behind it.
+			s.skipRecord(seg, payload, err)
+			skipped++
+			continue
+		}
+		batch = append(batch, se)
+
+		if len(batch) >= s.cfg.MaxBatch {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return commit()
+}
+
+// skipRecord drops a record whose checksum matched but whose payload does not
+// decode. The payload is logged in full so it can still be recovered.
+func (s *Spool) skipRecord(seg *segmentInfo, payload []byte, err error) {
+	err = fmt.Errorf("%w: %v", errCorruptRecord, err)
+	s.cfg.Metrics.observeError("spool", err)
+	s.cfg.Metrics.observeEvents("spool", 0, 0, 1)
+	if s.logger != nil {
+		s.logger.PrintError(err, map[string]string{
+			"component": "ingest_spool",
+			"segment":   segmentName(seg.id),
+			"payload":   string(payload),
+		})
+	}
+}
+
+// insertIsolating commits batch, bisecting on data errors so that events the
+// database rejects are dead-lettered instead of blocking the drainer forever.
+func (s *Spool) insertIsolating(ctx context.Context, batch []spooledEvent) error {
+	events := make([]domain.Event, 0, len(batch))
+	for _, se := range batch {
+		events = append(events, se.ev)
+	}
+
+	insertCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	insertedKeys, err := s.repo.InsertBatch(insertCtx, events)
+	cancel()
+
+	if err == nil {
+		s.cfg.Metrics.observeEvents("spool", len(insertedKeys), len(batch)-len(insertedKeys), 0)
+		return nil
+	}
+	if classifyError(err) != errData {
+		return err
+	}
+
+	if len(batch) > 1 {
+		mid := len(batch) / 2
+		if err := s.insertIsolating(ctx, batch[:mid]); err != nil {
+			return err
+		}
+		return s.insertIsolating(ctx, batch[mid:])
+	}
+
+	rej := &RejectedError{DedupKey: batch[0].ev.DedupKey, Err: err}
+	s.cfg.Metrics.observeError("spool", rej)
+	s.cfg.Metrics.observeEvents("spool", 0, 0, 1)
+	if s.logger != nil {
+		s.logger.PrintError(rej, map[string]string{
+			"component": "ingest_spool",
+			"dedup_key": rej.DedupKey,
+		})
+	}
+	dl := domain.DeadLetter{
+		Component: "ingest_spool",
+		RequestID: batch[0].requestID,
+		DedupKey:  batch[0].ev.DedupKey,
+		Error:     rej.Error(),
+		Event:     batch[0].ev,
+	}
+	// A replayed dead letter was marked replayed when the spool accepted it;
+	// put it back rather than recording the event twice.
+	if id := batch[0].deadLetterID; id != 0 {
+		reopenDeadLetter(s.dead, s.logger, dl, id)
+		return nil
+	}
+	recordDeadLetters(s.dead, s.logger, []domain.DeadLetter{dl})
+	return nil
+}
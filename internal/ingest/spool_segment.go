@@ -0,0 +1,242 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/telemetry"
+)
+
+// On-disk record layout (little endian):
+//
+//	[4] payload length
+//	[4] crc32c(payload)
+//	[n] payload (JSON spoolRecord)
+//
+// A record whose header is short, whose length is implausible or whose
+// checksum does not match marks the torn tail of a segment.
+
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 16 << 20
+
+	segmentPrefix = "seg-"
+	segmentSuffix = ".log"
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errCorruptRecord = errors.New("corrupt spool record")
+)
+
+type spoolRecord struct {
+	RequestID    string `json:"request_id,omitempty"`
+	DeadLetterID int64  `json:"dead_letter_id,omitempty"`
+	Trace        string `json:"traceparent,omitempty"`
+
+	DedupKey   string          `json:"dedup_key"`
+	EventName  string          `json:"event_name"`
+	Channel    string          `json:"channel"`
+	CampaignID string          `json:"campaign_id,omitempty"`
+	UserID     string          `json:"user_id"`
+	Timestamp  time.Time       `json:"ts"`
+	Tags       []string        `json:"tags"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+}
+
+// spooledEvent is a decoded record plus the request it came from.
+type spooledEvent struct {
+	ev           domain.Event
+	requestID    string
+	deadLetterID int64
+	trace        telemetry.SpanContext
+}
+
+// encodeRecord frames e with the request details a dead letter needs; trace
+// is the submitting request's span (if any) so the replay flush can link back
+// to it.
+func encodeRecord(e domain.Event, meta RequestMeta, trace telemetry.SpanContext) ([]byte, error) {
+	rec := spoolRecord{
+		RequestID:    meta.RequestID,
+		DeadLetterID: meta.DeadLetterID,
+		DedupKey:     e.DedupKey,
+		EventName:    e.EventName,
+		Channel:      e.Channel,
+		CampaignID:   e.CampaignID,
+		UserID:       e.UserID,
+		Timestamp:    e.Timestamp,
+		Tags:         e.Tags,
+		Metadata:     e.Metadata,
+	}
+	if trace.IsValid() {
+		rec.Trace = trace.Traceparent()
+	}
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("spool record too large (%d bytes)", len(payload))
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+	return buf, nil
+}
+
+func decodeRecord(payload []byte) (spooledEvent, error) {
+	var rec spoolRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return spooledEvent{}, err
+	}
+	tags := rec.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	ev := domain.Event{
+		DedupKey:   rec.DedupKey,
+		EventName:  rec.EventName,
+		Channel:    rec.Channel,
+		CampaignID: rec.CampaignID,
+		UserID:     rec.UserID,
+		Timestamp:  rec.Timestamp.UTC(),
+		Tags:       tags,
+		Metadata:   rec.Metadata,
+	}
+	trace, _ := telemetry.ParseTraceparent(rec.Trace)
+	return spooledEvent{ev: ev, requestID: rec.RequestID, deadLetterID: rec.DeadLetterID, trace: trace}, nil
+}
+
+// segmentReader yields records from a segment file starting at a byte offset.
+type segmentReader struct {
+	f      *os.File
+	r      *bufio.Reader
+	offset int64
+}
+
+func openSegmentReader(path string, offset int64) (*segmentReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return &segmentReader{f: f, r: bufio.NewReaderSize(f, 256<<10), offset: offset}, nil
+}
+
+// next returns io.EOF at a clean end of segment and errCorruptRecord on a torn
+// or mismatching record. offset only advances past fully valid records.
+func (sr *segmentReader) next() ([]byte, error) {
+	var hdr [recordHeaderSize]byte
+	if _, err := io.ReadFull(sr.r, hdr[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errCorruptRecord
+		}
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(hdr[0:4])
+	sum := binary.LittleEndian.Uint32(hdr[4:8])
+	if n == 0 || n > maxRecordSize {
+		return nil, errCorruptRecord
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errCorruptRecord
+		}
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != sum {
+		return nil, errCorruptRecord
+	}
+
+	sr.offset += int64(recordHeaderSize) + int64(n)
+	return payload, nil
+}
+
+func (sr *segmentReader) Close() error { return sr.f.Close() }
+
+// scanSegment validates a segment and returns the number of valid records
+// and the offset where the valid prefix ends.
+func scanSegment(path string) (records int64, validSize int64, err error) {
+	sr, err := openSegmentReader(path, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer sr.Close()
+
+	for {
+		// A record that passes the checksum but does not decode is kept: it
+		// is intact on disk, and the drainer skips it without dropping the
+		// records after it.
+		_, err := sr.next()
+		if errors.Is(err, io.EOF) || errors.Is(err, errCorruptRecord) {
+			return records, sr.offset, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		records++
+	}
+}
+
+func segmentName(id uint64) string {
+	return fmt.Sprintf("%s%020d%s", segmentPrefix, id, segmentSuffix)
+}
+
+// listSegments returns segment ids in dir in ascending order.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// syncDir makes segment creation/removal durable.
+func syncDir(dir string) error {
+	d, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
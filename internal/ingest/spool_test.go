@@ -0,0 +1,435 @@
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/telemetry"
+)
+
+// memRepo keeps inserted keys in order. While fail is set, or on the call
+// numbered failOn (1-based), InsertBatch returns a transient error.
+type memRepo struct {
+	mu     sync.Mutex
+	fail   bool
+	failOn int
+	calls  int
+	keys   []string
+}
+
+func (r *memRepo) InsertBatch(_ context.Context, events []domain.Event) (map[string]struct{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.fail || r.calls == r.failOn {
+		return nil, errors.New("connection refused")
+	}
+	out := make(map[string]struct{}, len(events))
+	for _, e := range events {
+		r.keys = append(r.keys, e.DedupKey)
+		out[e.DedupKey] = struct{}{}
+	}
+	return out, nil
+}
+
+func (r *memRepo) setFail(fail bool) {
+	r.mu.Lock()
+	r.fail = fail
+	r.mu.Unlock()
+}
+
+func (r *memRepo) inserted() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.keys)
+}
+
+func testEvent(key string) domain.Event {
+	return domain.Event{
+		DedupKey:  key,
+		EventName: "page_view",
+		Channel:   "web",
+		UserID:    "u1",
+		Timestamp: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Tags:      []string{},
+	}
+}
+
+func testRecord(t *testing.T, key string) []byte {
+	t.Helper()
+	rec, err := encodeRecord(testEvent(key), RequestMeta{}, telemetry.SpanContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// frame wraps payload in a record header with a valid checksum.
+func frame(payload []byte) []byte {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+	return buf
+}
+
+func keysN(prefix string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s%03d", prefix, i)
+	}
+	return keys
+}
+
+func newTestSpool(repo batchRepo, cfg SpoolConfig) *Spool {
+	return NewSpool(repo, nopDeadLetters{}, cfg, jsonlog.New(io.Discard, jsonlog.LevelError))
+}
+
+func TestSpoolRecover(t *testing.T) {
+	intact := keysN("k", 3)
+
+	tests := []struct {
+		name string
+		// tail is appended after the intact records.
+		tail func(t *testing.T) []byte
+		// extra records kept on disk but not replayable.
+		undecodable int
+	}{
+		{
+			name: "clean",
+			tail: func(*testing.T) []byte { return nil },
+		},
+		{
+			name: "torn header",
+			tail: func(t *testing.T) []byte { return testRecord(t, "torn")[:recordHeaderSize-3] },
+		},
+		{
+			name: "torn payload",
+			tail: func(t *testing.T) []byte {
+				rec := testRecord(t, "torn")
+				return rec[:len(rec)-3]
+			},
+		},
+		{
+			name: "bad checksum",
+			tail: func(t *testing.T) []byte {
+				rec := testRecord(t, "torn")
+				rec[len(rec)-2] ^= 0xff
+				return rec
+			},
+		},
+		{
+			name: "zero length",
+			tail: func(*testing.T) []byte { return make([]byte, recordHeaderSize) },
+		},
+		{
+			// Intact on disk but unusable: kept by recovery, skipped by the
+			// drainer without stopping at it.
+			name:        "undecodable record",
+			tail:        func(*testing.T) []byte { return frame([]byte(`{"ts":"not a time"}`)) },
+			undecodable: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var data []byte
+			for _, k := range intact[:2] {
+				data = append(data, testRecord(t, k)...)
+			}
+			// Undecodable records sit between intact ones.
+			tail := tt.tail(t)
+			if tt.undecodable > 0 {
+				data = append(data, tail...)
+				tail = nil
+			}
+			data = append(data, testRecord(t, intact[2])...)
+			valid := int64(len(data))
+			data = append(data, tail...)
+
+			path := filepath.Join(dir, segmentName(7))
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			repo := &memRepo{}
+			s := newTestSpool(repo, SpoolConfig{Dir: dir})
+			if err := s.recover(); err != nil {
+				t.Fatal(err)
+			}
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != valid {
+				t.Fatalf("segment is %d bytes after recovery, want %d", fi.Size(), valid)
+			}
+			want := int64(len(intact) + tt.undecodable)
+			if d := s.Depth(); d.Records != want || d.Bytes != valid || d.Segments != 1 {
+				t.Fatalf("depth = %+v, want %d records, %d bytes, 1 segment", d, want, valid)
+			}
+			if s.activeID != 8 {
+				t.Fatalf("next segment id = %d, want 8", s.activeID)
+			}
+
+			if err := s.drainSealed(); err != nil {
+				t.Fatal(err)
+			}
+			if got := repo.inserted(); !slices.Equal(got, intact) {
+				t.Fatalf("replayed %v, want %v", got, intact)
+			}
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("segment not removed after replay: %v", err)
+			}
+			if d := s.Depth(); d.Records != 0 || d.Bytes != 0 {
+				t.Fatalf("depth = %+v after replay, want empty", d)
+			}
+		})
+	}
+}
+
+func TestSpoolRecoverRemovesEmptySegments(t *testing.T) {
+	dir := t.TempDir()
+	torn := filepath.Join(dir, segmentName(1))
+	if err := os.WriteFile(torn, testRecord(t, "torn")[:5], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSpool(&memRepo{}, SpoolConfig{Dir: dir})
+	if err := s.recover(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(torn); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("segment without intact records kept: %v", err)
+	}
+	if len(s.sealed) != 0 || s.activeID != 2 {
+		t.Fatalf("sealed = %d, next id = %d; want 0 and 2", len(s.sealed), s.activeID)
+	}
+}
+
+func TestSpoolDrainResumesAfterFailedBatch(t *testing.T) {
+	dir := t.TempDir()
+	keys := keysN("k", 6)
+	var data []byte
+	for _, k := range keys {
+		data = append(data, testRecord(t, k)...)
+	}
+	path := filepath.Join(dir, segmentName(1))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second batch of two fails: the first stays committed, and the
+	// segment stays on disk until the rest is.
+	repo := &memRepo{failOn: 2}
+	s := newTestSpool(repo, SpoolConfig{Dir: dir, MaxBatch: 2})
+	if err := s.recover(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.drainSealed(); err == nil {
+		t.Fatal("drain succeeded with a failing repo")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("segment removed before every record committed: %v", err)
+	}
+	if got := repo.inserted(); !slices.Equal(got, keys[:2]) {
+		t.Fatalf("committed %v, want %v", got, keys[:2])
+	}
+	if d := s.Depth(); d.Records != 4 {
+		t.Fatalf("pending records = %d, want 4", d.Records)
+	}
+
+	if err := s.drainSealed(); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is replayed twice.
+	if got := repo.inserted(); !slices.Equal(got, keys) {
+		t.Fatalf("committed %v, want %v", got, keys)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("segment not removed after replay: %v", err)
+	}
+}
+
+func TestSpoolRotateAndDrain(t *testing.T) {
+	dir := t.TempDir()
+	repo := &memRepo{fail: true}
+	// Every record fills a segment, so each Submit rotates.
+	s := newTestSpool(repo, SpoolConfig{Dir: dir, SegmentBytes: 1, DrainInterval: 5 * time.Millisecond})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := keysN("k", 3)
+	for _, k := range keys {
+		res, err := s.Submit(context.Background(), testEvent(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Accepted() {
+			t.Fatalf("result %+v, want accepted", res)
+		}
+	}
+
+	// Sealed segments stay on disk while the database is down.
+	time.Sleep(20 * time.Millisecond)
+	ids, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(keys)+1 {
+		t.Fatalf("%d segments on disk, want %d sealed and the active one", len(ids), len(keys))
+	}
+	if d := s.Depth(); d.Records != int64(len(keys)) || d.Segments != len(keys) {
+		t.Fatalf("depth = %+v, want %d records in %d segments", d, len(keys), len(keys))
+	}
+
+	repo.setFail(false)
+	deadline := time.Now().Add(10 * time.Second)
+	for s.Depth().Records > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("spool not drained: %+v", s.Depth())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := repo.inserted(); !slices.Equal(got, keys) {
+		t.Fatalf("replayed %v, want %v", got, keys)
+	}
+	if ids, _ := listSegments(dir); len(ids) != 1 {
+		t.Fatalf("%d segments after drain, want only the active one", len(ids))
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := listSegments(dir); len(ids) != 0 {
+		t.Fatalf("%d segments after Stop, want the empty active one removed", len(ids))
+	}
+	if _, err := s.Submit(context.Background(), testEvent("late")); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Submit after Stop: %v, want ErrStopped", err)
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	recSize := int64(len(testRecord(t, "k000")))
+	const limit = 10
+
+	repo := &memRepo{fail: true}
+	s := newTestSpool(repo, SpoolConfig{
+		Dir:           t.TempDir(),
+		MaxBytes:      limit * recSize,
+		Fsync:         FsyncNever,
+		DrainInterval: time.Hour,
+	})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(context.Background())
+
+	// Concurrent submitters must not overshoot the limit together.
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted int
+	)
+	for _, k := range keysN("k", 50) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Submit(context.Background(), testEvent(k))
+			switch {
+			case err == nil:
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			case !errors.Is(err, ErrSpoolFull):
+				t.Errorf("Submit: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != limit {
+		t.Fatalf("accepted %d events, want %d", accepted, limit)
+	}
+	if d := s.Depth(); d.Bytes != limit*recSize || d.Records != limit {
+		t.Fatalf("depth = %+v, want %d records, %d bytes", d, limit, limit*recSize)
+	}
+}
+
+// reopeningDeadLetters records new letters and reopened letter ids.
+type reopeningDeadLetters struct {
+	memDeadLetters
+	reopened []int64
+}
+
+func (d *reopeningDeadLetters) MarkReplayFailed(_ context.Context, id int64, _ string) error {
+	d.mu.Lock()
+	d.reopened = append(d.reopened, id)
+	d.mu.Unlock()
+	return nil
+}
+
+func TestSpoolDeadLettersRejectedRecord(t *testing.T) {
+	tests := []struct {
+		name         string
+		deadLetterID int64
+	}{
+		{"new event", 0},
+		{"replayed dead letter", 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var data []byte
+			for _, k := range []string{"k0", "poison", "k1"} {
+				rec, err := encodeRecord(testEvent(k), RequestMeta{RequestID: "req-" + k, DeadLetterID: tt.deadLetterID}, telemetry.SpanContext{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				data = append(data, rec...)
+			}
+			if err := os.WriteFile(filepath.Join(dir, segmentName(1)), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			repo := &scriptedRepo{poison: "poison"}
+			dead := &reopeningDeadLetters{}
+			s := NewSpool(repo, dead, SpoolConfig{Dir: dir}, jsonlog.New(io.Discard, jsonlog.LevelError))
+			if err := s.recover(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.drainSealed(); err != nil {
+				t.Fatal(err)
+			}
+
+			if keys := slices.Sorted(slices.Values(repo.keys)); !slices.Equal(keys, []string{"k0", "k1"}) {
+				t.Fatalf("committed %v, want k0 and k1", keys)
+			}
+			if tt.deadLetterID != 0 {
+				if len(dead.letters) != 0 || !slices.Equal(dead.reopened, []int64{tt.deadLetterID}) {
+					t.Fatalf("letters %+v, reopened %v; want only %d reopened", dead.letters, dead.reopened, tt.deadLetterID)
+				}
+				return
+			}
+			if len(dead.reopened) != 0 || len(dead.letters) != 1 {
+				t.Fatalf("letters %+v, reopened %v; want one new letter", dead.letters, dead.reopened)
+			}
+			if dl := dead.letters[0]; dl.DedupKey != "poison" || dl.RequestID != "req-poison" || dl.Component != "ingest_spool" {
+				t.Fatalf("dead letter %+v", dl)
+			}
+		})
+	}
+}
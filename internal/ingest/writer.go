@@ -7,6 +7,7 @@ import (
 
 	"github.com/cun0/insider-case/internal/domain"
 	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/cun0/insider-case/internal/telemetry"
 )
 
 var ErrStopped = errors.New("ingest writer stopped")
@@ -17,7 +18,12 @@ type batchRepo interface {
 
 type request struct {
 	ev   domain.Event
+	meta RequestMeta
 	resp chan response
+
+	// trace is the submitting request's span; wait covers time in the queue.
+	trace telemetry.SpanContext
+	wait  *telemetry.Span
 }
 
 type response struct {
@@ -29,19 +35,39 @@ type Config struct {
 	BatchWindow time.Duration
 	MaxBatch    int
 	QueueSize   int
+
+	// Adaptive tunes the window and max batch from arrival rate and commit
+	// latency; BatchWindow and MaxBatch become upper bounds.
+	Adaptive       bool
+	MinBatchWindow time.Duration
+	MinBatch       int
+
+	Admission AdmissionConfig
+
+	// Metrics and Tracer are optional.
+	Metrics *Metrics
+	Tracer  *telemetry.Tracer
 }
 
 type SingleWriter struct {
 	repo   batchRepo
+	dead   DeadLetterStore
 	cfg    Config
 	logger *jsonlog.Logger
 
+	// lane identifies this writer inside a ShardedWriter ("" when standalone).
+	lane string
+
+	adm     *admission
+	tuner   *batchTuner
+	flushes flushWindow
+
 	in     chan request
 	stopCh chan struct{}
 	doneCh chan struct{}
 }
 
-func NewSingleWriter(repo batchRepo, cfg Config, logger *jsonlog.Logger) *SingleWriter {
+func NewSingleWriter(repo batchRepo, dead DeadLetterStore, cfg Config, logger *jsonlog.Logger) *SingleWriter {
 	if cfg.BatchWindow <= 0 {
 		cfg.BatchWindow = 2 * time.Millisecond
 	}
@@ -52,10 +78,14 @@ func NewSingleWriter(repo batchRepo, cfg Config, logger *jsonlog.Logger) *Single
 		cfg.QueueSize = 50_000
 	}
 
+	tuner := newBatchTuner(cfg)
 	return &SingleWriter{
 		repo:   repo,
+		dead:   dead,
 		cfg:    cfg,
 		logger: logger,
+		adm:    newAdmission(cfg.Admission, tuner.shape),
+		tuner:  tuner,
 		in:     make(chan request, cfg.QueueSize),
 		stopCh: make(chan struct{}),
 		doneCh: make(chan struct{}),
@@ -92,17 +122,31 @@ func (w *SingleWriter) Submit(ctx context.Context, e domain.Event) (Result, erro
 	default:
 	}
 
+	// Fail fast instead of queueing an event that cannot commit in time.
+	if err := w.adm.admit(ctx, len(w.in)); err != nil {
+		w.cfg.Metrics.observeRejected("writer")
+		return Result{}, err
+	}
+
+	_, wait := telemetry.StartSpan(ctx, "ingest.queue_wait")
 	req := request{
-		ev:   e,
-		resp: make(chan response, 1), // must be buffered to avoid writer blocking
+		ev:    e,
+		meta:  requestMetaFrom(ctx),
+		resp:  make(chan response, 1), // must be buffered to avoid writer blocking
+		trace: telemetry.SpanFromContext(ctx).Context(),
+		wait:  wait,
 	}
 
 	// orr exit on ctx / stop
 	select {
 	case w.in <- req:
 	case <-ctx.Done():
+		wait.SetError(ctx.Err())
+		wait.End()
 		return Result{}, ctx.Err()
 	case <-w.stopCh:
+		wait.SetError(ErrStopped)
+		wait.End()
 		return Result{}, ErrStopped
 	}
 
@@ -116,6 +160,39 @@ func (w *SingleWriter) Submit(ctx context.Context, e domain.Event) (Result, erro
 	}
 }
 
+// QueueStats reports queued requests and queue capacity.
+func (w *SingleWriter) QueueStats() (depth, capacity int) {
+	return len(w.in), cap(w.in)
+}
+
+// Admission reports the admission policy and its current estimate.
+func (w *SingleWriter) Admission() AdmissionStats {
+	return w.adm.stats(len(w.in))
+}
+
+// Running is false once the writer loop has exited (or is stopping).
+func (w *SingleWriter) Running() bool {
+	select {
+	case <-w.stopCh:
+		return false
+	case <-w.doneCh:
+		return false
+	default:
+		return true
+	}
+}
+
+// FlushErrors reports commits and failed commits over the last minute.
+// Events rejected for their contents do not count as failures.
+func (w *SingleWriter) FlushErrors() (flushes, failures int) {
+	return w.flushes.counts(time.Now())
+}
+
+// Batching reports the batch window and size in effect.
+func (w *SingleWriter) Batching() BatchingStats {
+	return w.tuner.stats()
+}
+
 func (w *SingleWriter) loop() {
 	defer close(w.doneCh)
 
@@ -176,15 +253,44 @@ func (w *SingleWriter) loop() {
 
 		case req := <-w.in:
 			batch = append(batch, req)
+			w.tuner.arrive()
+			window, maxBatch := w.tuner.shape()
+
+			// No window (adaptive, idle): take whatever is already queued
+			// and flush right away.
+			if window <= 0 {
+			drain:
+				for len(batch) < maxBatch {
+					select {
+					case req := <-w.in:
+						batch = append(batch, req)
+						w.tuner.arrive()
+					default:
+						break drain
+					}
+				}
+				if timerC != nil {
+					if !timer.Stop() {
+						select {
+						case <-timer.C:
+						default:
+						}
+					}
+					timerC = nil
+				}
+				w.flush(batch)
+				batch = batch[:0]
+				continue
+			}
 
 			// Arm timer when batch starts.
 			if timerC == nil {
-				timer.Reset(w.cfg.BatchWindow)
+				timer.Reset(window)
 				timerC = timer.C
 			}
 
 			// Flush if we hit max batch.
-			if len(batch) >= w.cfg.MaxBatch {
+			if len(batch) >= maxBatch {
 				if timerC != nil {
 					if !timer.Stop() {
 						select {
@@ -210,25 +316,73 @@ func (w *SingleWriter) loop() {
 
 func (w *SingleWriter) flush(batch []request) {
 	if w.logger != nil {
-		w.logger.PrintInfo("flush batch", map[string]string{
+		w.logger.PrintInfo("flush batch", w.logProps(map[string]string{
 			"batch_size": itoa(len(batch)),
-		})
+		}))
 	}
+	// The flush serves many requests, so it starts its own trace and links
+	// to each of them.
+	_, span := w.cfg.Tracer.Start(context.Background(), "ingest.flush", telemetry.AsRoot())
+	span.SetAttr("batch_size", len(batch))
+	if w.lane != "" {
+		span.SetAttr("shard", w.lane)
+	}
+	for _, r := range batch {
+		r.wait.End()
+		span.AddLink(r.trace)
+	}
+
+	start := time.Now()
+	w.adm.flushStarted(start)
+	w.commit(telemetry.ContextWithSpan(context.Background(), span), batch)
+	took := time.Since(start)
+	w.adm.observeFlush(took)
+	w.tuner.observe(took, time.Now())
+	w.cfg.Metrics.observeFlush("writer", len(batch), took)
+	span.End()
+}
+
+// commit inserts the batch and answers every request in it. On a data error
+// the batch is split in half and each half committed on its own, so only the
+// offending events fail and the rest are stored.
+func (w *SingleWriter) commit(ctx context.Context, batch []request) {
 	events := make([]domain.Event, 0, len(batch))
 	for _, r := range batch {
 		events = append(events, r.ev)
 	}
 
-	// bounded context to avoid hanging forever on DB
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	insertedKeys, err := w.insertWithRetry(ctx, events)
+	if err != nil && classifyError(err) == errData {
+		if len(batch) > 1 {
+			mid := len(batch) / 2
+			w.commitHalf(ctx, batch[:mid])
+			w.commitHalf(ctx, batch[mid:])
+			return
+		}
+		err = &RejectedError{DedupKey: batch[0].ev.DedupKey, Err: err}
+	}
+	telemetry.SpanFromContext(ctx).SetError(err)
+
+	var rej *RejectedError
+	rejected := errors.As(err, &rej)
+	w.flushes.record(err != nil && !rejected, time.Now())
 
-	insertedKeys, err := w.repo.InsertBatch(ctx, events)
 	if err != nil && w.logger != nil {
-		w.logger.PrintError(err, map[string]string{
+		props := map[string]string{
 			"component":  "ingest_writer",
 			"batch_size": itoa(len(batch)),
-		})
+		}
+		if rejected {
+			props["dedup_key"] = rej.DedupKey
+		}
+		w.logger.PrintError(err, w.logProps(props))
+	}
+	if err != nil {
+		w.cfg.Metrics.observeError("writer", err)
+		w.cfg.Metrics.observeEvents("writer", 0, 0, len(batch))
+		w.deadLetter(batch, err)
+	} else {
+		w.cfg.Metrics.observeEvents("writer", len(insertedKeys), len(batch)-len(insertedKeys), 0)
 	}
 
 	for _, r := range batch {
@@ -252,6 +406,69 @@ func (w *SingleWriter) flush(batch []request) {
 	}
 }
 
+// commitHalf commits one side of a bisected batch under its own span.
+func (w *SingleWriter) commitHalf(ctx context.Context, batch []request) {
+	ctx, span := telemetry.StartSpan(ctx, "ingest.bisect")
+	span.SetAttr("batch_size", len(batch))
+	w.commit(ctx, batch)
+	span.End()
+}
+
+func (w *SingleWriter) deadLetter(batch []request, err error) {
+	letters := make([]domain.DeadLetter, 0, len(batch))
+	for _, r := range batch {
+		if r.meta.DeadLetterID != 0 {
+			continue
+		}
+		letters = append(letters, domain.DeadLetter{
+			Component: "ingest_writer",
+			RequestID: r.meta.RequestID,
+			DedupKey:  r.ev.DedupKey,
+			Error:     err.Error(),
+			Payload:   r.meta.Payload,
+			Event:     r.ev,
+		})
+	}
+	recordDeadLetters(w.dead, w.logger, letters)
+}
+
+// maxRetries is how many times a transiently failing insert is retried.
+const maxRetries = 2
+
+// insertWithRetry retries transient failures a bounded number of times.
+func (w *SingleWriter) insertWithRetry(parent context.Context, events []domain.Event) (map[string]struct{}, error) {
+	backoff := 50 * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		// bounded context to avoid hanging forever on DB
+		ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+		insertedKeys, err := w.repo.InsertBatch(ctx, events)
+		cancel()
+
+		if err == nil || attempt >= maxRetries || classifyError(err) != errTransient {
+			return insertedKeys, err
+		}
+
+		if w.logger != nil {
+			w.logger.PrintError(err, w.logProps(map[string]string{
+				"component":  "ingest_writer",
+				"batch_size": itoa(len(events)),
+				"attempt":    itoa(attempt + 1),
+				"retry_in":   backoff.String(),
+			}))
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *SingleWriter) logProps(props map[string]string) map[string]string {
+	if w.lane != "" {
+		props["shard"] = w.lane
+	}
+	return props
+}
+
 // small helper to avoid fmt in a hot-ish path
 func itoa(n int) string {
 	if n == 0 {
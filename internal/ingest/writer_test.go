@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/jsonlog"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// scriptedRepo fails any batch holding a poison key with a data error, and
+// the first transient calls with a transient one. It records the size of
+// every call and whether it failed.
+type scriptedRepo struct {
+	poison    string
+	transient int
+
+	mu     sync.Mutex
+	calls  []int
+	failed []int
+	keys   []string
+}
+
+func (r *scriptedRepo) InsertBatch(_ context.Context, events []domain.Event) (map[string]struct{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, len(events))
+
+	if r.transient > 0 {
+		r.transient--
+		r.failed = append(r.failed, len(events))
+		return nil, errors.New("connection reset by peer")
+	}
+	for _, e := range events {
+		if e.DedupKey == r.poison {
+			r.failed = append(r.failed, len(events))
+			return nil, &pgconn.PgError{Code: "22P02", Message: "invalid input syntax for type json"}
+		}
+	}
+
+	out := make(map[string]struct{}, len(events))
+	for _, e := range events {
+		r.keys = append(r.keys, e.DedupKey)
+		out[e.DedupKey] = struct{}{}
+	}
+	return out, nil
+}
+
+type memDeadLetters struct {
+	mu      sync.Mutex
+	letters []domain.DeadLetter
+}
+
+func (d *memDeadLetters) Insert(_ context.Context, letters []domain.DeadLetter) error {
+	d.mu.Lock()
+	d.letters = append(d.letters, letters...)
+	d.mu.Unlock()
+	return nil
+}
+
+func startTestWriter(t *testing.T, repo batchRepo, dead DeadLetterStore, cfg Config) *SingleWriter {
+	t.Helper()
+	w := NewSingleWriter(repo, dead, cfg, jsonlog.New(io.Discard, jsonlog.LevelError))
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Stop(context.Background()) })
+	return w
+}
+
+func TestWriterBisectsPoisonEvent(t *testing.T) {
+	const n = 8
+	repo := &scriptedRepo{poison: "k5"}
+	dead := &memDeadLetters{}
+	// A long window: the batch is flushed when all n events are in it.
+	w := startTestWriter(t, repo, dead, Config{BatchWindow: 5 * time.Second, MaxBatch: n})
+
+	var (
+		wg   sync.WaitGroup
+		res  = make([]Result, n)
+		errs = make([]error, n)
+	)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res[i], errs[i] = w.Submit(context.Background(), domain.Event{DedupKey: "k" + strconv.Itoa(i)})
+		}()
+	}
+	wg.Wait()
+
+	for i := range n {
+		if i == 5 {
+			var rej *RejectedError
+			if !errors.As(errs[i], &rej) || rej.DedupKey != "k5" {
+				t.Fatalf("poison event: err = %v, want *RejectedError for k5", errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil || !res[i].Inserted() {
+			t.Fatalf("event %d: %+v, %v; want inserted", i, res[i], errs[i])
+		}
+	}
+
+	// One batch, then halves down to the poison event alone; data errors
+	// are not retried.
+	if repo.calls[0] != n {
+		t.Fatalf("first call had %d events, want %d", repo.calls[0], n)
+	}
+	if want := []int{8, 4, 2, 1}; !slices.Equal(repo.failed, want) {
+		t.Fatalf("failed calls with %v events, want %v", repo.failed, want)
+	}
+	keys := slices.Sorted(slices.Values(repo.keys))
+	if want := []string{"k0", "k1", "k2", "k3", "k4", "k6", "k7"}; !slices.Equal(keys, want) {
+		t.Fatalf("committed %v, want %v", keys, want)
+	}
+
+	if len(dead.letters) != 1 || dead.letters[0].DedupKey != "k5" {
+		t.Fatalf("dead letters %+v, want only k5", dead.letters)
+	}
+	if dl := dead.letters[0]; dl.Component != "ingest_writer" || dl.Error == "" {
+		t.Fatalf("dead letter %+v, want component ingest_writer and the error", dl)
+	}
+}
+
+func TestWriterRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		transient int
+		wantErr   bool
+	}{
+		{"recovers on the last retry", maxRetries, false},
+		{"gives up after maxRetries", maxRetries + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &scriptedRepo{transient: tt.transient}
+			dead := &memDeadLetters{}
+			w := startTestWriter(t, repo, dead, Config{BatchWindow: time.Millisecond, MaxBatch: 10})
+
+			res, err := w.Submit(context.Background(), domain.Event{DedupKey: "k"})
+
+			if got := len(repo.calls); got != maxRetries+1 {
+				t.Fatalf("%d attempts, want %d", got, maxRetries+1)
+			}
+			if !tt.wantErr {
+				if err != nil || !res.Inserted() {
+					t.Fatalf("%+v, %v; want inserted", res, err)
+				}
+				if len(dead.letters) != 0 {
+					t.Fatalf("dead letters %+v after recovering", dead.letters)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("no error after exhausting retries")
+			}
+			var rej *RejectedError
+			if errors.As(err, &rej) {
+				t.Fatalf("transient failure reported as rejected: %v", err)
+			}
+			if len(dead.letters) != 1 || dead.letters[0].DedupKey != "k" {
+				t.Fatalf("dead letters %+v, want k", dead.letters)
+			}
+		})
+	}
+}
+
+func TestWriterSkipsDeadLetterOnReplay(t *testing.T) {
+	repo := &scriptedRepo{poison: "k"}
+	dead := &memDeadLetters{}
+	w := startTestWriter(t, repo, dead, Config{BatchWindow: time.Millisecond, MaxBatch: 10})
+
+	// A re-driven dead letter is the caller's to update.
+	ctx := WithRequestMeta(context.Background(), RequestMeta{DeadLetterID: 42})
+	if _, err := w.Submit(ctx, domain.Event{DedupKey: "k"}); err == nil {
+		t.Fatal("poison event committed")
+	}
+	if len(dead.letters) != 0 {
+		t.Fatalf("replay recorded a new dead letter: %+v", dead.letters)
+	}
+}
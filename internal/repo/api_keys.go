@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKeyRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewAPIKeyRepo(pool *pgxpool.Pool) *APIKeyRepo {
+	return &APIKeyRepo{pool: pool}
+}
+
+func (r *APIKeyRepo) Create(ctx context.Context, name, prefix string, hash []byte, scopes []string) (domain.APIKey, error) {
+	const q = `
+INSERT INTO api_keys (name, prefix, key_hash, scopes)
+VALUES ($1, $2, $3, $4)
+RETURNING id, name, prefix, scopes, created_at, revoked_at;
+`
+	return scanAPIKey(r.pool.QueryRow(ctx, q, name, prefix, hash, scopes))
+}
+
+func (r *APIKeyRepo) List(ctx context.Context) ([]domain.APIKey, error) {
+	const q = `
+SELECT id, name, prefix, scopes, created_at, revoked_at
+FROM api_keys
+ORDER BY id;
+`
+	rows, err := r.pool.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// Revoke marks an active key as revoked; ErrNotFound if no active key has id.
+func (r *APIKeyRepo) Revoke(ctx context.Context, id int64) error {
+	const q = `
+UPDATE api_keys
+SET revoked_at = now()
+WHERE id = $1 AND revoked_at IS NULL;
+`
+	tag, err := r.pool.Exec(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetByHash returns the key (revoked or not) or ErrNotFound.
+func (r *APIKeyRepo) GetByHash(ctx context.Context, hash []byte) (domain.APIKey, error) {
+	const q = `
+SELECT id, name, prefix, scopes, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1;
+`
+	k, err := scanAPIKey(r.pool.QueryRow(ctx, q, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.APIKey{}, ErrNotFound
+	}
+	return k, err
+}
+
+func scanAPIKey(row pgx.Row) (domain.APIKey, error) {
+	var k domain.APIKey
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.RevokedAt)
+	return k, err
+}
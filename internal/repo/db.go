@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/cun0/insider-case/internal/config"
+	"github.com/cun0/insider-case/internal/telemetry"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -35,3 +36,43 @@ func NewPool(ctx context.Context, cfg config.DBConfig) (*pgxpool.Pool, error) {
 
 	return pool, nil
 }
+
+// startDBSpan starts a client span for a SQL call when ctx is traced.
+func startDBSpan(ctx context.Context, name, operation string) (context.Context, *telemetry.Span) {
+	ctx, span := telemetry.StartSpan(ctx, name, telemetry.WithKind(telemetry.SpanKindClient))
+	span.SetAttr("db.system", "postgresql")
+	span.SetAttr("db.operation", operation)
+	return ctx, span
+}
+
+func endDBSpan(span *telemetry.Span, err error) {
+	span.SetError(err)
+	span.End()
+}
+
+// RegisterPoolMetrics exposes pgxpool statistics, sampled at scrape time.
+func RegisterPoolMetrics(reg *telemetry.Registry, pool *pgxpool.Pool) {
+	gauge := func(name, help string, fn func(s *pgxpool.Stat) float64) {
+		reg.NewGaugeFunc(name, help, func() float64 { return fn(pool.Stat()) })
+	}
+	counter := func(name, help string, fn func(s *pgxpool.Stat) float64) {
+		reg.NewCounterFunc(name, help, func() float64 { return fn(pool.Stat()) })
+	}
+
+	gauge("pgxpool_acquired_conns", "Connections currently checked out.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("pgxpool_idle_conns", "Idle connections in the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	gauge("pgxpool_total_conns", "Open connections (acquired, idle and constructing).",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("pgxpool_max_conns", "Configured maximum pool size.",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	counter("pgxpool_acquire_total", "Successful connection acquires.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("pgxpool_acquire_duration_seconds_total", "Total time spent acquiring connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+	counter("pgxpool_empty_acquire_total", "Acquires that had to wait for a connection.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("pgxpool_canceled_acquire_total", "Acquires canceled by their context.",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+}
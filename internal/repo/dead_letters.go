@@ -0,0 +1,180 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNotFound is domain.ErrNotFound, so callers outside repo can match it
+// without importing this package.
+var ErrNotFound = domain.ErrNotFound
+
+type DeadLetterRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewDeadLetterRepo(pool *pgxpool.Pool) *DeadLetterRepo {
+	return &DeadLetterRepo{pool: pool}
+}
+
+type DeadLetterFilter struct {
+	Status   string // "" = any
+	BeforeID int64  // 0 = from newest
+	AfterID  int64  // 0 = from oldest
+	Limit    int
+
+	// OldestFirst lists in ascending id order (BeforeID still applies).
+	OldestFirst bool
+}
+
+func (r *DeadLetterRepo) Insert(ctx context.Context, letters []domain.DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+
+	const q = `
+	INSERT INTO dead_letters (component, request_id, dedup_key, error, payload, event)
+	VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6);
+`
+
+	batch := &pgx.Batch{}
+	for _, dl := range letters {
+		ev, err := json.Marshal(dl.Event)
+		if err != nil {
+			return err
+		}
+		var payload *string
+		if len(dl.Payload) > 0 {
+			s := string(dl.Payload)
+			payload = &s
+		}
+		batch.Queue(q, dl.Component, dl.RequestID, dl.DedupKey, dl.Error, payload, string(ev))
+	}
+
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const deadLetterColumns = `
+  id, created_at, component, COALESCE(request_id, ''), dedup_key, error,
+  payload, event, status, replay_attempts, COALESCE(last_replay_error, ''), replayed_at`
+
+func (r *DeadLetterRepo) List(ctx context.Context, f DeadLetterFilter) ([]domain.DeadLetter, error) {
+	order := "DESC"
+	if f.OldestFirst {
+		order = "ASC"
+	}
+
+	q := `
+SELECT` + deadLetterColumns + `
+FROM dead_letters
+WHERE ($1 = '' OR status = $1)
+  AND ($2 = 0 OR id < $2)
+  AND ($4 = 0 OR id > $4)
+ORDER BY id ` + order + `
+LIMIT $3;
+`
+	rows, err := r.pool.Query(ctx, q, f.Status, f.BeforeID, f.Limit, f.AfterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]domain.DeadLetter, 0, f.Limit)
+	for rows.Next() {
+		dl, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+func (r *DeadLetterRepo) Get(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	q := `
+SELECT` + deadLetterColumns + `
+FROM dead_letters
+WHERE id = $1;
+`
+	dl, err := scanDeadLetter(r.pool.QueryRow(ctx, q, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.DeadLetter{}, ErrNotFound
+	}
+	return dl, err
+}
+
+func (r *DeadLetterRepo) MarkReplayed(ctx context.Context, id int64) error {
+	const q = `
+UPDATE dead_letters
+SET status = 'replayed',
+    replay_attempts = replay_attempts + 1,
+    last_replay_error = NULL,
+    replayed_at = now()
+WHERE id = $1;
+`
+	_, err := r.pool.Exec(ctx, q, id)
+	return err
+}
+
+// MarkReplayFailed records a failed replay and puts the letter back in
+// pending. A letter already marked replayed was accepted by the spool and
+// failed on drain; that attempt was counted when it was marked.
+func (r *DeadLetterRepo) MarkReplayFailed(ctx context.Context, id int64, replayErr string) error {
+	const q = `
+UPDATE dead_letters
+SET status = 'pending',
+    replay_attempts = replay_attempts + CASE WHEN status = 'replayed' THEN 0 ELSE 1 END,
+    last_replay_error = $2,
+    replayed_at = NULL
+WHERE id = $1;
+`
+	_, err := r.pool.Exec(ctx, q, id, replayErr)
+	return err
+}
+
+func scanDeadLetter(row pgx.Row) (domain.DeadLetter, error) {
+	var (
+		dl      domain.DeadLetter
+		payload *string
+		event   string
+	)
+	err := row.Scan(
+		&dl.ID,
+		&dl.CreatedAt,
+		&dl.Component,
+		&dl.RequestID,
+		&dl.DedupKey,
+		&dl.Error,
+		&payload,
+		&event,
+		&dl.Status,
+		&dl.ReplayAttempts,
+		&dl.LastReplayError,
+		&dl.ReplayedAt,
+	)
+	if err != nil {
+		return domain.DeadLetter{}, err
+	}
+
+	if payload != nil {
+		dl.Payload = json.RawMessage(*payload)
+	}
+	if err := json.Unmarshal([]byte(event), &dl.Event); err != nil {
+		return domain.DeadLetter{}, err
+	}
+	return dl, nil
+}
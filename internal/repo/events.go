@@ -4,30 +4,63 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/cun0/insider-case/internal/domain"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+type InsertMode string
+
+const (
+	// InsertValues builds one multi-row INSERT with 8 parameters per row.
+	InsertValues InsertMode = "values"
+	// InsertCopy COPYs rows into a temp staging table and inserts from there.
+	InsertCopy InsertMode = "copy"
+)
+
 type EventRepo struct {
 	pool *pgxpool.Pool
+	mode InsertMode
 }
 
-func NewEventRepo(pool *pgxpool.Pool) *EventRepo {
-	return &EventRepo{pool: pool}
+func NewEventRepo(pool *pgxpool.Pool, mode InsertMode) *EventRepo {
+	if mode == "" {
+		mode = InsertValues
+	}
+	return &EventRepo{pool: pool, mode: mode}
+}
+
+// MaxBatchRows is the largest batch InsertBatch handles in one statement.
+// The VALUES path is bound by PostgreSQL's 65535 parameter limit (8 per row,
+// with a safe margin); COPY has no such limit.
+func (r *EventRepo) MaxBatchRows() int {
+	if r.mode == InsertCopy {
+		return 50_000
+	}
+	return 4000
 }
 
 func (r *EventRepo) InsertOne(ctx context.Context, e domain.Event) (inserted bool, err error) {
+	ctx, span := startDBSpan(ctx, "db.insert_one", "INSERT")
+	defer func() { endDBSpan(span, err) }()
+
 	const q = `
 	INSERT INTO events (dedup_key, event_name, channel, campaign_id, user_id, ts, tags, metadata)
 	VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8::jsonb)
-	ON CONFLICT (dedup_key) DO NOTHING
+	ON CONFLICT (dedup_key, ts) DO NOTHING
 	RETURNING 1;
 `
 
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
 	var one int
-	err = r.pool.QueryRow(ctx, q,
+	err = tx.QueryRow(ctx, q,
 		e.DedupKey,
 		e.EventName,
 		e.Channel,
@@ -38,30 +71,56 @@ func (r *EventRepo) InsertOne(ctx context.Context, e domain.Event) (inserted boo
 		toJSONBText(e.Metadata),
 	).Scan(&one)
 
-	if err == nil {
-		return true, nil
-	}
 	if err == pgx.ErrNoRows {
 		return false, nil
 	}
-	return false, err
+	if err != nil {
+		return false, err
+	}
+
+	keys := map[string]struct{}{e.DedupKey: {}}
+	if err := writeEventKeys(ctx, tx, []domain.Event{e}, keys); err != nil {
+		return false, err
+	}
+	if err := writeRollups(ctx, tx, []domain.Event{e}, keys); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func (r *EventRepo) InsertBatch(ctx context.Context, events []domain.Event) (map[string]struct{}, error) {
+func (r *EventRepo) InsertBatch(ctx context.Context, events []domain.Event) (_ map[string]struct{}, err error) {
 	inserted := make(map[string]struct{})
 	if len(events) == 0 {
 		return inserted, nil
 	}
 
+	op := "INSERT"
+	if r.mode == InsertCopy {
+		op = "COPY"
+	}
+	ctx, span := startDBSpan(ctx, "db.insert_batch", op)
+	span.SetAttr("db.rows", len(events))
+	defer func() {
+		span.SetAttr("db.rows_inserted", len(inserted))
+		endDBSpan(span, err)
+	}()
+
 	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	sql, args := buildInsertBatchSQL(events)
-
-	rows, err := tx.Query(ctx, sql, args...)
+	var rows pgx.Rows
+	if r.mode == InsertCopy {
+		rows, err = copyInsertBatch(ctx, tx, events)
+	} else {
+		sql, args := buildInsertBatchSQL(events)
+		rows, err = tx.Query(ctx, sql, args...)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +137,14 @@ func (r *EventRepo) InsertBatch(ctx context.Context, events []domain.Event) (map
 		return nil, err
 	}
 
+	// Same transaction: rollups never count an event that was rolled back.
+	if err := writeEventKeys(ctx, tx, events, inserted); err != nil {
+		return nil, err
+	}
+	if err := writeRollups(ctx, tx, events, inserted); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
@@ -85,6 +152,37 @@ func (r *EventRepo) InsertBatch(ctx context.Context, events []domain.Event) (map
 	return inserted, nil
 }
 
+// writeEventKeys records the ts of each inserted event in event_keys
+// (migrations/012), so GetByDedupKey reads a single partition.
+func writeEventKeys(ctx context.Context, tx pgx.Tx, events []domain.Event, inserted map[string]struct{}) error {
+	if len(inserted) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(inserted))
+	ts := make([]time.Time, 0, len(inserted))
+	seen := make(map[string]struct{}, len(inserted))
+	for _, e := range events {
+		if _, ok := inserted[e.DedupKey]; !ok {
+			continue
+		}
+		if _, dup := seen[e.DedupKey]; dup {
+			continue
+		}
+		seen[e.DedupKey] = struct{}{}
+		keys = append(keys, e.DedupKey)
+		ts = append(ts, e.Timestamp)
+	}
+
+	const q = `
+	INSERT INTO event_keys (dedup_key, ts)
+	SELECT * FROM unnest($1::text[], $2::timestamptz[])
+	ON CONFLICT DO NOTHING;
+`
+	_, err := tx.Exec(ctx, q, keys, ts)
+	return err
+}
+
 func buildInsertBatchSQL(events []domain.Event) (string, []any) {
 	var b strings.Builder
 	// 8 params per event.
@@ -121,13 +219,64 @@ func buildInsertBatchSQL(events []domain.Event) (string, []any) {
 	}
 
 	b.WriteString(`
-	ON CONFLICT (dedup_key) DO NOTHING
+	ON CONFLICT (dedup_key, ts) DO NOTHING
 	RETURNING dedup_key;
 `)
 
 	return b.String(), args
 }
 
+var stagingColumns = []string{"dedup_key", "event_name", "channel", "campaign_id", "user_id", "ts", "tags", "metadata"}
+
+// copyInsertBatch streams events into a per-connection temp table with COPY
+// and moves them into events with a single INSERT ... SELECT. metadata is
+// staged as text so invalid jsonb still fails on the INSERT with a data error.
+func copyInsertBatch(ctx context.Context, tx pgx.Tx, events []domain.Event) (pgx.Rows, error) {
+	const createStaging = `
+	CREATE TEMP TABLE IF NOT EXISTS events_staging (
+	  dedup_key   TEXT,
+	  event_name  TEXT,
+	  channel     TEXT,
+	  campaign_id TEXT,
+	  user_id     TEXT,
+	  ts          TIMESTAMPTZ,
+	  tags        TEXT[],
+	  metadata    TEXT
+	) ON COMMIT DELETE ROWS;
+`
+	if _, err := tx.Exec(ctx, createStaging); err != nil {
+		return nil, err
+	}
+
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"events_staging"}, stagingColumns,
+		pgx.CopyFromSlice(len(events), func(i int) ([]any, error) {
+			e := events[i]
+			return []any{
+				e.DedupKey,
+				e.EventName,
+				e.Channel,
+				e.CampaignID,
+				e.UserID,
+				e.Timestamp,
+				e.Tags,
+				toJSONBText(e.Metadata),
+			}, nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	const moveStaged = `
+	INSERT INTO events (dedup_key, event_name, channel, campaign_id, user_id, ts, tags, metadata)
+	SELECT dedup_key, event_name, channel, NULLIF(campaign_id, ''), user_id, ts, tags, metadata::jsonb
+	FROM events_staging
+	ON CONFLICT (dedup_key, ts) DO NOTHING
+	RETURNING dedup_key;
+`
+	return tx.Query(ctx, moveStaged)
+}
+
 func toJSONBText(raw []byte) string {
 	if len(raw) == 0 {
 		return `{}`
@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// EventCursor is the position of the last row of a page; the next page
+// starts strictly after it in (ts, id) DESC order.
+type EventCursor struct {
+	TS time.Time
+	ID int64
+}
+
+type UserEventFilter struct {
+	UserID    string
+	EventName string    // "" = any
+	From      time.Time // inclusive; zero = unbounded
+	To        time.Time // exclusive; zero = unbounded
+	After     *EventCursor
+	Limit     int
+}
+
+const eventColumns = `
+  id, dedup_key, event_name, channel, COALESCE(campaign_id, ''), user_id,
+  ts, tags, metadata, created_at`
+
+func (r *EventRepo) GetByDedupKey(ctx context.Context, dedupKey string) (_ domain.StoredEvent, err error) {
+	ctx, span := startDBSpan(ctx, "db.get_event", "SELECT")
+	defer func() { endDBSpan(span, err) }()
+
+	// The key is a hash, so ts comes from event_keys; being known when the
+	// scan starts, it lets PostgreSQL skip every other partition.
+	q := `
+SELECT` + eventColumns + `
+FROM events
+WHERE dedup_key = $1
+  AND ts = (SELECT ts FROM event_keys WHERE dedup_key = $1);
+`
+	e, err := scanStoredEvent(r.pool.QueryRow(ctx, q, dedupKey))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.StoredEvent{}, ErrNotFound
+	}
+	return e, err
+}
+
+// ListByUser returns a user's events newest first. Only the filters that are
+// set become predicates, so every page is an index range scan on
+// events_user_ts_id_idx rather than a scan from the newest row.
+func (r *EventRepo) ListByUser(ctx context.Context, f UserEventFilter) (_ []domain.StoredEvent, err error) {
+	ctx, span := startDBSpan(ctx, "db.list_user_events", "SELECT")
+	defer func() { endDBSpan(span, err) }()
+
+	q, args := buildListByUserSQL(f)
+	rows, err := r.pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]domain.StoredEvent, 0, f.Limit)
+	for rows.Next() {
+		e, err := scanStoredEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	span.SetAttr("db.rows", len(out))
+	return out, rows.Err()
+}
+
+// buildListByUserSQL pages newest first on (ts, id): the cursor is the last
+// row of the previous page, so ties on ts are neither skipped nor repeated.
+func buildListByUserSQL(f UserEventFilter) (string, []any) {
+	args := []any{f.UserID}
+	where := []string{"user_id = $1"}
+	add := func(cond string, vals ...any) {
+		for _, v := range vals {
+			args = append(args, v)
+			cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		where = append(where, cond)
+	}
+
+	if f.EventName != "" {
+		add("event_name = ?", f.EventName)
+	}
+	if !f.From.IsZero() {
+		add("ts >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("ts < ?", f.To)
+	}
+	if f.After != nil {
+		add("(ts, id) < (?, ?)", f.After.TS, f.After.ID)
+	}
+	args = append(args, f.Limit)
+
+	q := `
+SELECT` + eventColumns + `
+FROM events
+WHERE ` + strings.Join(where, "\n  AND ") + `
+ORDER BY ts DESC, id DESC
+LIMIT $` + fmt.Sprint(len(args)) + `;
+`
+	return q, args
+}
+
+func scanStoredEvent(row pgx.Row) (domain.StoredEvent, error) {
+	var (
+		e        domain.StoredEvent
+		metadata []byte
+	)
+	err := row.Scan(
+		&e.ID,
+		&e.DedupKey,
+		&e.EventName,
+		&e.Channel,
+		&e.CampaignID,
+		&e.UserID,
+		&e.Timestamp,
+		&e.Tags,
+		&metadata,
+		&e.CreatedAt,
+	)
+	if err != nil {
+		return domain.StoredEvent{}, err
+	}
+	e.Timestamp = e.Timestamp.UTC()
+	e.CreatedAt = e.CreatedAt.UTC()
+	if len(metadata) > 0 && string(metadata) != "{}" {
+		e.Metadata = metadata
+	}
+	return e, nil
+}
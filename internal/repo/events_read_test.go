@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildListByUserSQL(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	cursor := &EventCursor{TS: from.Add(time.Hour), ID: 42}
+
+	tests := []struct {
+		name      string
+		f         UserEventFilter
+		wantWhere []string
+		wantArgs  []any
+	}{
+		{
+			name:      "user only",
+			f:         UserEventFilter{UserID: "u1", Limit: 100},
+			wantWhere: []string{"user_id = $1"},
+			wantArgs:  []any{"u1", 100},
+		},
+		{
+			name:      "first page",
+			f:         UserEventFilter{UserID: "u1", EventName: "purchase", From: from, To: to, Limit: 10},
+			wantWhere: []string{"user_id = $1", "event_name = $2", "ts >= $3", "ts < $4"},
+			wantArgs:  []any{"u1", "purchase", from, to, 10},
+		},
+		{
+			name:      "next page",
+			f:         UserEventFilter{UserID: "u1", After: cursor, Limit: 10},
+			wantWhere: []string{"user_id = $1", "(ts, id) < ($2, $3)"},
+			wantArgs:  []any{"u1", cursor.TS, cursor.ID, 10},
+		},
+		{
+			name:      "next page with every filter",
+			f:         UserEventFilter{UserID: "u1", EventName: "purchase", From: from, To: to, After: cursor, Limit: 10},
+			wantWhere: []string{"user_id = $1", "event_name = $2", "ts >= $3", "ts < $4", "(ts, id) < ($5, $6)"},
+			wantArgs:  []any{"u1", "purchase", from, to, cursor.TS, cursor.ID, 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, args := buildListByUserSQL(tt.f)
+
+			assertPlaceholdersUsed(t, q, len(args))
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("args = %v, want %v", args, tt.wantArgs)
+			}
+
+			where := q[strings.Index(q, "WHERE ")+len("WHERE ") : strings.Index(q, "ORDER BY")]
+			var got []string
+			for _, cond := range strings.Split(where, "AND ") {
+				got = append(got, strings.TrimSpace(cond))
+			}
+			if !reflect.DeepEqual(got, tt.wantWhere) {
+				t.Fatalf("predicates %q, want %q", got, tt.wantWhere)
+			}
+
+			// The order must match the keyset predicate, newest first.
+			if !strings.Contains(q, "ORDER BY ts DESC, id DESC") {
+				t.Fatalf("query not ordered by (ts, id) DESC:\n%s", q)
+			}
+			if want := "LIMIT $" + strconv.Itoa(len(args)) + ";"; !strings.Contains(q, want) {
+				t.Fatalf("query missing %q:\n%s", want, q)
+			}
+		})
+	}
+}
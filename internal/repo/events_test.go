@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func insertTestEvents() []domain.Event {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []domain.Event{
+		{
+			DedupKey:   "k1",
+			EventName:  "purchase",
+			Channel:    "web",
+			CampaignID: "c1",
+			UserID:     "u1",
+			Timestamp:  ts,
+			Tags:       []string{"a", "b"},
+			Metadata:   json.RawMessage(`{"amount":10}`),
+		},
+		{
+			// No campaign and no metadata: stored as NULL and {}.
+			DedupKey:  "k2",
+			EventName: "page_view",
+			Channel:   "mobile",
+			UserID:    "u2",
+			Timestamp: ts.Add(time.Second),
+			Tags:      []string{},
+		},
+	}
+}
+
+// insertRow is the row both insert paths send for e, in stagingColumns order.
+func insertRow(e domain.Event) []any {
+	return []any{e.DedupKey, e.EventName, e.Channel, e.CampaignID, e.UserID, e.Timestamp, e.Tags, toJSONBText(e.Metadata)}
+}
+
+func TestBuildInsertBatchSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []domain.Event
+	}{
+		{"one event", insertTestEvents()[:1]},
+		{"two events", insertTestEvents()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, args := buildInsertBatchSQL(tt.events)
+
+			assertPlaceholdersUsed(t, q, len(tt.events)*len(stagingColumns))
+			if got := strings.Count(q, "NULLIF("); got != len(tt.events) {
+				t.Errorf("%d NULLIF(campaign_id) in\n%s\nwant %d", got, q, len(tt.events))
+			}
+			for _, want := range []string{"ON CONFLICT (dedup_key, ts) DO NOTHING", "RETURNING dedup_key"} {
+				if !strings.Contains(q, want) {
+					t.Errorf("query missing %q:\n%s", want, q)
+				}
+			}
+
+			var want []any
+			for _, e := range tt.events {
+				want = append(want, insertRow(e)...)
+			}
+			if !reflect.DeepEqual(args, want) {
+				t.Fatalf("args = %v, want %v", args, want)
+			}
+		})
+	}
+}
+
+// copyTx records what copyInsertBatch sends; every other pgx.Tx method is
+// unused and panics through the nil embedded interface.
+type copyTx struct {
+	pgx.Tx
+
+	execs   []string
+	table   pgx.Identifier
+	columns []string
+	rows    [][]any
+	queries []string
+}
+
+func (tx *copyTx) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	tx.execs = append(tx.execs, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *copyTx) CopyFrom(_ context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	tx.table, tx.columns = table, columns
+	for src.Next() {
+		row, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+		tx.rows = append(tx.rows, row)
+	}
+	return int64(len(tx.rows)), src.Err()
+}
+
+func (tx *copyTx) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	tx.queries = append(tx.queries, sql)
+	return nil, nil
+}
+
+func TestCopyInsertBatch(t *testing.T) {
+	events := insertTestEvents()
+	tx := &copyTx{}
+	if _, err := copyInsertBatch(context.Background(), tx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tx.execs) != 1 || !strings.Contains(tx.execs[0], "CREATE TEMP TABLE IF NOT EXISTS events_staging") ||
+		!strings.Contains(tx.execs[0], "ON COMMIT DELETE ROWS") {
+		t.Fatalf("staging table statements: %q", tx.execs)
+	}
+	if !reflect.DeepEqual(tx.table, pgx.Identifier{"events_staging"}) || !reflect.DeepEqual(tx.columns, stagingColumns) {
+		t.Fatalf("COPY into %v %v", tx.table, tx.columns)
+	}
+
+	// Same values as the VALUES path, row for row.
+	_, args := buildInsertBatchSQL(events)
+	for i, row := range tx.rows {
+		want := args[i*len(stagingColumns) : (i+1)*len(stagingColumns)]
+		if !reflect.DeepEqual(row, want) {
+			t.Errorf("row %d = %v, want %v", i, row, want)
+		}
+	}
+	if len(tx.rows) != len(events) {
+		t.Fatalf("copied %d rows, want %d", len(tx.rows), len(events))
+	}
+
+	if len(tx.queries) != 1 {
+		t.Fatalf("%d queries after COPY, want 1", len(tx.queries))
+	}
+	q := tx.queries[0]
+	for _, want := range []string{
+		"FROM events_staging",
+		"NULLIF(campaign_id, '')",
+		"metadata::jsonb",
+		"ON CONFLICT (dedup_key, ts) DO NOTHING",
+		"RETURNING dedup_key",
+	} {
+		if !strings.Contains(q, want) {
+			t.Errorf("move query missing %q:\n%s", want, q)
+		}
+	}
+	assertPlaceholdersUsed(t, q, 0)
+}
+
+func TestEventRepoInsertMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     InsertMode
+		wantMode InsertMode
+		wantRows int
+	}{
+		{"default", "", InsertValues, 4000},
+		{"values", InsertValues, InsertValues, 4000},
+		{"copy", InsertCopy, InsertCopy, 50_000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewEventRepo(nil, tt.mode)
+			if r.mode != tt.wantMode {
+				t.Fatalf("mode = %q, want %q", r.mode, tt.wantMode)
+			}
+			got := r.MaxBatchRows()
+			if got != tt.wantRows {
+				t.Fatalf("MaxBatchRows = %d, want %d", got, tt.wantRows)
+			}
+			// The VALUES path must stay under the 65535 parameter limit.
+			if tt.wantMode == InsertValues && got*len(stagingColumns) > 65535 {
+				t.Fatalf("%d rows need %d parameters", got, got*len(stagingColumns))
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const MaxFunnelSteps = 10
+
+// FunnelQuery describes an ordered funnel. A user enters at a Steps[0] event
+// in [From, To) and reaches step i when events for Steps[1..i] follow in
+// order, the last one at most Window after the entry (so it may fall after
+// To). Channel and CampaignIDs restrict every step's events.
+type FunnelQuery struct {
+	Steps    []string
+	Window   time.Duration
+	From, To time.Time
+
+	Channel     string
+	CampaignIDs []string
+
+	// ByChannel computes one funnel per channel, each using only that
+	// channel's events.
+	ByChannel bool
+}
+
+// FunnelRow holds the number of users reaching each step; Channel is set
+// when the query is ByChannel.
+type FunnelRow struct {
+	Channel string
+	Users   []int64
+}
+
+// Funnel counts users per step with one window pass per step over each
+// user's events in (ts, id) order. For step i, r<i> on a Steps[i] event is
+// the latest entry time from which steps 0..i can be completed ending at that
+// event: the running MAX of r<i-1> over the user's earlier events, kept only
+// if it is still within Window. Taking the latest entry leaves the most room
+// for the remaining steps, so a user reaches step i iff some event has a
+// non-NULL r<i>.
+func (r *MetricsRepo) Funnel(ctx context.Context, fq FunnelQuery) ([]FunnelRow, error) {
+	q, args, err := buildFunnelSQL(fq)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FunnelRow
+	for rows.Next() {
+		row := FunnelRow{Users: make([]int64, len(fq.Steps))}
+		dest := make([]any, 0, len(fq.Steps)+1)
+		if fq.ByChannel {
+			dest = append(dest, &row.Channel)
+		}
+		for i := range row.Users {
+			dest = append(dest, &row.Users[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+func buildFunnelSQL(fq FunnelQuery) (string, []any, error) {
+	if len(fq.Steps) < 2 || len(fq.Steps) > MaxFunnelSteps {
+		return "", nil, fmt.Errorf("a funnel needs 2 to %d steps", MaxFunnelSteps)
+	}
+	if fq.Window <= 0 {
+		return "", nil, errors.New("funnel window must be positive")
+	}
+
+	var args sqlArgs
+	window := args.add(fq.Window)
+	to := args.add(fq.To)
+
+	conds := []string{
+		"e.event_name = ANY(" + args.add(fq.Steps) + "::text[])",
+		"e.ts >= " + args.add(fq.From),
+		"e.ts < " + to + "::timestamptz + " + window + "::interval",
+	}
+	if fq.Channel != "" {
+		conds = append(conds, "e.channel = "+args.add(fq.Channel))
+	}
+	if len(fq.CampaignIDs) > 0 {
+		conds = append(conds, "e.campaign_id = ANY("+args.add(fq.CampaignIDs)+"::text[])")
+	}
+
+	partition := "user_id"
+	if fq.ByChannel {
+		partition = "user_id, channel"
+	}
+
+	var b strings.Builder
+	b.WriteString(`
+WITH s0 AS (
+  SELECT e.user_id, e.channel, e.ts, e.id, e.event_name,
+    CASE WHEN e.event_name = ` + args.add(fq.Steps[0]) + ` AND e.ts < ` + to + ` THEN e.ts END AS r0
+  FROM events e
+  WHERE ` + strings.Join(conds, "\n    AND ") + `
+)`)
+
+	cols := []string{"r0"}
+	for i := 1; i < len(fq.Steps); i++ {
+		prev := fmt.Sprintf("MAX(r%d) OVER (PARTITION BY %s ORDER BY ts, id ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING)", i-1, partition)
+		fmt.Fprintf(&b, `,
+s%[1]d AS (
+  SELECT s%[2]d.*,
+    CASE WHEN event_name = %[3]s AND ts - %[4]s <= %[5]s::interval THEN %[4]s END AS r%[1]d
+  FROM s%[2]d
+)`, i, i-1, args.add(fq.Steps[i]), prev, window)
+		cols = append(cols, fmt.Sprintf("r%d", i))
+	}
+
+	counts := make([]string, len(cols))
+	for i, c := range cols {
+		counts[i] = fmt.Sprintf("COUNT(DISTINCT user_id) FILTER (WHERE %s IS NOT NULL)::bigint AS step%d", c, i)
+	}
+
+	last := fmt.Sprintf("s%d", len(fq.Steps)-1)
+	if fq.ByChannel {
+		b.WriteString(`
+SELECT channel,
+  ` + strings.Join(counts, ",\n  ") + `
+FROM ` + last + `
+GROUP BY channel
+ORDER BY step0 DESC, channel;
+`)
+	} else {
+		b.WriteString(`
+SELECT
+  ` + strings.Join(counts, ",\n  ") + `
+FROM ` + last + `;
+`)
+	}
+	return b.String(), args, nil
+}
@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildFunnelSQLValidation(t *testing.T) {
+	steps := func(n int) []string {
+		s := make([]string, n)
+		for i := range s {
+			s[i] = fmt.Sprintf("step%d", i)
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		fq      FunnelQuery
+		wantErr bool
+	}{
+		{"one step", FunnelQuery{Steps: steps(1), Window: time.Hour}, true},
+		{"two steps", FunnelQuery{Steps: steps(2), Window: time.Hour}, false},
+		{"max steps", FunnelQuery{Steps: steps(MaxFunnelSteps), Window: time.Hour}, false},
+		{"too many steps", FunnelQuery{Steps: steps(MaxFunnelSteps + 1), Window: time.Hour}, true},
+		{"no window", FunnelQuery{Steps: steps(2)}, true},
+		{"negative window", FunnelQuery{Steps: steps(2), Window: -time.Hour}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := buildFunnelSQL(tt.fq)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildFunnelSQL(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	base := FunnelQuery{
+		Steps:  []string{"view", "cart", "purchase"},
+		Window: 30 * time.Minute,
+		From:   from,
+		To:     to,
+	}
+
+	tests := []struct {
+		name string
+		fq   func(FunnelQuery) FunnelQuery
+		// wantArgs after the fixed window, to, steps, from.
+		wantArgs  []any
+		wantConds []string
+		partition string
+	}{
+		{
+			name:      "plain",
+			fq:        func(fq FunnelQuery) FunnelQuery { return fq },
+			wantArgs:  []any{"view", "cart", "purchase"},
+			partition: "PARTITION BY user_id ORDER BY",
+		},
+		{
+			name: "filtered",
+			fq: func(fq FunnelQuery) FunnelQuery {
+				fq.Channel = "web"
+				fq.CampaignIDs = []string{"c1", "c2"}
+				return fq
+			},
+			wantArgs:  []any{"web", []string{"c1", "c2"}, "view", "cart", "purchase"},
+			wantConds: []string{"e.channel = $5", "e.campaign_id = ANY($6::text[])"},
+			partition: "PARTITION BY user_id ORDER BY",
+		},
+		{
+			name: "by channel",
+			fq: func(fq FunnelQuery) FunnelQuery {
+				fq.ByChannel = true
+				return fq
+			},
+			wantArgs:  []any{"view", "cart", "purchase"},
+			partition: "PARTITION BY user_id, channel ORDER BY",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fq := tt.fq(base)
+			q, args, err := buildFunnelSQL(fq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPlaceholdersUsed(t, q, len(args))
+
+			want := append([]any{fq.Window, to, fq.Steps, from}, tt.wantArgs...)
+			if !reflect.DeepEqual(args, want) {
+				t.Fatalf("args = %v, want %v", args, want)
+			}
+
+			// Events are read up to one window past To, so a funnel entered
+			// before To can finish after it; only entries must be before To.
+			for _, c := range append([]string{
+				"e.event_name = ANY($3::text[])",
+				"e.ts >= $4",
+				"e.ts < $2::timestamptz + $1::interval",
+			}, tt.wantConds...) {
+				if !strings.Contains(q, c) {
+					t.Errorf("query missing condition %q", c)
+				}
+			}
+			entry := fmt.Sprintf("CASE WHEN e.event_name = $%d AND e.ts < $2 THEN e.ts END AS r0", len(args)-2)
+			if !strings.Contains(q, entry) {
+				t.Errorf("query missing entry %q:\n%s", entry, q)
+			}
+
+			// Step i only looks at strictly earlier events of the same user
+			// (and channel), in (ts, id) order, within the window of the
+			// latest entry.
+			for i := 1; i < len(fq.Steps); i++ {
+				step := fmt.Sprintf(
+					"CASE WHEN event_name = $%d AND ts - MAX(r%d) OVER (%s ts, id ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) <= $1::interval THEN",
+					len(args)-2+i, i-1, tt.partition)
+				if !strings.Contains(q, step) {
+					t.Errorf("step %d: query missing %q:\n%s", i, step, q)
+				}
+				if !strings.Contains(q, fmt.Sprintf("FROM s%d\n)", i-1)) {
+					t.Errorf("step %d does not build on step %d", i, i-1)
+				}
+			}
+
+			for i := range fq.Steps {
+				count := fmt.Sprintf("COUNT(DISTINCT user_id) FILTER (WHERE r%d IS NOT NULL)::bigint AS step%d", i, i)
+				if !strings.Contains(q, count) {
+					t.Errorf("query missing %q", count)
+				}
+			}
+			if strings.Contains(q, "GROUP BY channel") != fq.ByChannel {
+				t.Errorf("GROUP BY channel present = %v, want %v", !fq.ByChannel, fq.ByChannel)
+			}
+			if !strings.Contains(q, fmt.Sprintf("FROM s%d", len(fq.Steps)-1)) {
+				t.Errorf("counts not taken from the last step")
+			}
+		})
+	}
+}
@@ -15,62 +15,150 @@ func NewMetricsRepo(pool *pgxpool.Pool) *MetricsRepo {
 	return &MetricsRepo{pool: pool}
 }
 
+// Aggs holds one value per Aggregate.Funcs entry; nil when no event had a
+// numeric value.
 type MetricsTotals struct {
 	Total  int64
 	Unique int64
+	Aggs   []*float64
 }
 
-type MetricsByChannelRow struct {
-	Channel string
-	Total   int64
-	Unique  int64
-}
-
-// channel optional: pass "" to not filter.
-func (r *MetricsRepo) Totals(ctx context.Context, eventName string, from, to time.Time, channel string) (MetricsTotals, error) {
-	const q = `
+func (r *MetricsRepo) Totals(ctx context.Context, f MetricsFilter, agg Aggregate, acc Accuracy) (MetricsTotals, error) {
+	var args sqlArgs
+	base, err := metricsBase(f, nil, agg, acc, true, args.add)
+	if err != nil {
+		return MetricsTotals{}, err
+	}
+	q := `
 SELECT
-  COUNT(*)::bigint AS total,
-  COUNT(DISTINCT user_id)::bigint AS unique
-FROM events
-WHERE event_name = $1
-  AND ts >= $2
-  AND ts <  $3
-  AND ($4 = '' OR channel = $4);
+  COALESCE(SUM(b.n), 0)::bigint AS total,` + acc.uniqueColumns() + agg.columns("b.v") + `
+FROM (` + base + `
+) b;
 `
-	var out MetricsTotals
-	err := r.pool.QueryRow(ctx, q, eventName, from, to, channel).Scan(&out.Total, &out.Unique)
-	return out, err
+	out := MetricsTotals{Aggs: make([]*float64, len(agg.Funcs))}
+	u := newUniqueScan(acc, &out.Unique)
+	dest := append(append([]any{&out.Total}, u.dest()...), aggDest(out.Aggs)...)
+	if err := r.pool.QueryRow(ctx, q, args...).Scan(dest...); err != nil {
+		return out, err
+	}
+	return out, u.done()
 }
 
-// channel optional: pass "" to not filter.
-func (r *MetricsRepo) ByChannel(ctx context.Context, eventName string, from, to time.Time, channel string) ([]MetricsByChannelRow, error) {
-	const q = `
-SELECT
-  channel,
-  COUNT(*)::bigint AS total,
-  COUNT(DISTINCT user_id)::bigint AS unique
-FROM events
-WHERE event_name = $1
-  AND ts >= $2
-  AND ts <  $3
-  AND ($4 = '' OR channel = $4)
-GROUP BY channel
-ORDER BY channel;
-`
-	rows, err := r.pool.Query(ctx, q, eventName, from, to, channel)
+type MetricsBucket struct {
+	Start  time.Time
+	Total  int64
+	Unique int64
+	Aggs   []*float64
+}
+
+// Series counts events per bucket of width interval over [f.From, f.To). Day
+// buckets (interval = 24h) start at local midnight in loc, so they follow DST;
+// shorter buckets are aligned to UTC. Unique is distinct users within each
+// bucket. Empty buckets are included with zero counts; the first bucket is
+// the one containing f.From, so it may start before it.
+func (r *MetricsRepo) Series(ctx context.Context, f MetricsFilter, agg Aggregate, acc Accuracy, interval time.Duration, loc *time.Location) ([]MetricsBucket, error) {
+	q, args, err := buildSeriesSQL(f, agg, acc, interval, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var out []MetricsByChannelRow
+	counts := make(map[int64]MetricsBucket)
 	for rows.Next() {
-		var rrow MetricsByChannelRow
-		if err := rows.Scan(&rrow.Channel, &rrow.Total, &rrow.Unique); err != nil {
+		b := MetricsBucket{Aggs: make([]*float64, len(agg.Funcs))}
+		u := newUniqueScan(acc, &b.Unique)
+		dest := append(append([]any{&b.Start, &b.Total}, u.dest()...), aggDest(b.Aggs)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if err := u.done(); err != nil {
 			return nil, err
 		}
-		out = append(out, rrow)
+		counts[b.Start.Unix()] = b
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	starts := bucketStarts(f.From, f.To, interval, loc)
+	out := make([]MetricsBucket, len(starts))
+	for i, s := range starts {
+		if b, ok := counts[s.Unix()]; ok {
+			b.Start = s
+			out[i] = b
+		} else {
+			out[i] = MetricsBucket{Start: s, Aggs: make([]*float64, len(agg.Funcs))}
+		}
+	}
+	return out, nil
+}
+
+func buildSeriesSQL(f MetricsFilter, agg Aggregate, acc Accuracy, interval time.Duration, loc *time.Location) (string, []any, error) {
+	// Bind only what the bucket expression uses: PostgreSQL cannot type an
+	// unreferenced parameter (42P18).
+	var args sqlArgs
+	var bucketExpr string
+	if interval == 24*time.Hour {
+		bucketExpr = `date_trunc('day', b.ts, ` + args.add(loc.String()) + `)`
+	} else {
+		bucketExpr = `date_bin(` + args.add(interval) + `::interval, b.ts, TIMESTAMPTZ '2000-01-01 00:00:00+00')`
+	}
+	base, err := metricsBase(f, nil, agg, acc, hourAligned(f.From, f.To, interval, loc), args.add)
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := `
+SELECT
+  ` + bucketExpr + ` AS bucket,
+  SUM(b.n)::bigint AS total,` + acc.uniqueColumns() + agg.columns("b.v") + `
+FROM (` + base + `
+) b
+GROUP BY bucket
+ORDER BY bucket;
+`
+	return q, args, nil
+}
+
+// bucketStarts lists the starts of the buckets Series returns, computed the
+// same way as the SQL (so empty buckets can be filled in).
+func bucketStarts(from, to time.Time, interval time.Duration, loc *time.Location) []time.Time {
+	var out []time.Time
+	if interval == 24*time.Hour {
+		l := from.In(loc)
+		for d := time.Date(l.Year(), l.Month(), l.Day(), 0, 0, 0, 0, loc); d.Before(to); d = d.AddDate(0, 0, 1) {
+			out = append(out, d)
+		}
+		return out
+	}
+	for t := from.UTC().Truncate(interval); t.Before(to); t = t.Add(interval) {
+		out = append(out, t)
+	}
+	return out
+}
+
+// hourAligned reports whether no bucket boundary of a Series over [from, to)
+// falls inside a UTC hour, so rows stamped with the start of their hour land
+// in the right bucket. date_bin buckets start at multiples of interval from
+// a UTC midnight; day buckets follow loc, whose offset may not be whole
+// hours.
+func hourAligned(from, to time.Time, interval time.Duration, loc *time.Location) bool {
+	if interval%time.Hour != 0 {
+		return false
+	}
+	if interval != 24*time.Hour {
+		return true
+	}
+	starts := bucketStarts(from, to, interval, loc)
+	for _, s := range starts[min(1, len(starts)):] {
+		if !s.Truncate(time.Hour).Equal(s) {
+			return false
+		}
 	}
-	return out, rows.Err()
+	return true
 }
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type AggFunc string
+
+const (
+	AggSum AggFunc = "sum"
+	AggAvg AggFunc = "avg"
+	AggMin AggFunc = "min"
+	AggMax AggFunc = "max"
+	AggP50 AggFunc = "p50"
+	AggP95 AggFunc = "p95"
+	AggP99 AggFunc = "p99"
+)
+
+var aggSQL = map[AggFunc]string{
+	AggSum: "SUM(%s)::float8",
+	AggAvg: "AVG(%s)::float8",
+	AggMin: "MIN(%s)::float8",
+	AggMax: "MAX(%s)::float8",
+	AggP50: "percentile_cont(0.5) WITHIN GROUP (ORDER BY (%s)::float8)",
+	AggP95: "percentile_cont(0.95) WITHIN GROUP (ORDER BY (%s)::float8)",
+	AggP99: "percentile_cont(0.99) WITHIN GROUP (ORDER BY (%s)::float8)",
+}
+
+// Aggregate computes Funcs over the numeric value at a metadata path, next
+// to the counts. Events whose value is missing or not a JSON number are
+// skipped (they still count in Total). The zero value aggregates nothing.
+type Aggregate struct {
+	Path  []string
+	Funcs []AggFunc
+}
+
+// ParseAggregate validates field (metadata.<path>) and the aggregate names.
+func ParseAggregate(field string, funcs []string) (Aggregate, error) {
+	key, ok := strings.CutPrefix(field, "metadata.")
+	if !ok {
+		return Aggregate{}, fmt.Errorf("field %q must be metadata.<key>", field)
+	}
+	path, err := parseMetadataPath(key)
+	if err != nil {
+		return Aggregate{}, err
+	}
+	if len(funcs) == 0 {
+		return Aggregate{}, errors.New("agg is required with field")
+	}
+
+	a := Aggregate{Path: path}
+	seen := make(map[AggFunc]bool, len(funcs))
+	for _, s := range funcs {
+		fn := AggFunc(s)
+		if _, ok := aggSQL[fn]; !ok {
+			return Aggregate{}, fmt.Errorf("unknown agg %q (allowed: sum, avg, min, max, p50, p95, p99)", s)
+		}
+		if !seen[fn] {
+			seen[fn] = true
+			a.Funcs = append(a.Funcs, fn)
+		}
+	}
+	return a, nil
+}
+
+func (a Aggregate) Field() string {
+	return "metadata." + strings.Join(a.Path, ".")
+}
+
+// value returns the numeric value expression on events aliased e; NULL when
+// the value is not a number, so aggregates skip it.
+func (a Aggregate) value(param func(any) string) string {
+	p := param(a.Path)
+	return fmt.Sprintf("CASE WHEN jsonb_typeof(e.metadata #> %[1]s::text[]) = 'number' THEN (e.metadata #> %[1]s::text[])::numeric END", p)
+}
+
+// columns returns ", <agg>(v) AS agg_<i>" for each function, or "".
+func (a Aggregate) columns(v string) string {
+	var b strings.Builder
+	for i, fn := range a.Funcs {
+		fmt.Fprintf(&b, ",\n  "+aggSQL[fn]+" AS agg_%d", v, i)
+	}
+	return b.String()
+}
+
+// aggDest returns scan targets for the aggregate columns into vals.
+func aggDest(vals []*float64) []any {
+	out := make([]any, len(vals))
+	for i := range vals {
+		out[i] = &vals[i]
+	}
+	return out
+}
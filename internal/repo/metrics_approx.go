@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/cun0/insider-case/internal/hll"
+)
+
+// Accuracy selects how unique users are counted.
+type Accuracy string
+
+const (
+	// AccuracyExact is COUNT(DISTINCT user_id) over events and the rollup
+	// user sets.
+	AccuracyExact Accuracy = "exact"
+	// AccuracyApprox merges the rollups' HyperLogLog sketches in Go (plus the
+	// user_ids of the ragged edges, read from events). It needs a rollupable
+	// query; see Rollupable.
+	AccuracyApprox Accuracy = "approx"
+)
+
+func ParseAccuracy(s string) (Accuracy, error) {
+	switch a := Accuracy(s); a {
+	case AccuracyExact, AccuracyApprox:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown accuracy %q (allowed: exact, approx)", s)
+}
+
+// uniqueColumns returns the unique users column(s) over the base rows b.
+func (a Accuracy) uniqueColumns() string {
+	if a == AccuracyApprox {
+		return `
+  array_agg(b.sketch) FILTER (WHERE b.sketch IS NOT NULL) AS sketches,
+  array_agg(DISTINCT b.user_id) FILTER (WHERE b.user_id IS NOT NULL) AS users`
+	}
+	return `
+  COUNT(DISTINCT b.user_id)::bigint AS unique`
+}
+
+// uniqueScan reads uniqueColumns into dst; call done after Scan.
+type uniqueScan struct {
+	acc      Accuracy
+	dst      *int64
+	sketches [][]byte
+	users    []string
+}
+
+func newUniqueScan(acc Accuracy, dst *int64) *uniqueScan {
+	return &uniqueScan{acc: acc, dst: dst}
+}
+
+func (u *uniqueScan) dest() []any {
+	if u.acc == AccuracyApprox {
+		return []any{&u.sketches, &u.users}
+	}
+	return []any{u.dst}
+}
+
+func (u *uniqueScan) done() error {
+	if u.acc != AccuracyApprox {
+		return nil
+	}
+	sk := hll.New()
+	for _, b := range u.sketches {
+		if err := sk.MergeBytes(b); err != nil {
+			return err
+		}
+	}
+	for _, id := range u.users {
+		sk.Add(id)
+	}
+	*u.dst = sk.Estimate()
+	return nil
+}
@@ -0,0 +1,193 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type DimensionKind string
+
+const (
+	DimChannel    DimensionKind = "channel"
+	DimCampaignID DimensionKind = "campaign_id"
+	// DimTag unnests tags: an event counts once per tag (untagged events
+	// group under a NULL tag).
+	DimTag DimensionKind = "tag"
+	// DimMetadata groups by the text value at a JSONB path in metadata.
+	DimMetadata DimensionKind = "metadata"
+)
+
+const (
+	MaxDimensions = 2
+
+	maxMetadataPathDepth = 5
+	maxMetadataKeyLen    = 128
+)
+
+// Dimension is one group_by term: a fixed column, or a metadata path.
+type Dimension struct {
+	Kind DimensionKind
+	Path []string // DimMetadata only
+}
+
+func (d Dimension) String() string {
+	if d.Kind == DimMetadata {
+		return "metadata." + strings.Join(d.Path, ".")
+	}
+	return string(d.Kind)
+}
+
+// ParseDimension accepts channel, campaign_id, tag and metadata.<key>[.<key>...].
+func ParseDimension(s string) (Dimension, error) {
+	switch s {
+	case string(DimChannel), string(DimCampaignID), string(DimTag):
+		return Dimension{Kind: DimensionKind(s)}, nil
+	}
+
+	key, ok := strings.CutPrefix(s, "metadata.")
+	if !ok {
+		return Dimension{}, fmt.Errorf("unknown dimension %q (allowed: channel, campaign_id, tag, metadata.<key>)", s)
+	}
+	path, err := parseMetadataPath(key)
+	if err != nil {
+		return Dimension{}, err
+	}
+	return Dimension{Kind: DimMetadata, Path: path}, nil
+}
+
+// parseMetadataPath splits a dotted metadata key (a.b) into a JSONB path.
+func parseMetadataPath(key string) ([]string, error) {
+	path := strings.Split(key, ".")
+	if len(path) > maxMetadataPathDepth {
+		return nil, fmt.Errorf("metadata path %q is deeper than %d", key, maxMetadataPathDepth)
+	}
+	for _, p := range path {
+		if p == "" || len(p) > maxMetadataKeyLen {
+			return nil, fmt.Errorf("invalid metadata path %q", key)
+		}
+	}
+	return path, nil
+}
+
+// BreakdownRow is one group. Values and Other are indexed like the
+// dimensions: a nil value is a missing one (no campaign, no tag, no such
+// metadata key), Other marks the bucket folding values outside the top N.
+type BreakdownRow struct {
+	Values []*string
+	Other  []bool
+	Total  int64
+	Unique int64
+	Aggs   []*float64 // as in MetricsTotals
+}
+
+// Breakdown counts events grouped by up to MaxDimensions dimensions, ordered
+// by value. With topN > 0, each dimension keeps its topN values by event
+// count and folds the rest into an "other" bucket, and groups are ordered by
+// total instead (the other buckets last). Column expressions come from a fixed set;
+// metadata paths and all filters are bound as parameters.
+func (r *MetricsRepo) Breakdown(ctx context.Context, f MetricsFilter, agg Aggregate, acc Accuracy, dims []Dimension, topN int) ([]BreakdownRow, error) {
+	q, args, err := buildBreakdownSQL(f, agg, acc, dims, topN)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []BreakdownRow
+	for rows.Next() {
+		row := BreakdownRow{
+			Values: make([]*string, len(dims)),
+			Other:  make([]bool, len(dims)),
+			Aggs:   make([]*float64, len(agg.Funcs)),
+		}
+		u := newUniqueScan(acc, &row.Unique)
+		dest := make([]any, 0, 2*len(dims)+3+len(agg.Funcs))
+		for i := range dims {
+			dest = append(dest, &row.Values[i], &row.Other[i])
+		}
+		dest = append(dest, &row.Total)
+		dest = append(dest, u.dest()...)
+		dest = append(dest, aggDest(row.Aggs)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if err := u.done(); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+func buildBreakdownSQL(f MetricsFilter, agg Aggregate, acc Accuracy, dims []Dimension, topN int) (string, []any, error) {
+	if len(dims) == 0 || len(dims) > MaxDimensions {
+		return "", nil, errors.New("breakdown needs 1 or 2 dimensions")
+	}
+
+	var args sqlArgs
+	param := args.add
+
+	base, err := metricsBase(f, dims, agg, acc, true, param)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString(`
+WITH base AS (` + base + `
+)`)
+
+	// Output columns are d<i>, d<i>_other per dimension; GROUP BY is
+	// positional because the top_d<i> joins also expose a d<i> column.
+	var (
+		cols, groupBy, orderOther, orderVal []string
+		source                              = "base b"
+		limit                               string
+	)
+	if topN > 0 {
+		limit = param(topN)
+	}
+	for i := range dims {
+		d := fmt.Sprintf("d%d", i)
+		if topN > 0 {
+			fmt.Fprintf(&b, `,
+top_%[1]s AS (
+  SELECT %[1]s, true AS hit
+  FROM base
+  GROUP BY %[1]s
+  ORDER BY SUM(n) DESC, %[1]s NULLS LAST
+  LIMIT %[2]s
+)`, d, limit)
+			source += fmt.Sprintf("\n  LEFT JOIN top_%[1]s ON top_%[1]s.%[1]s IS NOT DISTINCT FROM b.%[1]s", d)
+			cols = append(cols,
+				fmt.Sprintf("CASE WHEN top_%[1]s.hit THEN b.%[1]s END AS %[1]s", d),
+				fmt.Sprintf("top_%[1]s.hit IS NULL AS %[1]s_other", d))
+		} else {
+			cols = append(cols, "b."+d+" AS "+d, "false AS "+d+"_other")
+		}
+		groupBy = append(groupBy, fmt.Sprint(2*i+1), fmt.Sprint(2*i+2))
+		orderOther = append(orderOther, d+"_other")
+		orderVal = append(orderVal, d+" NULLS LAST")
+	}
+
+	order := strings.Join(orderVal, ", ")
+	if topN > 0 {
+		order = strings.Join(orderOther, ", ") + ", total DESC, " + order
+	}
+
+	b.WriteString(`
+SELECT ` + strings.Join(cols, ", ") + `,
+  SUM(b.n)::bigint AS total,` + acc.uniqueColumns() + agg.columns("b.v") + `
+FROM ` + source + `
+GROUP BY ` + strings.Join(groupBy, ", ") + `
+ORDER BY ` + order + `;
+`)
+
+	return b.String(), args, nil
+}
@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsFilter selects the events a metrics query counts. Empty fields do
+// not filter. Every field becomes a bound parameter; see where.
+type MetricsFilter struct {
+	EventName string
+	From, To  time.Time // [From, To)
+	Channel   string
+
+	CampaignIDs []string // campaign_id is any of these
+	TagsAny     []string // tags contain at least one of these
+	TagsAll     []string // tags contain all of these
+	Metadata    []MetadataPredicate
+}
+
+type MetadataOp string
+
+const (
+	OpEq  MetadataOp = "="
+	OpNe  MetadataOp = "!="
+	OpGt  MetadataOp = ">"
+	OpGte MetadataOp = ">="
+	OpLt  MetadataOp = "<"
+	OpLte MetadataOp = "<="
+)
+
+// Longest first, so ">=" is not read as ">".
+var metadataOps = []MetadataOp{OpNe, OpGte, OpLte, OpEq, OpGt, OpLt}
+
+// MetadataPredicate compares the value at a metadata path with a literal.
+// Value is the literal as JSON: = and != match it by JSONB containment
+// (type-sensitive: 10 does not match "10"); ordering operators need a number
+// and only match numeric values.
+type MetadataPredicate struct {
+	Path  []string
+	Op    MetadataOp
+	Value json.RawMessage
+}
+
+func (p MetadataPredicate) String() string {
+	return "metadata." + strings.Join(p.Path, ".") + string(p.Op) + string(p.Value)
+}
+
+// ParseMetadataPredicate parses metadata.<path><op><value>, e.g.
+// metadata.amount>=10 or metadata.currency=TRY. Values are numbers, true,
+// false, null or strings; quote a string that looks like another type
+// ("10").
+func ParseMetadataPredicate(s string) (MetadataPredicate, error) {
+	rest, ok := strings.CutPrefix(s, "metadata.")
+	if !ok {
+		return MetadataPredicate{}, fmt.Errorf("filter %q must start with metadata.", s)
+	}
+	i := strings.IndexAny(rest, "=!<>")
+	if i < 0 {
+		return MetadataPredicate{}, fmt.Errorf("filter %q has no operator (=, !=, >, >=, <, <=)", s)
+	}
+
+	path, err := parseMetadataPath(rest[:i])
+	if err != nil {
+		return MetadataPredicate{}, err
+	}
+
+	var op MetadataOp
+	for _, o := range metadataOps {
+		if strings.HasPrefix(rest[i:], string(o)) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return MetadataPredicate{}, fmt.Errorf("filter %q has an invalid operator", s)
+	}
+
+	value, isNumber, err := parseFilterLiteral(rest[i+len(op):])
+	if err != nil {
+		return MetadataPredicate{}, fmt.Errorf("filter %q: %w", s, err)
+	}
+	if op != OpEq && op != OpNe && !isNumber {
+		return MetadataPredicate{}, fmt.Errorf("filter %q: %s needs a number", s, op)
+	}
+	return MetadataPredicate{Path: path, Op: op, Value: value}, nil
+}
+
+func parseFilterLiteral(v string) (lit json.RawMessage, isNumber bool, err error) {
+	switch {
+	case v == "":
+		return nil, false, errors.New("missing value")
+	case v == "true" || v == "false" || v == "null":
+		return json.RawMessage(v), false, nil
+	case v[0] == '"':
+		var s string
+		if err := json.Unmarshal([]byte(v), &s); err != nil {
+			return nil, false, errors.New("invalid quoted string")
+		}
+		return json.RawMessage(v), false, nil
+	case v[0] == '-' || (v[0] >= '0' && v[0] <= '9'):
+		if json.Valid([]byte(v)) {
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				return json.RawMessage(v), true, nil
+			}
+		}
+	}
+	b, _ := json.Marshal(v)
+	return b, false, nil
+}
+
+// where returns the WHERE conditions for f on the events table aliased e,
+// binding values through param.
+func (f MetricsFilter) where(param func(any) string) string {
+	conds := []string{
+		"e.event_name = " + param(f.EventName),
+		"e.ts >= " + param(f.From),
+		"e.ts <  " + param(f.To),
+	}
+	if f.Channel != "" {
+		conds = append(conds, "e.channel = "+param(f.Channel))
+	}
+	if len(f.CampaignIDs) > 0 {
+		conds = append(conds, "e.campaign_id = ANY("+param(f.CampaignIDs)+"::text[])")
+	}
+	// && and @> on text[] use events_tags_gin.
+	if len(f.TagsAny) > 0 {
+		conds = append(conds, "e.tags && "+param(f.TagsAny)+"::text[]")
+	}
+	if len(f.TagsAll) > 0 {
+		conds = append(conds, "e.tags @> "+param(f.TagsAll)+"::text[]")
+	}
+	for _, p := range f.Metadata {
+		conds = append(conds, p.sql(param))
+	}
+	return strings.Join(conds, "\n  AND ")
+}
+
+func (p MetadataPredicate) sql(param func(any) string) string {
+	switch p.Op {
+	case OpEq, OpNe:
+		// Containment of {"a":{"b":value}} uses events_metadata_gin.
+		var doc any = p.Value
+		for i := len(p.Path) - 1; i >= 0; i-- {
+			doc = map[string]any{p.Path[i]: doc}
+		}
+		b, _ := json.Marshal(doc)
+		cond := "e.metadata @> " + param(string(b)) + "::jsonb"
+		if p.Op == OpNe {
+			return "NOT (" + cond + ")"
+		}
+		return cond
+	default:
+		// CASE guards the cast: non-numeric values do not match instead of
+		// failing the query.
+		path := param(p.Path)
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(e.metadata #> %[1]s::text[]) = 'number' THEN (e.metadata #> %[1]s::text[])::numeric %[2]s %[3]s::numeric ELSE false END",
+			path, p.Op, param(string(p.Value)))
+	}
+}
+
+// sqlArgs collects bind parameters; add returns the placeholder for v.
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
@@ -0,0 +1,181 @@
+package repo
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMetadataPredicate(t *testing.T) {
+	tests := []struct {
+		in      string
+		path    []string
+		op      MetadataOp
+		value   string
+		wantErr bool
+	}{
+		{in: "metadata.amount>=10", path: []string{"amount"}, op: OpGte, value: "10"},
+		{in: "metadata.amount>10.5", path: []string{"amount"}, op: OpGt, value: "10.5"},
+		{in: "metadata.amount<=-3", path: []string{"amount"}, op: OpLte, value: "-3"},
+		{in: "metadata.amount<1e3", path: []string{"amount"}, op: OpLt, value: "1e3"},
+		{in: "metadata.currency=TRY", path: []string{"currency"}, op: OpEq, value: `"TRY"`},
+		{in: "metadata.currency!=TRY", path: []string{"currency"}, op: OpNe, value: `"TRY"`},
+		{in: `metadata.code="10"`, path: []string{"code"}, op: OpEq, value: `"10"`},
+		{in: "metadata.code=10", path: []string{"code"}, op: OpEq, value: "10"},
+		{in: "metadata.flag=true", path: []string{"flag"}, op: OpEq, value: "true"},
+		{in: "metadata.gone=null", path: []string{"gone"}, op: OpEq, value: "null"},
+		{in: "metadata.a.b.c=x", path: []string{"a", "b", "c"}, op: OpEq, value: `"x"`},
+		{in: "metadata.v=a=b", path: []string{"v"}, op: OpEq, value: `"a=b"`},
+		{in: "metadata.v=12abc", path: []string{"v"}, op: OpEq, value: `"12abc"`},
+
+		{in: "amount>=10", wantErr: true},
+		{in: "metadata.amount", wantErr: true},
+		{in: "metadata.=1", wantErr: true},
+		{in: "metadata.a..b=1", wantErr: true},
+		{in: "metadata.a.b.c.d.e.f=1", wantErr: true},
+		{in: "metadata.amount=", wantErr: true},
+		{in: "metadata.amount>TRY", wantErr: true},
+		{in: `metadata.amount>"10"`, wantErr: true},
+		{in: "metadata.amount<>1", wantErr: true},
+		{in: "metadata.amount!1", wantErr: true},
+		{in: `metadata.s="unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			p, err := ParseMetadataPredicate(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want error", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(p.Path, tt.path) || p.Op != tt.op || string(p.Value) != tt.value {
+				t.Fatalf("got path=%q op=%q value=%s, want path=%q op=%q value=%s",
+					p.Path, p.Op, p.Value, tt.path, tt.op, tt.value)
+			}
+		})
+	}
+}
+
+func TestMetricsFilterWhere(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	amount := mustPredicate(t, "metadata.amount>=10")
+	currency := mustPredicate(t, "metadata.a.currency!=TRY")
+
+	tests := []struct {
+		name  string
+		f     MetricsFilter
+		conds []string
+		args  []any
+	}{
+		{
+			name: "required only",
+			f:    MetricsFilter{EventName: "purchase", From: from, To: to},
+			conds: []string{
+				"e.event_name = $1",
+				"e.ts >= $2",
+				"e.ts <  $3",
+			},
+			args: []any{"purchase", from, to},
+		},
+		{
+			name: "all filters",
+			f: MetricsFilter{
+				EventName:   "purchase",
+				From:        from,
+				To:          to,
+				Channel:     "web",
+				CampaignIDs: []string{"c1", "c2"},
+				TagsAny:     []string{"a"},
+				TagsAll:     []string{"b", "c"},
+				Metadata:    []MetadataPredicate{amount, currency},
+			},
+			conds: []string{
+				"e.event_name = $1",
+				"e.ts >= $2",
+				"e.ts <  $3",
+				"e.channel = $4",
+				"e.campaign_id = ANY($5::text[])",
+				"e.tags && $6::text[]",
+				"e.tags @> $7::text[]",
+				"CASE WHEN jsonb_typeof(e.metadata #> $8::text[]) = 'number' THEN (e.metadata #> $8::text[])::numeric >= $9::numeric ELSE false END",
+				"NOT (e.metadata @> $10::jsonb)",
+			},
+			args: []any{
+				"purchase", from, to, "web",
+				[]string{"c1", "c2"}, []string{"a"}, []string{"b", "c"},
+				[]string{"amount"}, "10",
+				`{"a":{"currency":"TRY"}}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args sqlArgs
+			got := tt.f.where(args.add)
+			if want := strings.Join(tt.conds, "\n  AND "); got != want {
+				t.Fatalf("where:\n%s\nwant:\n%s", got, want)
+			}
+			if len(args) != len(tt.args) {
+				t.Fatalf("got %d args, want %d: %v", len(args), len(tt.args), args)
+			}
+			for i := range args {
+				if !argEqual(args[i], tt.args[i]) {
+					t.Errorf("arg $%d = %#v, want %#v", i+1, args[i], tt.args[i])
+				}
+			}
+			assertPlaceholdersUsed(t, got, len(args))
+		})
+	}
+}
+
+func mustPredicate(t *testing.T, s string) MetadataPredicate {
+	t.Helper()
+	p, err := ParseMetadataPredicate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func argEqual(a, b any) bool {
+	switch av := a.(type) {
+	case []string:
+		bv, ok := b.([]string)
+		return ok && slices.Equal(av, bv)
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	}
+	return a == b
+}
+
+var placeholderRe = regexp.MustCompile(`\$(\d+)`)
+
+// assertPlaceholdersUsed checks that q references exactly $1..$n: PostgreSQL
+// cannot infer the type of a parameter the query never uses (42P18).
+func assertPlaceholdersUsed(t *testing.T, q string, n int) {
+	t.Helper()
+	seen := make(map[int]bool)
+	for _, m := range placeholderRe.FindAllStringSubmatch(q, -1) {
+		i, _ := strconv.Atoi(m[1])
+		seen[i] = true
+	}
+	for i := 1; i <= n; i++ {
+		if !seen[i] {
+			t.Errorf("$%d is bound but not referenced", i)
+		}
+	}
+	for i := range seen {
+		if i < 1 || i > n {
+			t.Errorf("$%d is referenced but not bound (%d args)", i, n)
+		}
+	}
+}
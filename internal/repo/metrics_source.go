@@ -0,0 +1,178 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// metricsBase returns a SELECT over the events matched by f, with columns
+// d0.. (one per dimension), ts, user_id, n, v (the aggregate value, only
+// when agg has functions) and, for AccuracyApprox, sketch. Each row stands for
+// n events, so totals are SUM(n) and uniques COUNT(DISTINCT user_id), or the
+// merge of sketch and user_id (see Accuracy.uniqueColumns).
+//
+// When the query only filters and groups by rollup keys, whole minutes in
+// [f.From, f.To) are read from the rollup tables: counts rows (user_id NULL,
+// n = events) and user rows (n = 0). The ragged edges before the first and
+// after the last whole minute come from events. Both are exact, and user
+// sets merge across the union. With AccuracyApprox the rollups contribute
+// their sketches instead of user rows, and with hourly set (the caller does
+// not need ts finer than the hour) whole hours are read from
+// event_rollup_hour.
+func metricsBase(f MetricsFilter, dims []Dimension, agg Aggregate, acc Accuracy, hourly bool, param func(any) string) (string, error) {
+	first := f.From.Truncate(time.Minute)
+	if first.Before(f.From) {
+		first = first.Add(time.Minute)
+	}
+	last := f.To.Truncate(time.Minute)
+
+	if !f.Rollupable(dims, agg) || !first.Before(last) {
+		return rawBase(f, dims, agg, acc, param)
+	}
+
+	var parts []string
+	if f.From.Before(first) {
+		left := f
+		left.To = first
+		q, err := rawBase(left, dims, agg, acc, param)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, q)
+	}
+	parts = append(parts, rollupBase(f, dims, first, last, acc, hourly, param)...)
+	if last.Before(f.To) {
+		right := f
+		right.From = last
+		q, err := rawBase(right, dims, agg, acc, param)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, q)
+	}
+	return strings.Join(parts, "\n  UNION ALL\n"), nil
+}
+
+// Rollupable reports whether the rollups hold every column f, dims and agg
+// need: no tag or metadata filters, no aggregates, and only channel and
+// campaign_id dimensions.
+func (f MetricsFilter) Rollupable(dims []Dimension, agg Aggregate) bool {
+	if len(f.TagsAny) > 0 || len(f.TagsAll) > 0 || len(f.Metadata) > 0 || len(agg.Funcs) > 0 {
+		return false
+	}
+	for _, d := range dims {
+		if d.Kind != DimChannel && d.Kind != DimCampaignID {
+			return false
+		}
+	}
+	return true
+}
+
+func rawBase(f MetricsFilter, dims []Dimension, agg Aggregate, acc Accuracy, param func(any) string) (string, error) {
+	var (
+		cols []string
+		join string
+	)
+	for i, d := range dims {
+		var expr string
+		switch d.Kind {
+		case DimChannel:
+			expr = "e.channel"
+		case DimCampaignID:
+			expr = "e.campaign_id"
+		case DimTag:
+			expr = "t.tag"
+			join = "\n  LEFT JOIN LATERAL unnest(e.tags) AS t(tag) ON true"
+		case DimMetadata:
+			expr = "e.metadata #>> " + param(d.Path) + "::text[]"
+		default:
+			return "", fmt.Errorf("unknown dimension %q", d.Kind)
+		}
+		cols = append(cols, fmt.Sprintf("%s AS d%d", expr, i))
+	}
+	cols = append(cols, "e.ts AS ts", "e.user_id AS user_id", "1::bigint AS n")
+	if len(agg.Funcs) > 0 {
+		cols = append(cols, agg.value(param)+" AS v")
+	}
+	if acc == AccuracyApprox {
+		cols = append(cols, "NULL::bytea AS sketch")
+	}
+
+	return `
+  SELECT ` + strings.Join(cols, ", ") + `
+  FROM events e` + join + `
+  WHERE ` + f.where(param), nil
+}
+
+// rollupBase returns the counts and user-set selects for [first, last), or
+// with AccuracyApprox only the counts with their sketches (see metricsBase
+// for hourly).
+func rollupBase(f MetricsFilter, dims []Dimension, first, last time.Time, acc Accuracy, hourly bool, param func(any) string) []string {
+	var cols []string
+	for i, d := range dims {
+		expr := "channel"
+		if d.Kind == DimCampaignID {
+			// Rollups store a missing campaign as '' (it is part of the key).
+			expr = "NULLIF(campaign_id, '')"
+		}
+		cols = append(cols, fmt.Sprintf("%s AS d%d", expr, i))
+	}
+	sel := strings.Join(append(cols, "bucket AS ts"), ", ")
+
+	where := func(from, to time.Time, extra ...string) string {
+		conds := []string{
+			"event_name = " + param(f.EventName),
+			"bucket >= " + param(from),
+			"bucket < " + param(to),
+		}
+		if f.Channel != "" {
+			conds = append(conds, "channel = "+param(f.Channel))
+		}
+		if len(f.CampaignIDs) > 0 {
+			conds = append(conds, "campaign_id = ANY("+param(f.CampaignIDs)+"::text[])")
+		}
+		return strings.Join(append(conds, extra...), "\n    AND ")
+	}
+
+	if acc != AccuracyApprox {
+		w := where(first, last)
+		return []string{`
+  SELECT ` + sel + `, NULL::text AS user_id, events AS n
+  FROM event_rollup_minute
+  WHERE ` + w, `
+  SELECT ` + sel + `, user_id, 0::bigint AS n
+  FROM event_rollup_minute_users
+  WHERE ` + w}
+	}
+
+	sketches := func(table string, from, to time.Time, extra ...string) string {
+		return `
+  SELECT ` + sel + `, NULL::text AS user_id, events AS n, users_hll AS sketch
+  FROM ` + table + `
+  WHERE ` + where(from, to, extra...)
+	}
+
+	// Whole hours: the hour rows plus the minute rows not folded into them
+	// yet (see rollups.go).
+	h0 := first.Truncate(time.Hour)
+	if h0.Before(first) {
+		h0 = h0.Add(time.Hour)
+	}
+	h1 := last.Truncate(time.Hour)
+	if !hourly || !h0.Before(h1) {
+		return []string{sketches("event_rollup_minute", first, last)}
+	}
+
+	var parts []string
+	if first.Before(h0) {
+		parts = append(parts, sketches("event_rollup_minute", first, h0))
+	}
+	parts = append(parts,
+		sketches("event_rollup_hour", h0, h1),
+		sketches("event_rollup_minute", h0, h1, "NOT compacted"))
+	if h1.Before(last) {
+		parts = append(parts, sketches("event_rollup_minute", h1, last))
+	}
+	return parts
+}
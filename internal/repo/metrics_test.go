@@ -0,0 +1,325 @@
+package repo
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketStarts(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	utc := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts.UTC()
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		interval time.Duration
+		loc      *time.Location
+		want     []string // RFC3339 in UTC
+	}{
+		{
+			name:     "5m aligned",
+			from:     utc("2026-01-01T10:00:00Z"),
+			to:       utc("2026-01-01T10:15:00Z"),
+			interval: 5 * time.Minute,
+			loc:      time.UTC,
+			want:     []string{"2026-01-01T10:00:00Z", "2026-01-01T10:05:00Z", "2026-01-01T10:10:00Z"},
+		},
+		{
+			name:     "first bucket contains from",
+			from:     utc("2026-01-01T10:03:30Z"),
+			to:       utc("2026-01-01T10:10:01Z"),
+			interval: 5 * time.Minute,
+			loc:      time.UTC,
+			want:     []string{"2026-01-01T10:00:00Z", "2026-01-01T10:05:00Z", "2026-01-01T10:10:00Z"},
+		},
+		{
+			name:     "1h",
+			from:     utc("2026-01-01T10:30:00Z"),
+			to:       utc("2026-01-01T12:00:00Z"),
+			interval: time.Hour,
+			loc:      time.UTC,
+			want:     []string{"2026-01-01T10:00:00Z", "2026-01-01T11:00:00Z"},
+		},
+		{
+			name:     "1d UTC",
+			from:     utc("2026-01-01T12:00:00Z"),
+			to:       utc("2026-01-03T00:00:00Z"),
+			interval: 24 * time.Hour,
+			loc:      time.UTC,
+			want:     []string{"2026-01-01T00:00:00Z", "2026-01-02T00:00:00Z"},
+		},
+		{
+			name:     "1d local midnight",
+			from:     utc("2026-01-01T22:00:00Z"), // 01:00 on Jan 2 in Istanbul
+			to:       utc("2026-01-03T21:00:00Z"),
+			interval: 24 * time.Hour,
+			loc:      istanbul,
+			want:     []string{"2026-01-01T21:00:00Z", "2026-01-02T21:00:00Z"},
+		},
+		{
+			name:     "1d across DST",
+			from:     utc("2026-03-28T12:00:00Z"),
+			to:       utc("2026-03-30T12:00:00Z"),
+			interval: 24 * time.Hour,
+			loc:      berlin,
+			// Mar 29 has 23 hours in Berlin.
+			want: []string{"2026-03-27T23:00:00Z", "2026-03-28T23:00:00Z", "2026-03-29T22:00:00Z"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bucketStarts(tt.from, tt.to, tt.interval, tt.loc)
+			gotStr := make([]string, len(got))
+			for i, g := range got {
+				gotStr[i] = g.UTC().Format(time.RFC3339)
+			}
+			if strings.Join(gotStr, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("got %v, want %v", gotStr, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSeriesSQLArgs(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	from := time.Date(2026, 1, 1, 0, 0, 30, 0, time.UTC)
+	to := time.Date(2026, 1, 8, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		f        MetricsFilter
+		agg      Aggregate
+		acc      Accuracy
+		interval time.Duration
+		loc      *time.Location
+		first    any    // $1
+		expr     string // bucket expression
+	}{
+		{
+			name:     "day buckets bind only the time zone",
+			f:        MetricsFilter{EventName: "purchase", From: from, To: to},
+			acc:      AccuracyExact,
+			interval: 24 * time.Hour,
+			loc:      istanbul,
+			first:    "Europe/Istanbul",
+			expr:     "date_trunc('day', b.ts, $1)",
+		},
+		{
+			name:     "day buckets, approx",
+			f:        MetricsFilter{EventName: "purchase", From: from, To: to, Channel: "web"},
+			acc:      AccuracyApprox,
+			interval: 24 * time.Hour,
+			loc:      time.UTC,
+			first:    "UTC",
+			expr:     "date_trunc('day', b.ts, $1)",
+		},
+		{
+			name: "day buckets, raw with aggregates",
+			f: MetricsFilter{EventName: "purchase", From: from, To: to,
+				Metadata: []MetadataPredicate{mustPredicate(t, "metadata.amount>1")}},
+			agg:      Aggregate{Path: []string{"amount"}, Funcs: []AggFunc{AggSum, AggP95}},
+			acc:      AccuracyExact,
+			interval: 24 * time.Hour,
+			loc:      istanbul,
+			first:    "Europe/Istanbul",
+			expr:     "date_trunc('day', b.ts, $1)",
+		},
+		{
+			name:     "5m buckets bind only the interval",
+			f:        MetricsFilter{EventName: "purchase", From: from, To: to},
+			acc:      AccuracyExact,
+			interval: 5 * time.Minute,
+			loc:      time.UTC,
+			first:    5 * time.Minute,
+			expr:     "date_bin($1::interval, b.ts,",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, args, err := buildSeriesSQL(tt.f, tt.agg, tt.acc, tt.interval, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(args) == 0 || args[0] != tt.first {
+				t.Fatalf("$1 = %v, want %v", args, tt.first)
+			}
+			if !strings.Contains(q, tt.expr) {
+				t.Fatalf("bucket expression %q not in:\n%s", tt.expr, q)
+			}
+			assertPlaceholdersUsed(t, q, len(args))
+		})
+	}
+}
+
+func TestHourAligned(t *testing.T) {
+	load := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip("tzdata not available:", err)
+		}
+		return loc
+	}
+	istanbul, kolkata, berlin := load("Europe/Istanbul"), load("Asia/Kolkata"), load("Europe/Berlin")
+	from := time.Date(2026, 3, 25, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		loc      *time.Location
+		want     bool
+	}{
+		{"5m", 5 * time.Minute, time.UTC, false},
+		{"90m", 90 * time.Minute, time.UTC, false},
+		{"1h", time.Hour, time.UTC, true},
+		{"6h", 6 * time.Hour, istanbul, true},
+		{"1d UTC", 24 * time.Hour, time.UTC, true},
+		{"1d Istanbul", 24 * time.Hour, istanbul, true},
+		{"1d Berlin across DST", 24 * time.Hour, berlin, true},
+		{"1d Kolkata", 24 * time.Hour, kolkata, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hourAligned(from, to, tt.interval, tt.loc); got != tt.want {
+				t.Fatalf("hourAligned = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsBaseApproxHours(t *testing.T) {
+	at := func(h, m, s int) time.Time { return time.Date(2026, 1, 1, h, m, s, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		hourly   bool
+		// sources in order: "raw", "minute", "hour", "pending" (minute rows
+		// not compacted yet); each with its [from, to) bucket range
+		want []string
+	}{
+		{
+			name: "edges, minutes and hours",
+			from: at(10, 0, 30), to: at(13, 30, 0), hourly: true,
+			want: []string{"raw", "minute 10:01-11:00", "hour 11:00-13:00", "pending 11:00-13:00", "minute 13:00-13:30"},
+		},
+		{
+			name: "whole hours only",
+			from: at(10, 0, 0), to: at(12, 0, 0), hourly: true,
+			want: []string{"hour 10:00-12:00", "pending 10:00-12:00"},
+		},
+		{
+			name: "less than an hour",
+			from: at(10, 10, 0), to: at(10, 50, 0), hourly: true,
+			want: []string{"minute 10:10-10:50"},
+		},
+		{
+			name: "no whole hour inside",
+			from: at(10, 30, 0), to: at(11, 30, 0), hourly: true,
+			want: []string{"minute 10:30-11:30"},
+		},
+		{
+			name: "not hourly",
+			from: at(10, 0, 0), to: at(13, 0, 0),
+			want: []string{"minute 10:00-13:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := MetricsFilter{EventName: "purchase", From: tt.from, To: tt.to, Channel: "web"}
+			var args sqlArgs
+			q, err := metricsBase(f, nil, Aggregate{}, AccuracyApprox, tt.hourly, args.add)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPlaceholdersUsed(t, q, len(args))
+
+			var got []string
+			for _, part := range strings.Split(q, "UNION ALL") {
+				switch {
+				case strings.Contains(part, "FROM events"):
+					got = append(got, "raw")
+					continue
+				case strings.Contains(part, "FROM event_rollup_hour"):
+					got = append(got, "hour")
+				case strings.Contains(part, "NOT compacted"):
+					got = append(got, "pending")
+				case strings.Contains(part, "FROM event_rollup_minute"):
+					got = append(got, "minute")
+				default:
+					t.Fatalf("unknown source:\n%s", part)
+				}
+				// The bucket bounds are the first two time arguments bound
+				// by this part.
+				var bounds []string
+				for _, m := range placeholderRe.FindAllStringSubmatch(part, -1) {
+					i, _ := strconv.Atoi(m[1])
+					if ts, ok := args[i-1].(time.Time); ok {
+						bounds = append(bounds, ts.Format("15:04"))
+					}
+				}
+				if len(bounds) != 2 {
+					t.Fatalf("bounds %v in:\n%s", bounds, part)
+				}
+				got[len(got)-1] += " " + bounds[0] + "-" + bounds[1]
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Fatalf("sources:\n  %s\nwant:\n  %s", strings.Join(got, ", "), strings.Join(tt.want, ", "))
+			}
+		})
+	}
+}
+
+func TestBuildBreakdownSQLOrder(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := MetricsFilter{EventName: "purchase", From: from, To: from.Add(time.Hour)}
+	channel := Dimension{Kind: DimChannel}
+	campaign := Dimension{Kind: DimCampaignID}
+
+	tests := []struct {
+		name  string
+		dims  []Dimension
+		topN  int
+		order string
+		top   bool // top_d<i> CTEs and the other bucket
+	}{
+		{"every channel by value", []Dimension{channel}, 0, "ORDER BY d0 NULLS LAST;", false},
+		{"two dimensions by value", []Dimension{channel, campaign}, 0, "ORDER BY d0 NULLS LAST, d1 NULLS LAST;", false},
+		{"top N by total", []Dimension{channel}, 5, "ORDER BY d0_other, total DESC, d0 NULLS LAST;", true},
+		{"top N, two dimensions", []Dimension{channel, campaign}, 5,
+			"ORDER BY d0_other, d1_other, total DESC, d0 NULLS LAST, d1 NULLS LAST;", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, args, err := buildBreakdownSQL(f, Aggregate{}, AccuracyExact, tt.dims, tt.topN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPlaceholdersUsed(t, q, len(args))
+			if !strings.Contains(q, tt.order) {
+				t.Fatalf("%q not in:\n%s", tt.order, q)
+			}
+			if got := strings.Contains(q, "top_d0"); got != tt.top {
+				t.Fatalf("top_d0 present = %v, want %v:\n%s", got, tt.top, q)
+			}
+		})
+	}
+}
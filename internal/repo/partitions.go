@@ -0,0 +1,332 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// events and event_rollup_minute_users are range-partitioned by time
+// (migrations/008 and 009), with the same bounds. PartitionRepo keeps
+// partitions in place for the policy: one per period from the Lookback
+// horizon to Premake periods ahead, and none entirely older than the
+// retention horizon. Rows outside every range partition land in the
+// table's default partition (migrations/011), which retention never drops.
+
+// partitionedTables are maintained in this order: a user row is only
+// written with its event, so its partition must exist first.
+var partitionedTables = []string{"event_rollup_minute_users", "events"}
+
+// partitionKeys is the range column of each partitioned table.
+var partitionKeys = map[string]string{
+	"events":                    "ts",
+	"event_rollup_minute_users": "bucket",
+}
+
+type PartitionInterval string
+
+const (
+	PartitionDay   PartitionInterval = "day"
+	PartitionMonth PartitionInterval = "month"
+)
+
+// start returns the UTC start of the period containing t.
+func (p PartitionInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	if p == PartitionMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (p PartitionInterval) add(t time.Time, n int) time.Time {
+	if p == PartitionMonth {
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+type PartitionPolicy struct {
+	Interval PartitionInterval
+	// Premake is how many periods after the current one must exist.
+	Premake int
+	// Retention drops partitions whose upper bound is older than now minus
+	// Retention. 0 keeps everything.
+	Retention time.Duration
+	// Lookback is how far back from now partitions must exist. It should
+	// not exceed Retention. 0 starts at the current period; older rows go to
+	// the default partition.
+	Lookback time.Duration
+}
+
+type PartitionReport struct {
+	// Skipped is set when another instance held the maintenance lock.
+	Skipped bool
+	Created []string
+	Dropped []string
+}
+
+type PartitionRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewPartitionRepo(pool *pgxpool.Pool) *PartitionRepo {
+	return &PartitionRepo{pool: pool}
+}
+
+// partitionLockKey serialises Maintain across instances (pg_advisory_lock).
+const partitionLockKey int64 = 0x6576656e7473 // "events"
+
+type eventPartition struct {
+	Name          string
+	From, To      time.Time
+	DetachPending bool
+}
+
+// Maintain runs one pass: finishes interrupted detaches, creates missing
+// partitions and drops expired ones. A partition is only created for the
+// part of a period no existing partition covers, so changing Interval (or
+// the monthly partitions of the migration) never produces overlaps.
+func (r *PartitionRepo) Maintain(ctx context.Context, p PartitionPolicy, now time.Time) (_ PartitionReport, err error) {
+	ctx, span := startDBSpan(ctx, "db.partitions.maintain", "DDL")
+	defer func() { endDBSpan(span, err) }()
+
+	var rep PartitionReport
+
+	// Session-level lock: DETACH ... CONCURRENTLY cannot run in a
+	// transaction, so everything runs on one connection instead.
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return rep, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, partitionLockKey).Scan(&locked); err != nil {
+		return rep, err
+	}
+	if !locked {
+		rep.Skipped = true
+		return rep, nil
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, partitionLockKey)
+	}()
+
+	var cutoff time.Time
+	if p.Retention > 0 {
+		cutoff = now.Add(-p.Retention)
+	}
+	for _, table := range partitionedTables {
+		if err := maintainTable(ctx, conn, table, p, now, cutoff, &rep); err != nil {
+			return rep, err
+		}
+	}
+	return rep, nil
+}
+
+func maintainTable(ctx context.Context, conn *pgxpool.Conn, table string, p PartitionPolicy, now, cutoff time.Time, rep *PartitionReport) error {
+	parts, err := listPartitions(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+
+	// Create.
+	for _, part := range missingPartitions(table, parts, p, now) {
+		if err := createPartition(ctx, conn, table, part); err != nil {
+			return fmt.Errorf("create partition %s: %w", part.Name, err)
+		}
+		parts = insertPartition(parts, part)
+		rep.Created = append(rep.Created, part.Name)
+	}
+
+	// Drop.
+	if cutoff.IsZero() {
+		return nil
+	}
+	for _, part := range parts {
+		if part.To.After(cutoff) {
+			continue
+		}
+		if err := dropPartition(ctx, conn, table, part); err != nil {
+			return fmt.Errorf("drop partition %s: %w", part.Name, err)
+		}
+		rep.Dropped = append(rep.Dropped, part.Name)
+	}
+	return nil
+}
+
+// createPartition creates part. PostgreSQL refuses to create a partition
+// over rows the default partition holds (a backfill from before the lookback
+// was raised), so those are moved into it in the same transaction.
+func createPartition(ctx context.Context, conn *pgxpool.Conn, table string, part eventPartition) error {
+	parent, name := pgx.Identifier{table}.Sanitize(), pgx.Identifier{part.Name}.Sanitize()
+	def, key := pgx.Identifier{table + "_default"}.Sanitize(), partitionKeys[table]
+	bounds := fmt.Sprintf(`FOR VALUES FROM (%s) TO (%s)`, timestampLiteral(part.From), timestampLiteral(part.To))
+	inRange := key + ` >= $1 AND ` + key + ` < $2`
+
+	var occupied bool
+	q := `SELECT EXISTS (SELECT 1 FROM ` + def + ` WHERE ` + inRange + `)`
+	if err := conn.QueryRow(ctx, q, part.From, part.To).Scan(&occupied); err != nil {
+		return err
+	}
+	if !occupied {
+		_, err := conn.Exec(ctx, `CREATE TABLE `+name+` PARTITION OF `+parent+` `+bounds)
+		return err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `CREATE TABLE `+name+` (LIKE `+parent+` INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`); err != nil {
+		return err
+	}
+	move := `
+WITH moved AS (DELETE FROM ` + def + ` WHERE ` + inRange + ` RETURNING *)
+INSERT INTO ` + name + ` SELECT * FROM moved`
+	if _, err := tx.Exec(ctx, move, part.From, part.To); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `ALTER TABLE `+parent+` ATTACH PARTITION `+name+` `+bounds); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// listPartitions returns the range partitions of table by From. The bounds
+// are read back through pg_get_expr, which prints them as timestamptz
+// literals.
+func listPartitions(ctx context.Context, conn *pgxpool.Conn, table string) ([]eventPartition, error) {
+	const q = `
+SELECT name, pending, b[1]::timestamptz, b[2]::timestamptz
+FROM (
+  SELECT c.relname::text AS name,
+         i.inhdetachpending AS pending,
+         regexp_match(pg_get_expr(c.relpartbound, c.oid), 'FROM \(''([^'']*)''\) TO \(''([^'']*)''\)') AS b
+  FROM pg_inherits i
+  JOIN pg_class c ON c.oid = i.inhrelid
+  WHERE i.inhparent = $1::regclass
+) p
+WHERE b IS NOT NULL
+ORDER BY 3;
+`
+	rows, err := conn.Query(ctx, q, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []eventPartition
+	for rows.Next() {
+		var p eventPartition
+		if err := rows.Scan(&p.Name, &p.DetachPending, &p.From, &p.To); err != nil {
+			return nil, err
+		}
+		p.From, p.To = p.From.UTC(), p.To.UTC()
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// missingPartitions returns the partitions of table to create for p: every
+// range of the periods from the Lookback horizon to Premake periods ahead
+// that no partition in parts covers.
+func missingPartitions(table string, parts []eventPartition, p PartitionPolicy, now time.Time) []eventPartition {
+	var out []eventPartition
+	first := p.Interval.start(now.Add(-p.Lookback))
+	last := p.Interval.add(p.Interval.start(now), p.Premake+1)
+	for s := first; s.Before(last); s = p.Interval.add(s, 1) {
+		for _, gap := range uncovered(parts, s, p.Interval.add(s, 1)) {
+			gap.Name = table + "_p" + gap.From.Format("20060102")
+			out = append(out, gap)
+		}
+	}
+	return out
+}
+
+// uncovered returns the sub-ranges of [from, to) outside every partition;
+// parts must be sorted by From and not overlap.
+func uncovered(parts []eventPartition, from, to time.Time) []eventPartition {
+	var gaps []eventPartition
+	cur := from
+	for _, p := range parts {
+		if !p.To.After(cur) || !p.From.Before(to) {
+			continue
+		}
+		if p.From.After(cur) {
+			gaps = append(gaps, eventPartition{From: cur, To: p.From})
+		}
+		cur = p.To
+	}
+	if cur.Before(to) {
+		gaps = append(gaps, eventPartition{From: cur, To: to})
+	}
+	return gaps
+}
+
+func insertPartition(parts []eventPartition, p eventPartition) []eventPartition {
+	i := 0
+	for i < len(parts) && parts[i].From.Before(p.From) {
+		i++
+	}
+	parts = append(parts, eventPartition{})
+	copy(parts[i+1:], parts[i:])
+	parts[i] = p
+	return parts
+}
+
+// dropPartition detaches part from table without blocking writers to other
+// partitions (CONCURRENTLY; FINALIZE if an earlier attempt was interrupted)
+// and drops it. For events it also removes the range from the count rollups
+// so /metrics agrees with the remaining events, and from event_keys; the
+// user sets expire with their own partitions.
+func dropPartition(ctx context.Context, conn *pgxpool.Conn, table string, part eventPartition) error {
+	parent, name := pgx.Identifier{table}.Sanitize(), pgx.Identifier{part.Name}.Sanitize()
+	detach := `ALTER TABLE ` + parent + ` DETACH PARTITION ` + name + ` CONCURRENTLY`
+	if part.DetachPending {
+		detach = `ALTER TABLE ` + parent + ` DETACH PARTITION ` + name + ` FINALIZE`
+	}
+	if _, err := conn.Exec(ctx, detach); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, `DROP TABLE `+name); err != nil {
+		return err
+	}
+
+	if table != "events" {
+		return nil
+	}
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Waits for a running Compact, which could otherwise re-insert rows of
+	// this range after they are deleted.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, rollupLockKey); err != nil {
+		return err
+	}
+	// Partition bounds are whole UTC days, so they split no hour.
+	for _, rollup := range []string{"event_rollup_minute", "event_rollup_hour"} {
+		q := `DELETE FROM ` + rollup + ` WHERE bucket >= $1 AND bucket < $2`
+		if _, err := tx.Exec(ctx, q, part.From, part.To); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM event_keys WHERE ts >= $1 AND ts < $2`, part.From, part.To); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// timestampLiteral renders t for DDL, which takes no parameters.
+func timestampLiteral(t time.Time) string {
+	return "'" + t.UTC().Format("2006-01-02 15:04:05") + "+00'"
+}
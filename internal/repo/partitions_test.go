@@ -0,0 +1,206 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// day parses "2006-01-02" as UTC midnight.
+func day(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// partitionsOf builds partitions from "from..to" day ranges.
+func partitionsOf(t *testing.T, ranges ...string) []eventPartition {
+	t.Helper()
+	out := make([]eventPartition, 0, len(ranges))
+	for _, r := range ranges {
+		from, to, ok := strings.Cut(r, "..")
+		if !ok {
+			t.Fatalf("bad range %q", r)
+		}
+		p := eventPartition{From: day(t, from), To: day(t, to)}
+		p.Name = "events_p" + p.From.Format("20060102")
+		out = append(out, p)
+	}
+	return out
+}
+
+func rangesOf(parts []eventPartition) string {
+	s := make([]string, len(parts))
+	for i, p := range parts {
+		s[i] = fmt.Sprintf("%s..%s", p.From.Format("2006-01-02"), p.To.Format("2006-01-02"))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestUncovered(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    []string
+		from, to string
+		want     string
+	}{
+		{
+			name: "no partitions",
+			from: "2026-03-01", to: "2026-04-01",
+			want: "2026-03-01..2026-04-01",
+		},
+		{
+			name:  "fully covered by one",
+			parts: []string{"2026-03-01..2026-04-01"},
+			from:  "2026-03-01", to: "2026-04-01",
+		},
+		{
+			name:  "covered by a wider partition",
+			parts: []string{"2026-03-01..2026-04-01"},
+			from:  "2026-03-10", to: "2026-03-11",
+		},
+		{
+			name:  "partitions outside the range are ignored",
+			parts: []string{"2026-01-01..2026-02-01", "2026-05-01..2026-06-01"},
+			from:  "2026-03-01", to: "2026-04-01",
+			want: "2026-03-01..2026-04-01",
+		},
+		{
+			name:  "adjacent partitions do not count",
+			parts: []string{"2026-02-01..2026-03-01", "2026-04-01..2026-05-01"},
+			from:  "2026-03-01", to: "2026-04-01",
+			want: "2026-03-01..2026-04-01",
+		},
+		{
+			name:  "holes between days",
+			parts: []string{"2026-03-02..2026-03-03", "2026-03-05..2026-03-06"},
+			from:  "2026-03-01", to: "2026-03-08",
+			want: "2026-03-01..2026-03-02 2026-03-03..2026-03-05 2026-03-06..2026-03-08",
+		},
+		{
+			name:  "overlapping the start",
+			parts: []string{"2026-02-20..2026-03-04"},
+			from:  "2026-03-01", to: "2026-03-08",
+			want: "2026-03-04..2026-03-08",
+		},
+		{
+			name:  "overlapping the end",
+			parts: []string{"2026-03-06..2026-03-20"},
+			from:  "2026-03-01", to: "2026-03-08",
+			want: "2026-03-01..2026-03-06",
+		},
+		{
+			name:  "contiguous days cover a month",
+			parts: []string{"2026-02-01..2026-02-15", "2026-02-15..2026-03-01"},
+			from:  "2026-02-01", to: "2026-03-01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uncovered(partitionsOf(t, tt.parts...), day(t, tt.from), day(t, tt.to))
+			if r := rangesOf(got); r != tt.want {
+				t.Fatalf("got %q, want %q", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingPartitions(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		parts []string
+		p     PartitionPolicy
+		want  string
+	}{
+		{
+			name: "empty table, days",
+			p:    PartitionPolicy{Interval: PartitionDay, Premake: 2, Lookback: 48 * time.Hour},
+			want: "2026-03-13..2026-03-14 2026-03-14..2026-03-15 2026-03-15..2026-03-16 2026-03-16..2026-03-17 2026-03-17..2026-03-18",
+		},
+		{
+			name: "empty table, months",
+			p:    PartitionPolicy{Interval: PartitionMonth, Premake: 1, Lookback: 30 * 24 * time.Hour},
+			want: "2026-02-01..2026-03-01 2026-03-01..2026-04-01 2026-04-01..2026-05-01",
+		},
+		{
+			// Without a lookback, older rows go to the default partition.
+			name: "no lookback",
+			p:    PartitionPolicy{Interval: PartitionDay, Premake: 1},
+			want: "2026-03-15..2026-03-16 2026-03-16..2026-03-17",
+		},
+		{
+			name:  "nothing to do",
+			parts: []string{"2026-03-14..2026-03-15", "2026-03-15..2026-03-16", "2026-03-16..2026-03-17"},
+			p:     PartitionPolicy{Interval: PartitionDay, Premake: 1, Lookback: 24 * time.Hour},
+		},
+		{
+			// The migration leaves the current month; a lookback before it
+			// is filled with days up to the month, which is not split.
+			name:  "month to day",
+			parts: []string{"2026-03-01..2026-04-01"},
+			p:     PartitionPolicy{Interval: PartitionDay, Premake: 1, Lookback: 15 * 24 * time.Hour},
+			want:  "2026-02-28..2026-03-01",
+		},
+		{
+			name:  "month to day past the end of the month",
+			parts: []string{"2026-03-01..2026-04-01"},
+			p:     PartitionPolicy{Interval: PartitionDay, Premake: 20, Lookback: time.Hour},
+			want:  "2026-04-01..2026-04-02 2026-04-02..2026-04-03 2026-04-03..2026-04-04 2026-04-04..2026-04-05",
+		},
+		{
+			// Existing days stay; only the rest of each month is created.
+			name:  "day to month",
+			parts: []string{"2026-03-14..2026-03-15", "2026-03-15..2026-03-16", "2026-03-16..2026-03-17"},
+			p:     PartitionPolicy{Interval: PartitionMonth, Premake: 1, Lookback: time.Hour},
+			want:  "2026-03-01..2026-03-14 2026-03-17..2026-04-01 2026-04-01..2026-05-01",
+		},
+		{
+			name:  "day to month with a premade day in the next month",
+			parts: []string{"2026-03-15..2026-03-16", "2026-04-01..2026-04-02"},
+			p:     PartitionPolicy{Interval: PartitionMonth, Premake: 1, Lookback: time.Hour},
+			want:  "2026-03-01..2026-03-15 2026-03-16..2026-04-01 2026-04-02..2026-05-01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := partitionsOf(t, tt.parts...)
+			got := missingPartitions("events", parts, tt.p, now)
+			if r := rangesOf(got); r != tt.want {
+				t.Fatalf("got  %q\nwant %q", r, tt.want)
+			}
+
+			// The user sets get the same ranges under their own names.
+			users := missingPartitions("event_rollup_minute_users", partitionsOf(t, tt.parts...), tt.p, now)
+			if r := rangesOf(users); r != tt.want {
+				t.Fatalf("user sets: got %q, want %q", r, tt.want)
+			}
+			for _, p := range users {
+				if !strings.HasPrefix(p.Name, "event_rollup_minute_users_p") {
+					t.Errorf("user set partition named %q", p.Name)
+				}
+			}
+
+			// Names are unique and nothing overlaps once created.
+			for _, p := range got {
+				if p.Name != "events_p"+p.From.Format("20060102") {
+					t.Errorf("name %q for %s", p.Name, p.From)
+				}
+				parts = insertPartition(parts, p)
+			}
+			for i := 1; i < len(parts); i++ {
+				if parts[i].From.Before(parts[i-1].To) {
+					t.Errorf("overlap: %s", rangesOf(parts[i-1:i+1]))
+				}
+				if parts[i].Name == parts[i-1].Name {
+					t.Errorf("duplicate name %s", parts[i].Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type RetentionPeriod string
+
+const (
+	RetentionDay  RetentionPeriod = "day"
+	RetentionWeek RetentionPeriod = "week" // ISO weeks, starting Monday
+)
+
+// RetentionQuery builds a cohort table. A user's cohort is the period of
+// their first CohortEvent in [From, To); they count as returned in period k
+// (0 = the cohort period) if they did ReturnEvent in that period, at or after
+// that first CohortEvent. Periods start at local midnight in Location.
+type RetentionQuery struct {
+	CohortEvent string
+	ReturnEvent string
+	Period      RetentionPeriod
+	Periods     int
+	From, To    time.Time
+	Location    *time.Location
+
+	// Filter narrows both cohort and return events; its EventName, From
+	// and To are ignored.
+	Filter MetricsFilter
+
+	// Now marks periods that have not started yet; their counts are nil.
+	Now time.Time
+}
+
+type RetentionCohort struct {
+	Start    time.Time
+	Users    int64
+	Returned []*int64 // len Periods
+}
+
+// Retention returns one row per cohort period in [From, To), including
+// empty ones. The return events are found per cohort user through
+// events_user_ts_id_idx.
+func (r *MetricsRepo) Retention(ctx context.Context, rq RetentionQuery) ([]RetentionCohort, error) {
+	if rq.Periods <= 0 {
+		return nil, fmt.Errorf("retention needs at least one period")
+	}
+
+	q, args := buildRetentionSQL(rq)
+	rows, err := r.pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make(map[int64]*retentionCell)
+	for rows.Next() {
+		var (
+			start time.Time
+			k     *int32
+			n     int64
+		)
+		if err := rows.Scan(&start, &k, &n); err != nil {
+			return nil, err
+		}
+		c := cells[start.Unix()]
+		if c == nil {
+			c = &retentionCell{returned: make(map[int]int64)}
+			cells[start.Unix()] = c
+		}
+		if k == nil {
+			c.users = n
+		} else {
+			c.returned[int(*k)] = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return retentionTable(rq, cells), nil
+}
+
+// buildRetentionSQL returns one row per cohort with k NULL and its size,
+// and one per (cohort, k < Periods) with the users who returned in period k.
+func buildRetentionSQL(rq RetentionQuery) (string, []any) {
+	var args sqlArgs
+	unit := args.add(string(rq.Period))
+	tz := args.add(rq.Location.String())
+	periods := args.add(rq.Periods)
+
+	cohortF := rq.Filter
+	cohortF.EventName, cohortF.From, cohortF.To = rq.CohortEvent, rq.From, rq.To
+
+	// Returns can only fall in the Periods periods after the last cohort;
+	// the extra day covers DST and the partial first period.
+	returnF := rq.Filter
+	returnF.EventName, returnF.From = rq.ReturnEvent, rq.From
+	returnF.To = rq.Period.add(rq.To, rq.Periods).Add(24 * time.Hour)
+
+	periodIndex := "((date_trunc(" + unit + ", e.ts, " + tz + ") AT TIME ZONE " + tz + ")::date - (c.cohort AT TIME ZONE " + tz + ")::date)"
+	if rq.Period == RetentionWeek {
+		periodIndex += " / 7"
+	}
+
+	q := `
+WITH firsts AS (
+  SELECT e.user_id, MIN(e.ts) AS first_ts
+  FROM events e
+  WHERE ` + cohortF.where(args.add) + `
+  GROUP BY e.user_id
+),
+cohorts AS (
+  SELECT user_id, first_ts, date_trunc(` + unit + `, first_ts, ` + tz + `) AS cohort
+  FROM firsts
+),
+returns AS (
+  SELECT DISTINCT c.cohort, c.user_id, ` + periodIndex + ` AS k
+  FROM cohorts c
+  JOIN events e ON e.user_id = c.user_id AND e.ts >= c.first_ts
+  WHERE ` + returnF.where(args.add) + `
+)
+SELECT cohort, NULL::int AS k, COUNT(*)::bigint
+FROM cohorts
+GROUP BY cohort
+UNION ALL
+SELECT cohort, k, COUNT(*)::bigint
+FROM returns
+WHERE k < ` + periods + `
+GROUP BY cohort, k;
+`
+	return q, args
+}
+
+// retentionCell holds the query rows of one cohort.
+type retentionCell struct {
+	users    int64
+	returned map[int]int64
+}
+
+// retentionTable lays the cells (keyed by cohort start, unix seconds) out
+// over every period in [From, To); periods after Now are left nil.
+func retentionTable(rq RetentionQuery, cells map[int64]*retentionCell) []RetentionCohort {
+	var out []RetentionCohort
+	for s := rq.Period.start(rq.From.In(rq.Location)); s.Before(rq.To); s = rq.Period.add(s, 1) {
+		rc := RetentionCohort{Start: s, Returned: make([]*int64, rq.Periods)}
+		c := cells[s.Unix()]
+		if c != nil {
+			rc.Users = c.users
+		}
+		for k := range rq.Periods {
+			if rq.Period.add(s, k).After(rq.Now) {
+				break
+			}
+			var n int64
+			if c != nil {
+				n = c.returned[k]
+			}
+			rc.Returned[k] = &n
+		}
+		out = append(out, rc)
+	}
+	return out
+}
+
+// start returns the start of the period containing t, in t's location; it
+// matches date_trunc(p, ts, tz).
+func (p RetentionPeriod) start(t time.Time) time.Time {
+	d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if p == RetentionWeek {
+		// Monday = 0
+		d = d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+	}
+	return d
+}
+
+func (p RetentionPeriod) add(t time.Time, n int) time.Time {
+	if p == RetentionWeek {
+		return t.AddDate(0, 0, 7*n)
+	}
+	return t.AddDate(0, 0, n)
+}
@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildRetentionSQL(t *testing.T) {
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 14)
+
+	tests := []struct {
+		name     string
+		period   RetentionPeriod
+		filter   MetricsFilter
+		wantTo   time.Time // end of the return events range
+		extra    []any     // filter values, bound once per CTE
+		weekDiv  bool
+		location string
+	}{
+		{
+			name:     "daily",
+			period:   RetentionDay,
+			wantTo:   to.AddDate(0, 0, 4).Add(24 * time.Hour),
+			location: "UTC",
+		},
+		{
+			name:     "weekly with filter",
+			period:   RetentionWeek,
+			filter:   MetricsFilter{EventName: "ignored", From: from.AddDate(-1, 0, 0), Channel: "web"},
+			wantTo:   to.AddDate(0, 0, 28).Add(24 * time.Hour),
+			extra:    []any{"web"},
+			weekDiv:  true,
+			location: "Europe/Istanbul",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.location)
+			if err != nil {
+				t.Skip("tzdata not available:", err)
+			}
+			rq := RetentionQuery{
+				CohortEvent: "signup",
+				ReturnEvent: "purchase",
+				Period:      tt.period,
+				Periods:     4,
+				From:        from,
+				To:          to,
+				Location:    loc,
+				Filter:      tt.filter,
+			}
+			q, args := buildRetentionSQL(rq)
+			assertPlaceholdersUsed(t, q, len(args))
+
+			// The cohort CTE reads CohortEvent in [From, To); the return CTE
+			// reads ReturnEvent up to Periods periods (and a day) past To.
+			// The filter's own event name and range are replaced.
+			want := []any{string(tt.period), tt.location, 4, "signup", from, to}
+			want = append(want, tt.extra...)
+			want = append(want, "purchase", from, tt.wantTo)
+			want = append(want, tt.extra...)
+			if !reflect.DeepEqual(args, want) {
+				t.Fatalf("args = %v, want %v", args, want)
+			}
+
+			for _, s := range []string{
+				"MIN(e.ts) AS first_ts",
+				"date_trunc($1, first_ts, $2) AS cohort",
+				// Returns count from the first cohort event on, not from
+				// the start of the cohort period.
+				"JOIN events e ON e.user_id = c.user_id AND e.ts >= c.first_ts",
+				"((date_trunc($1, e.ts, $2) AT TIME ZONE $2)::date - (c.cohort AT TIME ZONE $2)::date)",
+				"SELECT DISTINCT c.cohort, c.user_id,",
+				"WHERE k < $3",
+			} {
+				if !strings.Contains(q, s) {
+					t.Errorf("query missing %q", s)
+				}
+			}
+			if got := strings.Contains(q, "::date) / 7 AS k"); got != tt.weekDiv {
+				t.Errorf("week division present = %v, want %v:\n%s", got, tt.weekDiv, q)
+			}
+		})
+	}
+}
+
+func TestRetentionPeriodStart(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	at := func(s string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04", s, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name   string
+		period RetentionPeriod
+		t      string
+		want   string
+		next   string // start of the following period
+	}{
+		{"day", RetentionDay, "2026-03-04 15:30", "2026-03-04 00:00", "2026-03-05 00:00"},
+		{"23 hour day", RetentionDay, "2026-03-29 01:00", "2026-03-29 00:00", "2026-03-30 00:00"},
+		{"week from wednesday", RetentionWeek, "2026-03-04 15:30", "2026-03-02 00:00", "2026-03-09 00:00"},
+		{"week from sunday", RetentionWeek, "2026-03-08 23:59", "2026-03-02 00:00", "2026-03-09 00:00"},
+		{"week from monday", RetentionWeek, "2026-03-09 00:00", "2026-03-09 00:00", "2026-03-16 00:00"},
+		// A 167 hour week still starts at local midnight.
+		{"week across DST", RetentionWeek, "2026-03-29 12:00", "2026-03-23 00:00", "2026-03-30 00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.period.start(at(tt.t))
+			if !got.Equal(at(tt.want)) {
+				t.Fatalf("start(%s) = %s, want %s", tt.t, got, tt.want)
+			}
+			if next := tt.period.add(got, 1); !next.Equal(at(tt.next)) {
+				t.Fatalf("add(%s, 1) = %s, want %s", got, next, tt.next)
+			}
+		})
+	}
+}
+
+func TestRetentionTable(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	n := func(v int64) *int64 { return &v }
+
+	rq := RetentionQuery{
+		Period:   RetentionDay,
+		Periods:  3,
+		From:     day(1).Add(6 * time.Hour), // inside the first cohort
+		To:       day(4),
+		Location: time.UTC,
+		Now:      day(3).Add(time.Hour),
+	}
+	cells := map[int64]*retentionCell{
+		day(1).Unix(): {users: 10, returned: map[int]int64{0: 10, 2: 3}},
+		day(3).Unix(): {users: 4, returned: map[int]int64{0: 4}},
+		// Outside [From, To): ignored.
+		day(9).Unix(): {users: 99, returned: map[int]int64{0: 99}},
+	}
+
+	want := []RetentionCohort{
+		// Day 1, 2 and 3 have started by Now.
+		{Start: day(1), Users: 10, Returned: []*int64{n(10), n(0), n(3)}},
+		// No signups: still listed, with zeros.
+		{Start: day(2), Users: 0, Returned: []*int64{n(0), n(0), nil}},
+		{Start: day(3), Users: 4, Returned: []*int64{n(4), nil, nil}},
+	}
+	got := retentionTable(rq, cells)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("table:\n%s\nwant:\n%s", formatCohorts(got), formatCohorts(want))
+	}
+}
+
+func formatCohorts(cs []RetentionCohort) string {
+	var b strings.Builder
+	for _, c := range cs {
+		b.WriteString(c.Start.Format(time.DateOnly))
+		b.WriteString(" users=" + strconv.FormatInt(c.Users, 10) + " returned=")
+		for _, r := range c.Returned {
+			if r == nil {
+				b.WriteString(" -")
+			} else {
+				b.WriteString(" " + strconv.FormatInt(*r, 10))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
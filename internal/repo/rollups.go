@@ -0,0 +1,299 @@
+package repo
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/cun0/insider-case/internal/hll"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Rollups (migrations/006, 007, 009 and 010), written in the insert
+// transaction so they always match the events table:
+//
+//   - event_rollup_minute: event count and HyperLogLog sketch of the users
+//     per (event_name, minute, channel, campaign_id). The table is
+//     append-only for writers: each transaction inserts its own rows (marked
+//     not compacted) instead of updating a shared one, so concurrent writers
+//     never wait on each other's row locks. Readers sum and merge all rows of
+//     a key; RollupRepo.Compact folds settled minutes into one row per key.
+//   - event_rollup_hour: the same per hour, for accuracy=approx over long
+//     ranges. Only Compact writes it, adding the minute rows it folds for the
+//     first time, so an hour is exactly its event_rollup_hour rows plus its
+//     minute rows that are not compacted yet.
+//   - event_rollup_minute_users: the distinct users of each key, an exact,
+//     mergeable set: uniques over any range of minutes are
+//     COUNT(DISTINCT user_id) over the union of their rows. Partitioned by
+//     bucket like events, and expired with it by PartitionRepo.
+
+type rollupKey struct {
+	EventName  string
+	Bucket     time.Time
+	Channel    string
+	CampaignID string // "" = none
+}
+
+func compareRollupKeys(a, b rollupKey) int {
+	return cmp.Or(
+		strings.Compare(a.EventName, b.EventName),
+		a.Bucket.Compare(b.Bucket),
+		strings.Compare(a.Channel, b.Channel),
+		strings.Compare(a.CampaignID, b.CampaignID),
+	)
+}
+
+type rollupUser struct {
+	rollupKey
+	UserID string
+}
+
+// rollupAgg is the count and users of one rollup key.
+type rollupAgg struct {
+	events int64
+	users  *hll.Sketch
+}
+
+// rollupAggs accumulates rows per key.
+type rollupAggs map[rollupKey]*rollupAgg
+
+func (m rollupAggs) get(k rollupKey) *rollupAgg {
+	a := m[k]
+	if a == nil {
+		a = &rollupAgg{users: hll.New()}
+		m[k] = a
+	}
+	return a
+}
+
+// writeRollups adds the events whose keys are in inserted to the rollups.
+// User rows are inserted in primary key order, so concurrent writers that
+// share a user and minute lock them in the same order and cannot deadlock.
+func writeRollups(ctx context.Context, tx pgx.Tx, events []domain.Event, inserted map[string]struct{}) error {
+	if len(inserted) == 0 {
+		return nil
+	}
+
+	aggs := make(rollupAggs)
+	users := make(map[rollupUser]struct{})
+	seen := make(map[string]struct{}, len(inserted))
+	for _, e := range events {
+		if _, ok := inserted[e.DedupKey]; !ok {
+			continue
+		}
+		// A batch may carry the same key twice; only one row was inserted.
+		if _, dup := seen[e.DedupKey]; dup {
+			continue
+		}
+		seen[e.DedupKey] = struct{}{}
+
+		k := rollupKey{
+			EventName:  e.EventName,
+			Bucket:     e.Timestamp.UTC().Truncate(time.Minute),
+			Channel:    e.Channel,
+			CampaignID: e.CampaignID,
+		}
+		a := aggs.get(k)
+		a.events++
+		a.users.Add(e.UserID)
+		users[rollupUser{rollupKey: k, UserID: e.UserID}] = struct{}{}
+	}
+
+	ukeys := make([]rollupUser, 0, len(users))
+	for u := range users {
+		ukeys = append(ukeys, u)
+	}
+	slices.SortFunc(ukeys, func(a, b rollupUser) int {
+		return cmp.Or(compareRollupKeys(a.rollupKey, b.rollupKey), strings.Compare(a.UserID, b.UserID))
+	})
+
+	var (
+		names, channels, campaigns, userIDs []string
+		buckets                             []time.Time
+	)
+	for _, u := range ukeys {
+		names = append(names, u.EventName)
+		buckets = append(buckets, u.Bucket)
+		channels = append(channels, u.Channel)
+		campaigns = append(campaigns, u.CampaignID)
+		userIDs = append(userIDs, u.UserID)
+	}
+
+	const insertUsers = `
+	INSERT INTO event_rollup_minute_users (event_name, bucket, channel, campaign_id, user_id)
+	SELECT * FROM unnest($1::text[], $2::timestamptz[], $3::text[], $4::text[], $5::text[])
+	ON CONFLICT DO NOTHING;
+`
+	if _, err := tx.Exec(ctx, insertUsers, names, buckets, channels, campaigns, userIDs); err != nil {
+		return err
+	}
+
+	// New rows only: nothing here waits for another transaction.
+	return insertRollups(ctx, tx, "event_rollup_minute", aggs, false)
+}
+
+// insertRollups appends one row per key of aggs to table.
+func insertRollups(ctx context.Context, tx pgx.Tx, table string, aggs rollupAggs, compacted bool) error {
+	if len(aggs) == 0 {
+		return nil
+	}
+	keys := make([]rollupKey, 0, len(aggs))
+	for k := range aggs {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, compareRollupKeys)
+
+	var (
+		names, channels, campaigns []string
+		buckets                    []time.Time
+		ns                         []int64
+		blobs                      [][]byte
+	)
+	for _, k := range keys {
+		names = append(names, k.EventName)
+		buckets = append(buckets, k.Bucket)
+		channels = append(channels, k.Channel)
+		campaigns = append(campaigns, k.CampaignID)
+		ns = append(ns, aggs[k].events)
+		blobs = append(blobs, aggs[k].users.Marshal())
+	}
+
+	q := `
+	INSERT INTO ` + table + ` (event_name, bucket, channel, campaign_id, events, users_hll, compacted)
+	SELECT n, b, c, k, e, u, $7
+	FROM unnest($1::text[], $2::timestamptz[], $3::text[], $4::text[], $5::bigint[], $6::bytea[])
+	  AS t(n, b, c, k, e, u);
+`
+	_, err := tx.Exec(ctx, q, names, buckets, channels, campaigns, ns, blobs, compacted)
+	return err
+}
+
+// RollupRepo maintains event_rollup_minute and event_rollup_hour.
+type RollupRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewRollupRepo(pool *pgxpool.Pool) *RollupRepo {
+	return &RollupRepo{pool: pool}
+}
+
+// rollupLockKey serialises Compact across instances.
+const rollupLockKey int64 = 0x726f6c6c757073 // "rollups"
+
+// compactKeysPerTx bounds the keys one Compact transaction rewrites.
+const compactKeysPerTx = 1000
+
+// Compact folds the rows of every minute key with uncompacted rows before
+// before into a single compacted row, adds what it folded for the first time
+// to event_rollup_hour, and then folds the hour rows the same way. Rows
+// written later for the same minutes (late events, a spool drain) are folded
+// in by a later pass. It returns how many keys it rewrote, or 0 without doing
+// anything when another instance is compacting.
+func (r *RollupRepo) Compact(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := startDBSpan(ctx, "db.rollups.compact", "DELETE")
+	defer func() { endDBSpan(span, err) }()
+
+	total := 0
+	defer func() { span.SetAttr("db.rollup_keys", total) }()
+
+	// Hour rows added for minutes before before start before it too.
+	for _, table := range []string{"event_rollup_minute", "event_rollup_hour"} {
+		for {
+			n, locked, err := r.compactOnce(ctx, table, before)
+			if err != nil || !locked {
+				return total, err
+			}
+			total += n
+			if n < compactKeysPerTx {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func (r *RollupRepo) compactOnce(ctx context.Context, table string, before time.Time) (n int, locked bool, err error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, rollupLockKey).Scan(&locked); err != nil {
+		return 0, false, err
+	}
+	if !locked {
+		return 0, false, nil
+	}
+
+	// Writers only insert, so deleting and re-inserting a key's rows never
+	// waits for (or blocks) ingestion.
+	take := `
+	WITH k AS (
+	  SELECT DISTINCT event_name, bucket, channel, campaign_id
+	  FROM ` + table + `
+	  WHERE NOT compacted AND bucket < $1
+	  LIMIT $2
+	)
+	DELETE FROM ` + table + ` r
+	USING k
+	WHERE r.event_name = k.event_name
+	  AND r.bucket = k.bucket
+	  AND r.channel = k.channel
+	  AND r.campaign_id = k.campaign_id
+	RETURNING r.event_name, r.bucket, r.channel, r.campaign_id, r.events, r.users_hll, r.compacted;
+`
+	rows, err := tx.Query(ctx, take, before, compactKeysPerTx)
+	if err != nil {
+		return 0, true, err
+	}
+	merged := make(rollupAggs)
+	hours := make(rollupAggs)
+	for rows.Next() {
+		var (
+			k         rollupKey
+			events    int64
+			raw       []byte
+			compacted bool
+		)
+		if err := rows.Scan(&k.EventName, &k.Bucket, &k.Channel, &k.CampaignID, &events, &raw, &compacted); err != nil {
+			rows.Close()
+			return 0, true, err
+		}
+		k.Bucket = k.Bucket.UTC()
+
+		aggs := []*rollupAgg{merged.get(k)}
+		if table == "event_rollup_minute" && !compacted {
+			h := k
+			h.Bucket = k.Bucket.Truncate(time.Hour)
+			aggs = append(aggs, hours.get(h))
+		}
+		for _, a := range aggs {
+			a.events += events
+			if raw != nil {
+				if err := a.users.MergeBytes(raw); err != nil {
+					rows.Close()
+					return 0, true, err
+				}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, true, err
+	}
+
+	if err := insertRollups(ctx, tx, table, merged, true); err != nil {
+		return 0, true, err
+	}
+	if err := insertRollups(ctx, tx, "event_rollup_hour", hours, false); err != nil {
+		return 0, true, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, true, err
+	}
+	return len(merged), true, nil
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cun0/insider-case/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BenchmarkInsertBatchRollups measures InsertBatch throughput with rollups
+// when 1, 4 and 8 writers (as with WRITER_SHARDS) all hit the same minute and
+// rollup keys, the worst case for rollup contention. It needs a migrated
+// database:
+//
+//	BENCH_DATABASE_URL=postgres://... go test ./internal/repo -run '^$' -bench InsertBatchRollups
+func BenchmarkInsertBatchRollups(b *testing.B) {
+	url := os.Getenv("BENCH_DATABASE_URL")
+	if url == "" {
+		b.Skip("BENCH_DATABASE_URL not set")
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pool.Close()
+	repo := NewEventRepo(pool, InsertValues)
+
+	const batch = 500
+	var seq atomic.Int64
+	// One minute, 4 channels and 500 users: every batch touches the same
+	// rollup keys.
+	ts := time.Now().UTC().Truncate(time.Minute).Add(-time.Hour)
+	makeBatch := func() []domain.Event {
+		events := make([]domain.Event, batch)
+		for i := range events {
+			n := seq.Add(1)
+			events[i] = domain.Event{
+				DedupKey:  "bench-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(n, 36),
+				EventName: "bench",
+				Channel:   "c" + strconv.Itoa(i%4),
+				UserID:    "u" + strconv.Itoa(i),
+				Timestamp: ts,
+				Tags:      []string{},
+				Metadata:  []byte(`{}`),
+			}
+		}
+		return events
+	}
+
+	for _, shards := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			var (
+				wg    sync.WaitGroup
+				next  atomic.Int64
+				first error
+				once  sync.Once
+			)
+			b.ResetTimer()
+			for range shards {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for next.Add(1) <= int64(b.N) {
+						if _, err := repo.InsertBatch(context.Background(), makeBatch()); err != nil {
+							once.Do(func() { first = err })
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			b.StopTimer()
+			if first != nil {
+				b.Fatal(first)
+			}
+			b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+
+	if _, err := pool.Exec(context.Background(), `DELETE FROM event_keys WHERE dedup_key IN (SELECT dedup_key FROM events WHERE event_name = 'bench')`); err != nil {
+		b.Log("cleanup event_keys:", err)
+	}
+	if _, err := pool.Exec(context.Background(), `DELETE FROM events WHERE event_name = 'bench'`); err != nil {
+		b.Log("cleanup events:", err)
+	}
+	for _, table := range []string{"event_rollup_minute", "event_rollup_minute_users"} {
+		if _, err := pool.Exec(context.Background(), `DELETE FROM `+table+` WHERE event_name = 'bench'`); err != nil {
+			b.Log("cleanup", table+":", err)
+		}
+	}
+}
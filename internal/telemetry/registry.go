@@ -0,0 +1,323 @@
+// Package telemetry is a small Prometheus registry: counters, gauges and
+// histograms (optionally labelled) rendered in the text exposition format.
+package telemetry
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]struct{}
+}
+
+type metric interface {
+	write(b *bytes.Buffer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// register panics on a duplicate name; metrics are registered at startup.
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.names[name]; dup {
+		panic("telemetry: duplicate metric " + name)
+	}
+	r.names[name] = struct{}{}
+	r.metrics = append(r.metrics, m)
+}
+
+// Handler serves the registry in Prometheus text format (version 0.0.4).
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		var b bytes.Buffer
+		r.mu.Lock()
+		metrics := append([]metric(nil), r.metrics...)
+		r.mu.Unlock()
+		for _, m := range metrics {
+			m.write(&b)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(b.Bytes())
+	})
+}
+
+// ---- counters and gauges ----
+
+type Counter struct{ bits atomic.Uint64 }
+
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add ignores negative values; counters only go up.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+type Gauge struct{ bits atomic.Uint64 }
+
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+func (g *Gauge) Add(v float64) { addFloat(&g.bits, v) }
+
+func (g *Gauge) value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// ---- histograms ----
+
+// DefBuckets suit request and flush latencies in seconds.
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64 // per bucket, last is +Inf
+	count  atomic.Uint64
+	sum    atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upper: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upper, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	addFloat(&h.sum, v)
+}
+
+// ---- vectors ----
+
+// vec holds one child per distinct label-value tuple.
+type vec[T any] struct {
+	name, help, typ string
+	labels          []string
+	newChild        func() T
+	writeChild      func(b *bytes.Buffer, name string, labels, values []string, c T)
+
+	mu       sync.RWMutex
+	children map[string]*child[T]
+}
+
+type child[T any] struct {
+	values []string
+	m      T
+}
+
+func (v *vec[T]) with(values ...string) T {
+	if len(values) != len(v.labels) {
+		panic("telemetry: " + v.name + ": wrong number of label values")
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c.m
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.children[key]; ok {
+		return c.m
+	}
+	c = &child[T]{values: append([]string(nil), values...), m: v.newChild()}
+	v.children[key] = c
+	return c.m
+}
+
+func (v *vec[T]) write(b *bytes.Buffer) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	writeHeader(b, v.name, v.help, v.typ)
+	for _, k := range keys {
+		v.mu.RLock()
+		c := v.children[k]
+		v.mu.RUnlock()
+		v.writeChild(b, v.name, v.labels, c.values, c.m)
+	}
+}
+
+type CounterVec struct{ v *vec[*Counter] }
+
+func (c *CounterVec) With(values ...string) *Counter { return c.v.with(values...) }
+
+type GaugeVec struct{ v *vec[*Gauge] }
+
+func (g *GaugeVec) With(values ...string) *Gauge { return g.v.with(values...) }
+
+type HistogramVec struct{ v *vec[*Histogram] }
+
+func (h *HistogramVec) With(values ...string) *Histogram { return h.v.with(values...) }
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &vec[*Counter]{
+		name: name, help: help, typ: "counter", labels: labels,
+		newChild: func() *Counter { return &Counter{} },
+		writeChild: func(b *bytes.Buffer, name string, labels, values []string, c *Counter) {
+			writeSample(b, name, labels, values, "", "", c.value())
+		},
+		children: make(map[string]*child[*Counter]),
+	}
+	r.register(name, v)
+	return &CounterVec{v: v}
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &vec[*Gauge]{
+		name: name, help: help, typ: "gauge", labels: labels,
+		newChild: func() *Gauge { return &Gauge{} },
+		writeChild: func(b *bytes.Buffer, name string, labels, values []string, g *Gauge) {
+			writeSample(b, name, labels, values, "", "", g.value())
+		},
+		children: make(map[string]*child[*Gauge]),
+	}
+	r.register(name, v)
+	return &GaugeVec{v: v}
+}
+
+// NewHistogramVec uses DefBuckets when buckets is nil. Buckets must be sorted.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	v := &vec[*Histogram]{
+		name: name, help: help, typ: "histogram", labels: labels,
+		newChild: func() *Histogram { return newHistogram(buckets) },
+		writeChild: func(b *bytes.Buffer, name string, labels, values []string, h *Histogram) {
+			var cum uint64
+			for i, le := range h.upper {
+				cum += h.counts[i].Load()
+				writeSample(b, name+"_bucket", labels, values, "le", formatFloat(le), float64(cum))
+			}
+			cum += h.counts[len(h.upper)].Load()
+			writeSample(b, name+"_bucket", labels, values, "le", "+Inf", float64(cum))
+			writeSample(b, name+"_sum", labels, values, "", "", math.Float64frombits(h.sum.Load()))
+			writeSample(b, name+"_count", labels, values, "", "", float64(h.count.Load()))
+		},
+		children: make(map[string]*child[*Histogram]),
+	}
+	r.register(name, v)
+	return &HistogramVec{v: v}
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+// ---- function-backed metrics ----
+
+type funcMetric struct {
+	name, help, typ string
+	fn              func() float64
+}
+
+func (f *funcMetric) write(b *bytes.Buffer) {
+	writeHeader(b, f.name, f.help, f.typ)
+	writeSample(b, f.name, nil, nil, "", "", f.fn())
+}
+
+// NewGaugeFunc samples fn at scrape time (e.g. queue depth).
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc samples a monotonically increasing value owned elsewhere
+// (e.g. pgxpool's acquire count).
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: "counter", fn: fn})
+}
+
+// ---- text format ----
+
+func writeHeader(b *bytes.Buffer, name, help, typ string) {
+	b.WriteString("# HELP ")
+	b.WriteString(name)
+	b.WriteByte(' ')
+	b.WriteString(strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	b.WriteString("\n# TYPE ")
+	b.WriteString(name)
+	b.WriteByte(' ')
+	b.WriteString(typ)
+	b.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeSample(b *bytes.Buffer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	b.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l)
+			b.WriteString(`="`)
+			b.WriteString(labelEscaper.Replace(values[i]))
+			b.WriteByte('"')
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(extraName)
+			b.WriteString(`="`)
+			b.WriteString(extraValue)
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
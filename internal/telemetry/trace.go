@@ -0,0 +1,378 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cun0/insider-case/internal/jsonlog"
+)
+
+// W3C Trace Context (https://www.w3.org/TR/trace-context/) and a span model
+// compatible with OTLP. A nil *Tracer and a nil *Span are valid no-ops, so
+// instrumented code does not need to check whether tracing is enabled.
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent formats sc as a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent accepts version 00 headers (and future versions, per spec,
+// by reading the first four fields).
+func ParseTraceparent(h string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+type SpanKind int
+
+// Values match OTLP's SpanKind enum.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+type attr struct {
+	key string
+	val any
+}
+
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	kind   SpanKind
+	start  time.Time
+
+	mu       sync.Mutex
+	name     string
+	end      time.Time
+	attrs    []attr
+	links    []SpanContext
+	errMsg   string
+	hasError bool
+	ended    bool
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttr records a string, bool, integer or float attribute; other values
+// are formatted with fmt.
+func (s *Span) SetAttr(key string, val any) {
+	if s == nil {
+		return
+	}
+	switch v := val.(type) {
+	case string, bool, int64, float64:
+	case int:
+		val = int64(v)
+	default:
+		val = fmt.Sprint(v)
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attr{key: key, val: val})
+	s.mu.Unlock()
+}
+
+func (s *Span) AddLink(sc SpanContext) {
+	if s == nil || !sc.IsValid() {
+		return
+	}
+	s.mu.Lock()
+	s.links = append(s.links, sc)
+	s.mu.Unlock()
+}
+
+// SetError marks the span failed. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.hasError = true
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End records the span; calls after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+type ctxKeySpan struct{}
+
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKeySpan{}, s)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(ctxKeySpan{}).(*Span)
+	return s
+}
+
+// StartSpan starts a child of the span in ctx, using its tracer. Without a
+// span in ctx it is a no-op and returns ctx and a nil span.
+func StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, opts...)
+}
+
+type spanConfig struct {
+	kind   SpanKind
+	remote SpanContext
+	links  []SpanContext
+	root   bool
+}
+
+type SpanOption func(*spanConfig)
+
+func WithKind(k SpanKind) SpanOption {
+	return func(c *spanConfig) { c.kind = k }
+}
+
+// WithRemoteParent continues a trace received from another service.
+func WithRemoteParent(sc SpanContext) SpanOption {
+	return func(c *spanConfig) { c.remote = sc }
+}
+
+func WithLinks(links ...SpanContext) SpanOption {
+	return func(c *spanConfig) { c.links = append(c.links, links...) }
+}
+
+// AsRoot starts a new trace even if ctx holds a span (e.g. a batch flush
+// serving many requests, which links to them instead).
+func AsRoot() SpanOption {
+	return func(c *spanConfig) { c.root = true }
+}
+
+// Tracer creates spans and exports the sampled ones in the background.
+type Tracer struct {
+	service string
+	ratio   float64
+	exp     Exporter
+	logger  *jsonlog.Logger
+
+	queue  chan *Span
+	stopCh chan struct{}
+	doneCh chan struct{}
+	once   sync.Once
+}
+
+const (
+	traceQueueSize   = 4096
+	traceBatchSize   = 512
+	traceFlushPeriod = 2 * time.Second
+)
+
+// NewTracer samples new traces with probability ratio (children follow
+// their parent's decision) and exports through exp.
+func NewTracer(service string, ratio float64, exp Exporter, logger *jsonlog.Logger) *Tracer {
+	t := &Tracer{
+		service: service,
+		ratio:   ratio,
+		exp:     exp,
+		logger:  logger,
+		queue:   make(chan *Span, traceQueueSize),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	cfg := spanConfig{kind: SpanKindInternal}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	s := &Span{tracer: t, name: name, kind: cfg.kind, start: time.Now(), links: cfg.links}
+
+	var parent SpanContext
+	switch {
+	case cfg.remote.IsValid():
+		parent = cfg.remote
+	case !cfg.root:
+		parent = SpanFromContext(ctx).Context()
+	}
+
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = t.sample(s.sc.TraceID)
+	}
+	_, _ = rand.Read(s.sc.SpanID[:])
+
+	return ContextWithSpan(ctx, s), s
+}
+
+// sample decides from the trace id so that the decision is deterministic.
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.ratio >= 1:
+		return true
+	case t.ratio <= 0:
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>11)/(1<<53) < t.ratio
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		// Never block request paths on export; drop under pressure.
+	}
+}
+
+func (t *Tracer) loop() {
+	defer close(t.doneCh)
+
+	ticker := time.NewTicker(traceFlushPeriod)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, traceBatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := t.exp.Export(ctx, t.service, batch); err != nil && t.logger != nil {
+			t.logger.PrintError(err, map[string]string{
+				"component": "trace_exporter",
+				"spans":     fmt.Sprint(len(batch)),
+			})
+		}
+		cancel()
+		batch = make([]*Span, 0, traceBatchSize)
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case <-t.stopCh:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					export()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports what is queued and closes the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.once.Do(func() { close(t.stopCh) })
+	select {
+	case <-t.doneCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exp.Close()
+}
@@ -0,0 +1,207 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*Span) error
+	Close() error
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP collector using the JSON encoding.
+type OTLPExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLPExporter takes the collector base URL (e.g. http://localhost:4318);
+// spans are sent to <endpoint>/v1/traces.
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{
+		url:    strings.TrimRight(endpoint, "/") + "/v1/traces",
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Close() error { return nil }
+
+// FileExporter appends one OTLP JSON document per export to a file, for
+// local testing without a collector.
+type FileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f}, nil
+}
+
+func (e *FileExporter) Export(_ context.Context, service string, spans []*Span) error {
+	line, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.f.Write(append(line, '\n'))
+	return err
+}
+
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
+
+// ---- OTLP JSON encoding (ExportTraceServiceRequest) ----
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 is a string in OTLP JSON
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpRequest(service string, spans []*Span) otlpTraces {
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpKeyValue{otlpAttr("service.name", service)}
+
+	var ss otlpScopeSpans
+	ss.Scope.Name = "github.com/cun0/insider-case/internal/telemetry"
+	ss.Spans = make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+		s.mu.Lock()
+		out := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent.IsValid() {
+			out.ParentSpanID = s.parent.String()
+		}
+		for _, a := range s.attrs {
+			out.Attributes = append(out.Attributes, otlpAttr(a.key, a.val))
+		}
+		for _, l := range s.links {
+			out.Links = append(out.Links, otlpLink{TraceID: l.TraceID.String(), SpanID: l.SpanID.String()})
+		}
+		if s.hasError {
+			out.Status = otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+
+		ss.Spans = append(ss.Spans, out)
+	}
+
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+func otlpAttr(key string, val any) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch v := val.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
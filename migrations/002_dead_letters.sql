@@ -0,0 +1,21 @@
+-- migrations/002_dead_letters.sql
+
+-- Events that could not be persisted. payload/event are stored as TEXT, not
+-- JSONB: the row may be here precisely because PostgreSQL rejected it as jsonb.
+CREATE TABLE IF NOT EXISTS dead_letters (
+  id                BIGSERIAL   PRIMARY KEY,
+  created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  component         TEXT        NOT NULL,
+  request_id        TEXT        NULL,
+  dedup_key         TEXT        NOT NULL,
+  error             TEXT        NOT NULL,
+  payload           TEXT        NULL,
+  event             TEXT        NOT NULL,
+  status            TEXT        NOT NULL DEFAULT 'pending',
+  replay_attempts   INT         NOT NULL DEFAULT 0,
+  last_replay_error TEXT        NULL,
+  replayed_at       TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_status_id_idx
+  ON dead_letters (status, id);
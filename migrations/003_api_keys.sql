@@ -0,0 +1,15 @@
+-- migrations/003_api_keys.sql
+
+-- Only the SHA-256 of a key is stored; prefix is kept for display.
+CREATE TABLE IF NOT EXISTS api_keys (
+  id         BIGSERIAL   PRIMARY KEY,
+  name       TEXT        NOT NULL,
+  prefix     TEXT        NOT NULL,
+  key_hash   BYTEA       NOT NULL,
+  scopes     TEXT[]      NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_key_hash_uq
+  ON api_keys (key_hash);
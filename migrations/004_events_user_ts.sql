@@ -0,0 +1,8 @@
+-- migrations/004_events_user_ts.sql
+
+-- Per-user event listing (GET /users/{user_id}/events): equality on user_id,
+-- newest first with keyset pagination on (ts, id). Lookups by dedup_key use
+-- events_dedup_key_uq. On a populated table, create it with CONCURRENTLY
+-- outside a transaction instead.
+CREATE INDEX IF NOT EXISTS events_user_ts_id_idx
+  ON events (user_id, ts DESC, id DESC);
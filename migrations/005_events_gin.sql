@@ -0,0 +1,12 @@
+-- migrations/005_events_gin.sql
+
+-- Metrics filters: tags_any / tags_all (&&, @> on text[]) and metadata
+-- equality (@> containment). jsonb_path_ops is smaller and faster than the
+-- default opclass and supports @>, which is the only metadata operator the
+-- filters need from an index. Both add write cost on ingest; on a populated
+-- table, create them with CONCURRENTLY outside a transaction instead.
+CREATE INDEX IF NOT EXISTS events_tags_gin
+  ON events USING GIN (tags);
+
+CREATE INDEX IF NOT EXISTS events_metadata_gin
+  ON events USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,37 @@
+-- migrations/006_rollups.sql
+
+-- Per-minute rollups, maintained by EventRepo in the insert transaction and
+-- read by /metrics for whole minutes. campaign_id is part of the key, so a
+-- missing campaign is stored as ''.
+CREATE TABLE IF NOT EXISTS event_rollup_minute (
+  event_name  TEXT        NOT NULL,
+  bucket      TIMESTAMPTZ NOT NULL,
+  channel     TEXT        NOT NULL,
+  campaign_id TEXT        NOT NULL DEFAULT '',
+  events      BIGINT      NOT NULL,
+  PRIMARY KEY (event_name, bucket, channel, campaign_id)
+);
+
+-- Distinct users per rollup row. Sets merge by union, so uniques over any
+-- range of minutes stay exact.
+CREATE TABLE IF NOT EXISTS event_rollup_minute_users (
+  event_name  TEXT        NOT NULL,
+  bucket      TIMESTAMPTZ NOT NULL,
+  channel     TEXT        NOT NULL,
+  campaign_id TEXT        NOT NULL DEFAULT '',
+  user_id     TEXT        NOT NULL,
+  PRIMARY KEY (event_name, bucket, channel, campaign_id, user_id)
+);
+
+-- Backfill from existing events. Run before the new binary starts writing
+-- rollups; rows it already wrote are left alone.
+INSERT INTO event_rollup_minute (event_name, bucket, channel, campaign_id, events)
+SELECT event_name, date_trunc('minute', ts), channel, COALESCE(campaign_id, ''), COUNT(*)
+FROM events
+GROUP BY 1, 2, 3, 4
+ON CONFLICT DO NOTHING;
+
+INSERT INTO event_rollup_minute_users (event_name, bucket, channel, campaign_id, user_id)
+SELECT DISTINCT event_name, date_trunc('minute', ts), channel, COALESCE(campaign_id, ''), user_id
+FROM events
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,40 @@
+-- migrations/007_rollup_hll.sql
+
+-- HyperLogLog sketch of each rollup row's users (internal/hll), for
+-- /metrics?accuracy=approx. Written by EventRepo with the counts.
+ALTER TABLE event_rollup_minute
+  ADD COLUMN IF NOT EXISTS users_hll BYTEA;
+
+-- Backfill from the exact user sets, in the sparse encoding internal/hll
+-- reads: format 0x01, precision 14, then (register uint16, rank uint8) per
+-- non-zero register in order. The hash is the first 64 bits of md5(user_id);
+-- the register is its top 14 bits and the rank the leading zeros of the
+-- other 50, plus one. Keep in sync with hll.Sketch.Add.
+WITH hashed AS (
+  SELECT event_name, bucket, channel, campaign_id,
+         ('x' || left(md5(user_id), 16))::bit(64)::bigint AS h
+  FROM event_rollup_minute_users
+),
+regs AS (
+  SELECT event_name, bucket, channel, campaign_id,
+         (h >> 50) & 16383 AS idx,
+         MAX(CASE WHEN h & 1125899906842623 = 0 THEN 51
+                  ELSE position('1' IN (h & 1125899906842623)::bit(64)::text) - 14
+             END) AS rank
+  FROM hashed
+  GROUP BY 1, 2, 3, 4, 5
+),
+sketches AS (
+  SELECT event_name, bucket, channel, campaign_id,
+         '\x010e'::bytea || string_agg(int2send(idx::int2) || set_byte('\x00'::bytea, 0, rank), ''::bytea ORDER BY idx) AS users_hll
+  FROM regs
+  GROUP BY 1, 2, 3, 4
+)
+UPDATE event_rollup_minute r
+SET users_hll = s.users_hll
+FROM sketches s
+WHERE r.users_hll IS NULL
+  AND r.event_name = s.event_name
+  AND r.bucket = s.bucket
+  AND r.channel = s.channel
+  AND r.campaign_id = s.campaign_id;
@@ -0,0 +1,83 @@
+-- migrations/008_events_partitioned.sql
+
+-- Range-partition events by ts. Partitions are created ahead of time and
+-- expired by the app's partition manager (EVENTS_PARTITION_* settings); this
+-- migration only covers existing rows, with monthly partitions up to the
+-- current month.
+--
+-- Unique indexes on a partitioned table must include the partition key, so
+-- dedup uses (dedup_key, ts). That is as strict as dedup_key alone because
+-- the key is derived from the timestamp (at the same millisecond resolution
+-- ts is stored with): duplicates always carry the same ts, so they land in
+-- the same partition and conflict there.
+--
+-- Rewrites the table under an exclusive lock; run with ingestion stopped.
+
+BEGIN;
+
+SET LOCAL TimeZone = 'UTC';
+
+ALTER TABLE events RENAME TO events_unpartitioned;
+ALTER TABLE events_unpartitioned DROP CONSTRAINT events_pkey;
+DROP INDEX IF EXISTS events_dedup_key_uq;
+DROP INDEX IF EXISTS events_event_name_ts_idx;
+DROP INDEX IF EXISTS events_user_ts_id_idx;
+DROP INDEX IF EXISTS events_tags_gin;
+DROP INDEX IF EXISTS events_metadata_gin;
+
+CREATE TABLE events (
+  id          BIGINT      NOT NULL DEFAULT nextval('events_id_seq'),
+  dedup_key   TEXT        NOT NULL,
+  event_name  TEXT        NOT NULL,
+  channel     TEXT        NOT NULL,
+  campaign_id TEXT        NULL,
+  user_id     TEXT        NOT NULL,
+  ts          TIMESTAMPTZ NOT NULL,
+  tags        TEXT[]      NOT NULL DEFAULT '{}',
+  metadata    JSONB       NOT NULL DEFAULT '{}'::jsonb,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (id, ts)
+) PARTITION BY RANGE (ts);
+
+ALTER SEQUENCE events_id_seq OWNED BY events.id;
+
+-- Same indexes as 001, 004 and 005; each partition gets its own copy.
+CREATE UNIQUE INDEX events_dedup_key_ts_uq
+  ON events (dedup_key, ts);
+
+CREATE INDEX events_event_name_ts_idx
+  ON events (event_name, ts);
+
+CREATE INDEX events_user_ts_id_idx
+  ON events (user_id, ts DESC, id DESC);
+
+CREATE INDEX events_tags_gin
+  ON events USING GIN (tags);
+
+CREATE INDEX events_metadata_gin
+  ON events USING GIN (metadata jsonb_path_ops);
+
+-- Partition names are events_p<start, YYYYMMDD>, as the manager creates them.
+DO $$
+DECLARE
+  m timestamptz;
+BEGIN
+  FOR m IN
+    SELECT generate_series(
+      date_trunc('month', COALESCE(MIN(ts), now())),
+      date_trunc('month', GREATEST(MAX(ts), now())),
+      interval '1 month')
+    FROM events_unpartitioned
+  LOOP
+    EXECUTE format('CREATE TABLE %I PARTITION OF events FOR VALUES FROM (%L) TO (%L)',
+      'events_p' || to_char(m, 'YYYYMMDD'), m, m + interval '1 month');
+  END LOOP;
+END $$;
+
+INSERT INTO events (id, dedup_key, event_name, channel, campaign_id, user_id, ts, tags, metadata, created_at)
+SELECT id, dedup_key, event_name, channel, campaign_id, user_id, ts, tags, metadata, created_at
+FROM events_unpartitioned;
+
+DROP TABLE events_unpartitioned;
+
+COMMIT;
@@ -0,0 +1,69 @@
+-- migrations/009_rollup_deltas.sql
+
+-- event_rollup_minute becomes append-only for writers: every insert
+-- transaction adds its own (count, sketch) rows instead of upserting one row
+-- per key, so sharded writers and the spool drain no longer queue on the
+-- same hot rows. Readers already SUM counts and merge sketches per group;
+-- RollupRepo.Compact folds settled minutes back into one row per key.
+--
+-- event_rollup_minute_users is range-partitioned by bucket with the same
+-- bounds as events, so the partition manager creates and drops both together
+-- instead of deleting expired user rows one by one.
+--
+-- Rewrites event_rollup_minute_users under an exclusive lock; run with
+-- ingestion stopped, after 008.
+
+BEGIN;
+
+SET LOCAL TimeZone = 'UTC';
+
+ALTER TABLE event_rollup_minute DROP CONSTRAINT event_rollup_minute_pkey;
+-- Existing rows are one per key already.
+ALTER TABLE event_rollup_minute ADD COLUMN compacted BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE event_rollup_minute ALTER COLUMN compacted SET DEFAULT false;
+
+CREATE INDEX event_rollup_minute_key_idx
+  ON event_rollup_minute (event_name, bucket, channel, campaign_id);
+
+-- Only the rows Compact has yet to fold; stays small.
+CREATE INDEX event_rollup_minute_pending_idx
+  ON event_rollup_minute (bucket)
+  WHERE NOT compacted;
+
+ALTER TABLE event_rollup_minute_users RENAME TO event_rollup_minute_users_unpartitioned;
+ALTER TABLE event_rollup_minute_users_unpartitioned
+  RENAME CONSTRAINT event_rollup_minute_users_pkey TO event_rollup_minute_users_unpartitioned_pkey;
+
+CREATE TABLE event_rollup_minute_users (
+  event_name  TEXT        NOT NULL,
+  bucket      TIMESTAMPTZ NOT NULL,
+  channel     TEXT        NOT NULL,
+  campaign_id TEXT        NOT NULL DEFAULT '',
+  user_id     TEXT        NOT NULL,
+  PRIMARY KEY (event_name, bucket, channel, campaign_id, user_id)
+) PARTITION BY RANGE (bucket);
+
+-- One partition per events partition, same bounds. Names follow the
+-- manager's <table>_p<start, YYYYMMDD>.
+DO $$
+DECLARE
+  p record;
+BEGIN
+  FOR p IN
+    SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound
+    FROM pg_inherits i
+    JOIN pg_class c ON c.oid = i.inhrelid
+    WHERE i.inhparent = 'events'::regclass
+  LOOP
+    EXECUTE format('CREATE TABLE %I PARTITION OF event_rollup_minute_users %s',
+      regexp_replace(p.name, '^events_p', 'event_rollup_minute_users_p'), p.bound);
+  END LOOP;
+END $$;
+
+INSERT INTO event_rollup_minute_users (event_name, bucket, channel, campaign_id, user_id)
+SELECT event_name, bucket, channel, campaign_id, user_id
+FROM event_rollup_minute_users_unpartitioned;
+
+DROP TABLE event_rollup_minute_users_unpartitioned;
+
+COMMIT;
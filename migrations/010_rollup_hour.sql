@@ -0,0 +1,31 @@
+-- migrations/010_rollup_hour.sql
+
+-- Hourly rollups for /metrics?accuracy=approx, so long ranges merge one
+-- sketch per hour and key instead of one per minute. Same columns as
+-- event_rollup_minute; only the rollup compactor writes it, adding each
+-- minute row the first time it folds it. An hour is therefore its
+-- event_rollup_hour rows plus its event_rollup_minute rows that are not
+-- compacted yet.
+CREATE TABLE IF NOT EXISTS event_rollup_hour (
+  event_name  TEXT        NOT NULL,
+  bucket      TIMESTAMPTZ NOT NULL,
+  channel     TEXT        NOT NULL,
+  campaign_id TEXT        NOT NULL DEFAULT '',
+  events      BIGINT      NOT NULL,
+  users_hll   BYTEA,
+  compacted   BOOLEAN     NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS event_rollup_hour_key_idx
+  ON event_rollup_hour (event_name, bucket, channel, campaign_id);
+
+CREATE INDEX IF NOT EXISTS event_rollup_hour_pending_idx
+  ON event_rollup_hour (bucket)
+  WHERE NOT compacted;
+
+-- Backfill: with every minute row pending again, the compactor folds them
+-- all once more and builds the hours as it goes (in the background, 1000
+-- keys per transaction). Reads stay exact meanwhile, since a pending minute
+-- row is read as such. Run after 009 with the previous version stopped: its
+-- compactor would fold minutes without adding them to the hours.
+UPDATE event_rollup_minute SET compacted = false WHERE compacted;
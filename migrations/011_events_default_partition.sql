@@ -0,0 +1,19 @@
+-- migrations/011_events_default_partition.sql
+
+-- Default partitions take timestamps no range partition covers: older than
+-- the partition manager's lookback (EVENTS_MAX_AGE; with the default of 0,
+-- anything before the current period) or in a gap left while the manager
+-- was off. Backfills are therefore stored instead of rejected. The manager
+-- moves rows out of them when it later creates a range partition over them;
+-- the ts / bucket indexes keep that lookup cheap.
+CREATE TABLE IF NOT EXISTS events_default
+  PARTITION OF events DEFAULT;
+
+CREATE INDEX IF NOT EXISTS events_default_ts_idx
+  ON events_default (ts);
+
+CREATE TABLE IF NOT EXISTS event_rollup_minute_users_default
+  PARTITION OF event_rollup_minute_users DEFAULT;
+
+CREATE INDEX IF NOT EXISTS event_rollup_minute_users_default_bucket_idx
+  ON event_rollup_minute_users_default (bucket);
@@ -0,0 +1,19 @@
+-- migrations/012_event_keys.sql
+
+-- dedup_key -> ts for every event. events is partitioned by ts and the key
+-- is a hash, so a lookup by key alone would probe every partition; with the
+-- ts from here PostgreSQL prunes all but one. Written in the insert
+-- transaction, trimmed with the partitions by retention.
+CREATE TABLE IF NOT EXISTS event_keys (
+  dedup_key TEXT        PRIMARY KEY,
+  ts        TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS event_keys_ts_idx
+  ON event_keys (ts);
+
+-- Backfill. Run with the previous version stopped: events it inserts after
+-- this statement would have no key row (re-running it is safe).
+INSERT INTO event_keys (dedup_key, ts)
+SELECT dedup_key, ts FROM events
+ON CONFLICT DO NOTHING;